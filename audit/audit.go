@@ -0,0 +1,143 @@
+// Package audit signs checkpoints of the records audit chain. A checkpoint exported out of
+// the database pins the chain head at a point in time, so the chain cannot be rewritten
+// from scratch without the checkpoints no longer matching.
+package audit
+
+import (
+	"bufio"
+	"code_challenge1/db"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyEnv holds the key checkpoints are signed with.
+	KeyEnv = "AUDIT_SIGNING_KEY"
+	// FileEnv holds the file checkpoints are written to, DefaultFile when not set.
+	FileEnv     = "AUDIT_CHECKPOINT_FILE"
+	DefaultFile = "audit_checkpoints.jsonl"
+)
+
+type Checkpoint struct {
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	Signature string    `json:"signature"`
+}
+
+// Key returns the signing key from the environment, nil if it is not set.
+func Key() []byte {
+	if k := os.Getenv(KeyEnv); k != "" {
+		return []byte(k)
+	}
+	return nil
+}
+
+// File returns the checkpoint file from the environment.
+func File() string {
+	if f := os.Getenv(FileEnv); f != "" {
+		return f
+	}
+	return DefaultFile
+}
+
+func (c *Checkpoint) sign(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%d|%s|%s", c.Seq, c.Hash, c.CreatedAt.UTC().Format(time.RFC3339))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Valid tells whether the checkpoint was signed with the key.
+func (c *Checkpoint) Valid(key []byte) bool {
+	sig, err := hex.DecodeString(c.Signature)
+	if err != nil {
+		return false
+	}
+	want, _ := hex.DecodeString(c.sign(key))
+	return hmac.Equal(sig, want)
+}
+
+// WriteCheckpoint signs the current chain head and appends it to the file, one json
+// checkpoint per line. The chain is verified first, a checkpoint never vouches for a
+// broken chain.
+func WriteCheckpoint(d *db.DB, key []byte, path string) (*Checkpoint, error) {
+	if len(key) == 0 {
+		return nil, errors.Errorf("%s is not set", KeyEnv)
+	}
+	seq, hash, err := d.ChainHead()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.VerifyChain(); err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{Seq: seq, Hash: hash, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	c.Signature = c.sign(key)
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode checkpoint")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open checkpoint file")
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return nil, errors.Wrap(err, "write checkpoint")
+	}
+	return c, nil
+}
+
+// ReadCheckpoints reads the checkpoints written to the file.
+func ReadCheckpoints(path string) ([]Checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open checkpoint file")
+	}
+	defer f.Close()
+
+	var res []Checkpoint
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var c Checkpoint
+		if err := json.Unmarshal(s.Bytes(), &c); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		res = append(res, c)
+	}
+	return res, errors.Wrap(s.Err(), "read checkpoint file")
+}
+
+// VerifyCheckpoints checks that every checkpoint is signed with the key and still matches
+// the record at its position.
+func VerifyCheckpoints(d *db.DB, key []byte, checkpoints []Checkpoint) error {
+	if len(key) == 0 {
+		return errors.Errorf("%s is not set", KeyEnv)
+	}
+	for i, c := range checkpoints {
+		if !c.Valid(key) {
+			return errors.Errorf("checkpoint %d at position %d has an invalid signature", i+1, c.Seq)
+		}
+		if c.Seq == 0 {
+			continue
+		}
+		hash, err := d.ChainHash(c.Seq)
+		if err != nil {
+			return errors.Wrapf(err, "checkpoint %d", i+1)
+		}
+		if hash != c.Hash {
+			return errors.Errorf("checkpoint %d does not match record at position %d, the chain was rewritten", i+1, c.Seq)
+		}
+	}
+	return nil
+}
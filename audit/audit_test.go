@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDbTest() {
+	os.Setenv("TEST_ENV", "true")
+	db.Schema = db.SqliteSchema
+}
+
+func TestCheckpoints(t *testing.T) {
+	setupDbTest()
+	d, err := db.Open()
+	assert.Nil(t, err)
+	key := []byte("secret")
+	f := filepath.Join(t.TempDir(), "checkpoints.jsonl")
+
+	_, err = WriteCheckpoint(d, nil, f)
+	assert.NotNil(t, err)
+
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	c1, err := WriteCheckpoint(d, key, f)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), c1.Seq)
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	c2, err := WriteCheckpoint(d, key, f)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), c2.Seq)
+
+	cs, err := ReadCheckpoints(f)
+	assert.Nil(t, err)
+	assert.Equal(t, []Checkpoint{*c1, *c2}, cs)
+	assert.Nil(t, VerifyCheckpoints(d, key, cs))
+	assert.NotNil(t, VerifyCheckpoints(d, []byte("other"), cs))
+	assert.NotNil(t, VerifyCheckpoints(d, nil, cs))
+
+	forged := cs[1]
+	forged.Hash = cs[0].Hash
+	assert.NotNil(t, VerifyCheckpoints(d, key, []Checkpoint{forged}))
+
+	//a checkpoint from a chain that is no longer there
+	other := Checkpoint{Seq: 2, Hash: "abc", CreatedAt: c2.CreatedAt}
+	other.Signature = other.sign(key)
+	assert.True(t, other.Valid(key))
+	assert.NotNil(t, VerifyCheckpoints(d, key, []Checkpoint{other}))
+
+	_, err = ReadCheckpoints(filepath.Join(t.TempDir(), "missing.jsonl"))
+	assert.NotNil(t, err)
+	assert.Nil(t, os.WriteFile(f, []byte("{}\nnot json\n"), 0o600))
+	_, err = ReadCheckpoints(f)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,5 @@
+// Package bankpb holds the protobuf messages and gRPC service of the bank API, generated
+// from bank.proto.
+package bankpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative bank.proto
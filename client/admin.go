@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The admin endpoints, sent with the token of WithAdminToken.
+
+type RiskDecision struct {
+	ID           int        `json:"id"`
+	FromUser     int        `json:"from_user"`
+	ToUser       int        `json:"to_user"`
+	Amount       *big.Rat   `json:"amount"`
+	Action       string     `json:"action"`
+	Reasons      []string   `json:"reasons"`
+	ReviewStatus string     `json:"review_status"`
+	Reviewer     string     `json:"reviewer"`
+	ReviewNote   string     `json:"review_note"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+}
+
+// RiskReviews lists the risk review queue, pending reviews when status is empty.
+func (c *Client) RiskReviews(ctx context.Context, status string) ([]RiskDecision, error) {
+	var out []RiskDecision
+	if err := c.post(ctx, "/admin/risk/reviews", map[string]string{"status": status}, &out, safe); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) ReviewRisk(ctx context.Context, id int, status, reviewer, note string) (*RiskDecision, error) {
+	in := map[string]interface{}{"id": id, "status": status, "reviewer": reviewer, "note": note}
+	var out RiskDecision
+	if err := c.post(ctx, "/admin/risk/review", in, &out, once); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetUserStatus changes the status of the user and returns the new one.
+func (c *Client) SetUserStatus(ctx context.Context, userID int, status, operator, reason string) (string, error) {
+	in := map[string]interface{}{"user_id": userID, "status": status, "operator": operator, "reason": reason}
+	var out struct {
+		Status string `json:"status"`
+	}
+	if err := c.post(ctx, "/admin/user/status", in, &out, once); err != nil {
+		return "", err
+	}
+	return out.Status, nil
+}
+
+// SetUserTier puts the user in a fee tier.
+func (c *Client) SetUserTier(ctx context.Context, userID int, tier string) error {
+	in := map[string]interface{}{"user_id": userID, "tier": tier}
+	return c.post(ctx, "/admin/user/tier", in, nil, once)
+}
+
+type StatusChange struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Operator   string    `json:"operator"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (c *Client) UserStatusHistory(ctx context.Context, userID int) ([]StatusChange, error) {
+	var out []StatusChange
+	if err := c.post(ctx, "/admin/user/status/history", map[string]int{"user_id": userID}, &out, safe); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ImportUsers creates the users of a name,balance csv, all or none, and returns how many.
+func (c *Client) ImportUsers(ctx context.Context, csv io.Reader) (int, error) {
+	body, err := io.ReadAll(csv)
+	if err != nil {
+		return 0, errors.Wrap(err, "read csv")
+	}
+	data, _, err := c.send(ctx, "/admin/users/import", "text/csv", body, once)
+	if err != nil {
+		return 0, err
+	}
+	res, err := decodeResponse(200, data)
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Imported int `json:"imported"`
+	}
+	return out.Imported, errors.Wrap(json.Unmarshal(res.Data, &out), "decode data")
+}
+
+// AddAPIKey issues an api key for the user's streams.
+func (c *Client) AddAPIKey(ctx context.Context, userID int) (string, error) {
+	var out struct {
+		APIKey string `json:"api_key"`
+	}
+	if err := c.post(ctx, "/admin/user/key", map[string]int{"user_id": userID}, &out, once); err != nil {
+		return "", err
+	}
+	return out.APIKey, nil
+}
+
+// RevokeAPIKeys revokes every api key of the user and returns how many there were.
+func (c *Client) RevokeAPIKeys(ctx context.Context, userID int) (int, error) {
+	var out struct {
+		Revoked int `json:"revoked"`
+	}
+	if err := c.post(ctx, "/admin/user/key/revoke", map[string]int{"user_id": userID}, &out, safe); err != nil {
+		return 0, err
+	}
+	return out.Revoked, nil
+}
+
+type Mismatch struct {
+	AccountID int      `json:"account_id"`
+	UserID    int      `json:"user_id"`
+	Balance   *big.Rat `json:"balance"`
+	Expected  *big.Rat `json:"expected"`
+}
+
+type Reconciliation struct {
+	ID           int        `json:"id"`
+	OK           bool       `json:"ok"`
+	Accounts     int        `json:"accounts"`
+	TotalBalance *big.Rat   `json:"total_balance"`
+	NetDeposits  *big.Rat   `json:"net_deposits"`
+	Mismatches   []Mismatch `json:"mismatches"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func (c *Client) LastReconciliation(ctx context.Context) (*Reconciliation, error) {
+	var out Reconciliation
+	if err := c.post(ctx, "/admin/reconciliation", struct{}{}, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetInterestRate sets the annual interest rate of the account, eg. 0.035, overriding the
+// rate of its product. A nil rate goes back to the product rate.
+func (c *Client) SetInterestRate(ctx context.Context, accountID int, rate *big.Rat) error {
+	in := map[string]interface{}{"account_id": accountID, "rate": amount(rate)}
+	return c.post(ctx, "/admin/account/interest", in, nil, safe)
+}
+
+type InterestPosting struct {
+	Month string `json:"month"`
+	// Accrued and Carry are exact fractions, Amount is what was paid.
+	Accrued   *big.Rat  `json:"accrued"`
+	Amount    *big.Rat  `json:"amount"`
+	Carry     *big.Rat  `json:"carry"`
+	RecordID  int       `json:"record_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InterestPostings lists the monthly interest paid to the account, oldest first.
+func (c *Client) InterestPostings(ctx context.Context, accountID int) ([]InterestPosting, error) {
+	var out []InterestPosting
+	if err := c.post(ctx, "/admin/account/interest/postings", map[string]int{"account_id": accountID}, &out, safe); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type Pool struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+type PoolStats struct {
+	Primary Pool `json:"primary"`
+	// Replica is nil when the server reads from the primary only.
+	Replica *Pool `json:"replica"`
+}
+
+// PoolStats returns the connection pool statistics of the server's database.
+func (c *Client) PoolStats(ctx context.Context) (*PoolStats, error) {
+	var out PoolStats
+	if err := c.post(ctx, "/admin/db/pool", struct{}{}, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+type CacheStats struct {
+	Enabled bool `json:"enabled"`
+	// Active is false while the server bypasses the cache.
+	Active        bool    `json:"active"`
+	Size          int     `json:"size"`
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	Invalidations int64   `json:"invalidations"`
+}
+
+// CacheStats returns the counters of the server's user cache since it started.
+func (c *Client) CacheStats(ctx context.Context) (*CacheStats, error) {
+	var out CacheStats
+	if err := c.post(ctx, "/admin/db/cache", struct{}{}, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+type Webhook struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Secret is only returned by AddWebhook.
+	Secret string `json:"secret"`
+}
+
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	var out []Webhook
+	if err := c.post(ctx, "/admin/webhooks", struct{}{}, &out, safe); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AddWebhook subscribes url to the event types, signed with secret or a random one.
+func (c *Client) AddWebhook(ctx context.Context, url string, eventTypes []string, secret string) (*Webhook, error) {
+	in := map[string]interface{}{"url": url, "event_types": eventTypes, "secret": secret}
+	var out Webhook
+	if err := c.post(ctx, "/admin/webhook/add", in, &out, once); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, id int, url string, eventTypes []string, active bool) (*Webhook, error) {
+	in := map[string]interface{}{"id": id, "url": url, "event_types": eventTypes, "active": active}
+	var out Webhook
+	if err := c.post(ctx, "/admin/webhook/update", in, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+	return c.post(ctx, "/admin/webhook/delete", map[string]int{"id": id}, nil, once)
+}
+
+type DeliveryAttempt struct {
+	StatusCode int       `json:"status_code"`
+	Response   string    `json:"response"`
+	Error      string    `json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Delivery struct {
+	ID            int               `json:"id"`
+	EventID       int               `json:"event_id"`
+	EventType     string            `json:"event_type"`
+	Payload       json.RawMessage   `json:"payload"`
+	Status        string            `json:"status"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+	Attempts      []DeliveryAttempt `json:"attempts"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// WebhookDeliveries is the delivery log of the webhook, newest first. Status filters the
+// deliveries when set, limit 0 is the server default.
+func (c *Client) WebhookDeliveries(ctx context.Context, webhookID int, status string, limit int) ([]Delivery, error) {
+	in := map[string]interface{}{"webhook_id": webhookID, "status": status, "limit": limit}
+	var out []Delivery
+	if err := c.post(ctx, "/admin/webhook/deliveries", in, &out, safe); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RetryDelivery puts a dead delivery back in the queue.
+func (c *Client) RetryDelivery(ctx context.Context, deliveryID int) error {
+	return c.post(ctx, "/admin/webhook/delivery/retry", map[string]int{"delivery_id": deliveryID}, nil, once)
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// User is a user as created, with its main account.
+type User struct {
+	ID          int
+	Name        string
+	Status      string
+	MainAccount int
+	Balance     *big.Rat
+}
+
+type Account struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Balance *big.Rat `json:"balance"`
+}
+
+// Balance is the balance of the user's main account, along with all its accounts.
+type Balance struct {
+	Name     string    `json:"name"`
+	Balance  *big.Rat  `json:"balance"`
+	Status   string    `json:"status"`
+	Tier     string    `json:"tier"`
+	Accounts []Account `json:"accounts"`
+}
+
+type Record struct {
+	FromUser    int      `json:"from_user"`
+	ToUser      int      `json:"to_user"`
+	FromAccount int      `json:"from_account"`
+	ToAccount   int      `json:"to_account"`
+	Amount      *big.Rat `json:"amount"`
+}
+
+// AddUser creates the user with a main account holding balance.
+func (c *Client) AddUser(ctx context.Context, name string, balance *big.Rat) (*User, error) {
+	var out struct {
+		ID User `json:"id"`
+	}
+	err := c.post(ctx, "/user/add", map[string]string{"name": name, "balance": amount(balance)}, &out, keyed)
+	if err != nil {
+		return nil, err
+	}
+	return &out.ID, nil
+}
+
+func (c *Client) UserBalance(ctx context.Context, userID int) (*Balance, error) {
+	var out Balance
+	if err := c.post(ctx, "/user/balance", map[string]int{"user_id": userID}, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UserInfo is a user as listed and updated by the user management calls.
+type UserInfo struct {
+	ID          int               `json:"id"`
+	Name        string            `json:"name"`
+	Status      string            `json:"status"`
+	Tier        string            `json:"tier"`
+	MainAccount int               `json:"main_account"`
+	Balance     *big.Rat          `json:"balance"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// UserPage is a page of users, NextAfterID asks for the next one and is 0 on the last.
+type UserPage struct {
+	Users       []UserInfo `json:"users"`
+	NextAfterID int        `json:"next_after_id"`
+}
+
+// Users lists the users whose name starts with prefix, every user when empty, by id from
+// afterID. A limit of 0 gets the largest page.
+func (c *Client) Users(ctx context.Context, prefix string, afterID, limit int) (*UserPage, error) {
+	var out UserPage
+	in := map[string]interface{}{"prefix": prefix, "after_id": afterID, "limit": limit}
+	if err := c.post(ctx, "/users", in, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UserByName(ctx context.Context, name string) (*UserInfo, error) {
+	var out UserInfo
+	if err := c.post(ctx, "/user/by-name", map[string]string{"name": name}, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RenameUser gives the user a name no other user has.
+func (c *Client) RenameUser(ctx context.Context, userID int, name string) (*UserInfo, error) {
+	var out UserInfo
+	in := map[string]interface{}{"user_id": userID, "name": name}
+	if err := c.post(ctx, "/user/rename", in, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateUserMetadata merges metadata into the user's, an empty value removes the key.
+func (c *Client) UpdateUserMetadata(ctx context.Context, userID int, metadata map[string]string) (*UserInfo, error) {
+	var out UserInfo
+	in := map[string]interface{}{"user_id": userID, "metadata": metadata}
+	if err := c.post(ctx, "/user/metadata", in, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// BalanceAtQuery asks for the balance of an account after a record or at a time, one of
+// RecordID and At is required. AccountID defaults to the user's main account.
+type BalanceAtQuery struct {
+	UserID    int
+	AccountID int
+	At        time.Time
+	RecordID  int
+}
+
+type BalanceAt struct {
+	AccountID int        `json:"account_id"`
+	Balance   *big.Rat   `json:"balance"`
+	At        *time.Time `json:"at"`
+	RecordID  int        `json:"record_id"`
+}
+
+func (c *Client) BalanceAt(ctx context.Context, q BalanceAtQuery) (*BalanceAt, error) {
+	in := map[string]interface{}{"user_id": q.UserID, "account_id": q.AccountID, "record_id": q.RecordID}
+	if !q.At.IsZero() {
+		in["at"] = q.At.Format(time.RFC3339)
+	}
+	var out BalanceAt
+	if err := c.post(ctx, "/user/balance/at", in, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Records lists every record of the user, oldest first.
+func (c *Client) Records(ctx context.Context, userID int) ([]Record, error) {
+	var out []Record
+	if err := c.post(ctx, "/records", map[string]int{"user_id": userID}, &out, safe); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StatementQuery asks for the statement of an account, the main one when AccountID is 0.
+// Zero From and To mean from the beginning and up to now, Format is json unless csv or ofx.
+type StatementQuery struct {
+	UserID    int
+	AccountID int
+	From      time.Time
+	To        time.Time
+	Format    string
+}
+
+// Statement returns the statement file as rendered by the server.
+func (c *Client) Statement(ctx context.Context, q StatementQuery) ([]byte, error) {
+	in := map[string]interface{}{"user_id": q.UserID, "account_id": q.AccountID, "format": q.Format}
+	if !q.From.IsZero() {
+		in["from"] = q.From.Format(time.RFC3339)
+	}
+	if !q.To.IsZero() {
+		in["to"] = q.To.Format(time.RFC3339)
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode request")
+	}
+	data, contentType, err := c.send(ctx, "/statement", "application/json", body, safe)
+	if err != nil {
+		return nil, err
+	}
+	//errors come back as the usual response, statements never have a code
+	if strings.HasPrefix(contentType, "application/json") {
+		var res response
+		if json.Unmarshal(data, &res) == nil && res.Code != 0 {
+			return nil, &APIError{StatusCode: 200, Code: res.Code, Message: res.Message}
+		}
+	}
+	return data, nil
+}
+
+// WithdrawOrDeposit deposits amount in the user's main account, or withdraws it when
+// negative, and returns the new balance.
+func (c *Client) WithdrawOrDeposit(ctx context.Context, userID int, amt *big.Rat) (*big.Rat, error) {
+	var out struct {
+		Balance *big.Rat `json:"balance"`
+	}
+	in := map[string]interface{}{"id": userID, "amount": amount(amt)}
+	if err := c.post(ctx, "/deposit", in, &out, keyed); err != nil {
+		return nil, err
+	}
+	return out.Balance, nil
+}
+
+// TransferResult is what a transfer cost the sender, the fee is paid on top of the amount.
+type TransferResult struct {
+	Amount *big.Rat `json:"amount"`
+	Fee    *big.Rat `json:"fee"`
+	Total  *big.Rat `json:"total"`
+}
+
+// Transfer moves money between the main accounts of two users.
+func (c *Client) Transfer(ctx context.Context, fromUserID, toUserID int, amt *big.Rat) (*TransferResult, error) {
+	var out TransferResult
+	in := map[string]interface{}{"from_user_id": fromUserID, "to_user_id": toUserID, "amount": amount(amt)}
+	if err := c.post(ctx, "/transfer", in, &out, keyed); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// QuoteFee previews the fee the user would pay on a transaction of the amount, transaction
+// is transfer or withdraw.
+func (c *Client) QuoteFee(ctx context.Context, transaction string, userID int, amt *big.Rat) (*TransferResult, error) {
+	var out TransferResult
+	in := map[string]interface{}{"transaction": transaction, "user_id": userID, "amount": amount(amt)}
+	if err := c.post(ctx, "/fee/quote", in, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) AddAccount(ctx context.Context, userID int, name string) (*Account, error) {
+	var out Account
+	in := map[string]interface{}{"user_id": userID, "name": name}
+	if err := c.post(ctx, "/account/add", in, &out, keyed); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AccountTransfer moves money between two accounts, which may belong to the same user.
+func (c *Client) AccountTransfer(ctx context.Context, fromAccountID, toAccountID int, amt *big.Rat) (*TransferResult, error) {
+	var out TransferResult
+	in := map[string]interface{}{"from_account_id": fromAccountID, "to_account_id": toAccountID, "amount": amount(amt)}
+	if err := c.post(ctx, "/account/transfer", in, &out, keyed); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+type BatchLeg struct {
+	ToAccountID int      `json:"to_account_id"`
+	Amount      *big.Rat `json:"amount"`
+	Fee         *big.Rat `json:"fee,omitempty"`
+	Status      string   `json:"status,omitempty"`
+}
+
+type Batch struct {
+	ID             int        `json:"batch_id"`
+	IdempotencyKey string     `json:"idempotency_key"`
+	FromAccountID  int        `json:"from_account_id"`
+	Total          *big.Rat   `json:"total"`
+	Fee            *big.Rat   `json:"fee"`
+	Replayed       bool       `json:"replayed"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Legs           []BatchLeg `json:"legs"`
+}
+
+// BatchTransfer pays all the legs from one account, all or nothing. The batch is keyed by
+// the idempotency key of ctx, see WithIdempotencyKey, or a random one.
+func (c *Client) BatchTransfer(ctx context.Context, fromAccountID int, legs []BatchLeg) (*Batch, error) {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	if key == "" {
+		key = NewIdempotencyKey()
+	}
+	type legIn struct {
+		ToAccountID int    `json:"to_account_id"`
+		Amount      string `json:"amount"`
+	}
+	ins := make([]legIn, 0, len(legs))
+	for _, l := range legs {
+		ins = append(ins, legIn{ToAccountID: l.ToAccountID, Amount: amount(l.Amount)})
+	}
+	in := map[string]interface{}{"idempotency_key": key, "from_account_id": fromAccountID, "legs": ins}
+	var out Batch
+	//the server dedups batches by the key in the body
+	if err := c.post(ctx, "/transfer/batch", in, &out, safe); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
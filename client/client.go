@@ -0,0 +1,258 @@
+// Package client is the Go client of the bank http api. Every endpoint has a typed method,
+// amounts are big.Rat and failed calls return an *APIError.
+//
+// Calls that change balances are sent with an Idempotency-Key, so they are retried safely
+// when retries are on, see WithRetries.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IdempotencyHeader is the header the server reads the idempotency key from.
+const IdempotencyHeader = "Idempotency-Key"
+
+// Errors an *APIError matches with errors.Is, depending on what failed.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrBlocked           = errors.New("blocked by risk rules")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrRateLimited       = errors.New("rate limited")
+)
+
+// Codes the server answers the failures callers handle with, others have code 1.
+const (
+	CodeNotFound          = 2
+	CodeBlocked           = 3
+	CodeInsufficientFunds = 4
+)
+
+// APIError is a call the server answered with a non zero code.
+type APIError struct {
+	// StatusCode is the http status, 200 unless the call was refused before reaching the
+	// endpoint, eg. 401 for a missing admin token.
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("bank api error %d: %s", e.Code, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == CodeNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrBlocked:
+		return e.Code == CodeBlocked
+	case ErrInsufficientFunds:
+		return e.Code == CodeInsufficientFunds
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	adminToken string
+	retries    int
+	backoff    time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the http client calls are made with, http.DefaultClient by default.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.httpClient = h }
+}
+
+// WithAdminToken sets the X-Admin-Token sent to the admin endpoints.
+func WithAdminToken(token string) Option {
+	return func(c *Client) { c.adminToken = token }
+}
+
+// WithRetries retries calls failing on the network, with a 5xx or a 429 up to n times,
+// waiting backoff and doubling it after each try, or longer when the server asks to with
+// Retry-After. Calls that are not safe to repeat are never retried.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// New returns a client of the api at baseURL, eg. http://localhost:8080.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		backoff:    100 * time.Millisecond,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey makes the call made with ctx use key instead of a random one, so that
+// it is also safe to repeat across processes, eg. after a restart.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// NewIdempotencyKey returns a random key.
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// retry tells which calls can be retried: reads, and writes the server dedups by key.
+type retry int
+
+const (
+	once retry = iota
+	safe
+	keyed
+)
+
+type response struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// post calls the endpoint with in as json body and decodes the data of the response in out.
+func (c *Client) post(ctx context.Context, path string, in, out interface{}, r retry) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "encode request")
+	}
+	data, _, err := c.send(ctx, path, "application/json", body, r)
+	if err != nil {
+		return err
+	}
+	res, err := decodeResponse(http.StatusOK, data)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrap(json.Unmarshal(res.Data, out), "decode data")
+}
+
+func decodeResponse(status int, data []byte) (*response, error) {
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, errors.Wrapf(err, "decode response with status %d", status)
+	}
+	if res.Code != 0 {
+		return nil, &APIError{StatusCode: status, Code: res.Code, Message: res.Message}
+	}
+	return &res, nil
+}
+
+// send posts the body, retrying as r allows, and returns the body and content type of the
+// 200 response. Other statuses are returned as *APIError.
+func (c *Client) send(ctx context.Context, path, contentType string, body []byte, r retry) ([]byte, string, error) {
+	var key string
+	if r == keyed {
+		key, _ = ctx.Value(idempotencyKey{}).(string)
+		if key == "" {
+			key = NewIdempotencyKey()
+		}
+	}
+	tries := 1
+	if r != once {
+		tries += c.retries
+	}
+	backoff := c.backoff
+	var wait time.Duration
+	var err error
+	for i := 0; i < tries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, "", ctx.Err()
+			case <-time.After(max(backoff, wait)):
+			}
+			backoff *= 2
+		}
+		var data []byte
+		var ct string
+		var again bool
+		data, ct, again, wait, err = c.try(ctx, path, contentType, key, body)
+		if err == nil || !again {
+			return data, ct, err
+		}
+	}
+	return nil, "", err
+}
+
+// try makes one request, again tells whether the error may go away on a retry and wait how
+// long the server asks to wait before it, from Retry-After.
+func (c *Client) try(ctx context.Context, path, contentType, key string, body []byte) ([]byte, string, bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", false, 0, errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Content-Type", contentType)
+	if key != "" {
+		req.Header.Set(IdempotencyHeader, key)
+	}
+	if c.adminToken != "" && strings.HasPrefix(path, "/admin/") {
+		req.Header.Set("X-Admin-Token", c.adminToken)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", ctx.Err() == nil, 0, errors.Wrapf(err, "post %s", path)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", true, 0, errors.Wrapf(err, "read %s", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		again := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		var res response
+		if json.Unmarshal(data, &res) != nil || res.Code == 0 {
+			res = response{Code: 1, Message: strings.TrimSpace(string(data))}
+		}
+		return nil, "", again, time.Duration(secs) * time.Second, &APIError{StatusCode: resp.StatusCode, Code: res.Code, Message: res.Message}
+	}
+	return data, resp.Header.Get("Content-Type"), false, 0, nil
+}
+
+// amount renders an amount the way the server parses it, exact decimals are kept as such.
+func amount(r *big.Rat) string {
+	if r == nil {
+		return ""
+	}
+	if n, ok := r.FloatPrec(); ok {
+		return r.FloatString(n)
+	}
+	return r.RatString()
+}
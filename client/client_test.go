@@ -0,0 +1,324 @@
+package client
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/server"
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupServer(t *testing.T) *httptest.Server {
+	os.Setenv("TEST_ENV", "true")
+	db.Schema = db.SqliteSchema
+	ss, err := server.NewServer()
+	assert.Nil(t, err)
+	ts := httptest.NewServer(ss.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func rat(s string) *big.Rat {
+	r, _ := new(big.Rat).SetString(s)
+	return r
+}
+
+func TestClient(t *testing.T) {
+	ts := setupServer(t)
+	c := New(ts.URL)
+	ctx := context.Background()
+
+	u1, err := c.AddUser(ctx, "alice", rat("100"))
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", u1.Name)
+	assert.Equal(t, "100.00", u1.Balance.FloatString(2))
+	u2, err := c.AddUser(ctx, "bob", rat("0"))
+	assert.Nil(t, err)
+
+	b, err := c.WithdrawOrDeposit(ctx, u1.ID, rat("10.5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "110.50", b.FloatString(2))
+	tr, err := c.Transfer(ctx, u1.ID, u2.ID, rat("20"))
+	assert.Nil(t, err)
+	assert.Equal(t, "20.00", tr.Total.FloatString(2))
+	assert.Equal(t, 0, tr.Fee.Sign())
+
+	savings, err := c.AddAccount(ctx, u1.ID, "savings")
+	assert.Nil(t, err)
+	assert.Equal(t, "savings", savings.Name)
+	_, err = c.AccountTransfer(ctx, u1.MainAccount, savings.ID, rat("0.5"))
+	assert.Nil(t, err)
+
+	bal, err := c.UserBalance(ctx, u1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "90.00", bal.Balance.FloatString(2))
+	assert.Equal(t, 2, len(bal.Accounts))
+	assert.Equal(t, "0.50", bal.Accounts[1].Balance.FloatString(2))
+
+	batch, err := c.BatchTransfer(ctx, u1.MainAccount, []BatchLeg{{ToAccountID: u2.MainAccount, Amount: rat("1")},
+		{ToAccountID: savings.ID, Amount: rat("2")}})
+	assert.Nil(t, err)
+	assert.Equal(t, "3.00", batch.Total.FloatString(2))
+	assert.Equal(t, 2, len(batch.Legs))
+
+	records, err := c.Records(ctx, u2.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "20.00", records[0].Amount.FloatString(2))
+
+	at, err := c.BalanceAt(ctx, BalanceAtQuery{UserID: u1.ID, At: time.Now().Add(time.Hour)})
+	assert.Nil(t, err)
+	assert.Equal(t, "87.00", at.Balance.FloatString(2))
+
+	st, err := c.Statement(ctx, StatementQuery{UserID: u1.ID, Format: "csv"})
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(st), "10.50"))
+	_, err = c.Statement(ctx, StatementQuery{UserID: 1000})
+	assert.NotNil(t, err)
+}
+
+func TestClient_Errors(t *testing.T) {
+	ts := setupServer(t)
+	c := New(ts.URL)
+	ctx := context.Background()
+
+	_, err := c.UserBalance(ctx, 1000)
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, CodeNotFound, apiErr.Code)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrUnauthorized))
+
+	u, err := c.AddUser(ctx, "alice", rat("1"))
+	assert.Nil(t, err)
+	_, err = c.WithdrawOrDeposit(ctx, u.ID, rat("-2"))
+	assert.True(t, errors.As(err, &apiErr))
+	assert.True(t, strings.Contains(apiErr.Message, "cannot withdraw larger than balance"))
+	assert.True(t, errors.Is(err, ErrInsufficientFunds))
+	_, err = c.WithdrawOrDeposit(ctx, u.ID, rat("0.001"))
+	assert.NotNil(t, err)
+
+	_, err = New("http://127.0.0.1:1").UserBalance(ctx, 1)
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &apiErr))
+}
+
+func TestClient_Admin(t *testing.T) {
+	os.Setenv("ADMIN_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_TOKEN")
+	ts := setupServer(t)
+	ctx := context.Background()
+
+	_, err := New(ts.URL).Webhooks(ctx)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	c := New(ts.URL, WithAdminToken("secret"))
+	n, err := c.ImportUsers(ctx, strings.NewReader("name,balance\nalice,10\nbob,20\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	status, err := c.SetUserStatus(ctx, 1, "frozen", "ops", "test")
+	assert.Nil(t, err)
+	assert.Equal(t, "frozen", status)
+	changes, err := c.UserStatusHistory(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, "frozen", changes[0].ToStatus)
+
+	key, err := c.AddAPIKey(ctx, 2)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", key)
+	revoked, err := c.RevokeAPIKeys(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, revoked)
+
+	w, err := c.AddWebhook(ctx, "http://127.0.0.1:1/hook", []string{"TransferCompleted"}, "")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", w.Secret)
+	w, err = c.UpdateWebhook(ctx, w.ID, w.URL, w.EventTypes, false)
+	assert.Nil(t, err)
+	assert.False(t, w.Active)
+	hooks, err := c.Webhooks(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hooks))
+	deliveries, err := c.WebhookDeliveries(ctx, w.ID, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deliveries))
+	assert.NotNil(t, c.RetryDelivery(ctx, 1000))
+	assert.Nil(t, c.DeleteWebhook(ctx, w.ID))
+
+	reviews, err := c.RiskReviews(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(reviews))
+	_, err = c.ReviewRisk(ctx, 1000, "approved", "ops", "")
+	assert.NotNil(t, err)
+
+	_, err = c.LastReconciliation(ctx)
+	assert.NotNil(t, err)
+
+	u, err := c.AddUser(ctx, "carl", rat("10"))
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetInterestRate(ctx, u.MainAccount, rat("0.035")))
+	assert.Nil(t, c.SetInterestRate(ctx, u.MainAccount, nil))
+	assert.NotNil(t, c.SetInterestRate(ctx, u.MainAccount, rat("-1")))
+	postings, err := c.InterestPostings(ctx, u.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(postings))
+	_, err = c.InterestPostings(ctx, 9999)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	pool, err := c.PoolStats(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, pool.Primary.MaxOpenConnections)
+	assert.Nil(t, pool.Replica)
+	cache, err := c.CacheStats(ctx)
+	assert.Nil(t, err)
+	assert.True(t, cache.Enabled)
+}
+
+func TestClient_Fees(t *testing.T) {
+	os.Setenv("FEES", `[{"transaction":"transfer","kind":"flat","amount":"0.25"},{"transaction":"transfer","tier":"premium","kind":"flat","amount":"0"}]`)
+	defer os.Unsetenv("FEES")
+	os.Setenv("ADMIN_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_TOKEN")
+	ts := setupServer(t)
+	ctx := context.Background()
+	c := New(ts.URL, WithAdminToken("secret"))
+	u1, _ := c.AddUser(ctx, "alice", rat("100"))
+	u2, _ := c.AddUser(ctx, "bob", rat("0"))
+
+	q, err := c.QuoteFee(ctx, "transfer", u1.ID, rat("10"))
+	assert.Nil(t, err)
+	assert.Equal(t, "0.25", q.Fee.FloatString(2))
+	tr, err := c.Transfer(ctx, u1.ID, u2.ID, rat("10"))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.25", tr.Total.FloatString(2))
+
+	assert.Nil(t, c.SetUserTier(ctx, u1.ID, "premium"))
+	tr, err = c.Transfer(ctx, u1.ID, u2.ID, rat("10"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, tr.Fee.Sign())
+	bal, err := c.UserBalance(ctx, u1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "79.75", bal.Balance.FloatString(2))
+	assert.Equal(t, "premium", bal.Tier)
+}
+
+func TestClient_Users(t *testing.T) {
+	ts := setupServer(t)
+	ctx := context.Background()
+	c := New(ts.URL)
+	for _, name := range []string{"alice", "albert", "bob"} {
+		_, err := c.AddUser(ctx, name, rat("1"))
+		assert.Nil(t, err)
+	}
+
+	page, err := c.Users(ctx, "", 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Users))
+	page, err = c.Users(ctx, "", page.NextAfterID, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", page.Users[0].Name)
+	assert.Equal(t, 0, page.NextAfterID)
+	page, err = c.Users(ctx, "al", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Users))
+
+	u, err := c.RenameUser(ctx, 3, "carol")
+	assert.Nil(t, err)
+	assert.Equal(t, "carol", u.Name)
+	_, err = c.RenameUser(ctx, 3, "alice")
+	assert.NotNil(t, err)
+	u, err = c.UpdateUserMetadata(ctx, 3, map[string]string{"country": "NZ"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"country": "NZ"}, u.Metadata)
+	u, err = c.UserByName(ctx, "carol")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, u.ID)
+	assert.Equal(t, "1.00", u.Balance.FloatString(2))
+	_, err = c.UserByName(ctx, "bob")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+// flaky lets the request through but answers 502 to the first failures, as if the
+// response got lost on the way back.
+func flaky(h http.Handler, failures int32) (http.Handler, *int32) {
+	var calls int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n > failures {
+			h.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		w.WriteHeader(http.StatusBadGateway)
+	}), &calls
+}
+
+func TestClient_Retries(t *testing.T) {
+	ts := setupServer(t)
+	ctx := context.Background()
+	u, err := New(ts.URL).AddUser(ctx, "alice", rat("0"))
+	assert.Nil(t, err)
+
+	h, calls := flaky(ts.Config.Handler, 2)
+	proxy := httptest.NewServer(h)
+	defer proxy.Close()
+
+	//without retries the error comes back, though the deposit went through
+	_, err = New(proxy.URL).WithdrawOrDeposit(ctx, u.ID, rat("1"))
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+
+	//the retries replay the deposit made by the first try
+	c := New(proxy.URL, WithRetries(3, time.Millisecond))
+	b, err := c.WithdrawOrDeposit(ctx, u.ID, rat("10"))
+	assert.Nil(t, err)
+	assert.Equal(t, "11.00", b.FloatString(2))
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+
+	//the same key across calls does the deposit once
+	kctx := WithIdempotencyKey(ctx, "deposit-1")
+	_, err = c.WithdrawOrDeposit(kctx, u.ID, rat("5"))
+	assert.Nil(t, err)
+	b, err = c.WithdrawOrDeposit(kctx, u.ID, rat("5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "16.00", b.FloatString(2))
+	_, err = c.WithdrawOrDeposit(kctx, u.ID, rat("6"))
+	assert.NotNil(t, err)
+
+	//calls not safe to repeat are tried once
+	h, calls = flaky(ts.Config.Handler, 1)
+	proxy2 := httptest.NewServer(h)
+	defer proxy2.Close()
+	_, err = New(proxy2.URL, WithRetries(3, time.Millisecond)).AddWebhook(ctx, "http://127.0.0.1:1", []string{"TransferCompleted"}, "")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestAmount(t *testing.T) {
+	assert.Equal(t, "10.5", amount(rat("10.50")))
+	assert.Equal(t, "-3", amount(rat("-3")))
+	assert.Equal(t, "1/3", amount(rat("1/3")))
+	assert.Equal(t, "", amount(nil))
+}
+
+func TestAPIError_Is(t *testing.T) {
+	err := error(&APIError{StatusCode: 200, Code: CodeBlocked, Message: "amount: transfer blocked by risk rules"})
+	assert.True(t, errors.Is(err, ErrBlocked))
+	assert.False(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, "bank api error 3: amount: transfer blocked by risk rules", err.Error())
+	assert.False(t, errors.Is(&APIError{StatusCode: 200, Code: 1, Message: "no rows in result set"}, ErrNotFound))
+	assert.True(t, errors.Is(&APIError{StatusCode: 401, Code: 1}, ErrUnauthorized))
+	assert.True(t, errors.Is(&APIError{StatusCode: 429, Code: 1}, ErrRateLimited))
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"code_challenge1/audit"
+	"flag"
+
+	"github.com/pkg/errors"
+)
+
+// verify walks the records audit chain and, with -checkpoints, checks the signed checkpoints
+// exported before still match it.
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	checkpoints := fs.String("checkpoints", "", "checkpoint file to verify the chain against")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	n, err := d.VerifyChain()
+	if err != nil {
+		return err
+	}
+	printf("verified %d records\n", n)
+	if *checkpoints == "" {
+		return nil
+	}
+	cs, err := audit.ReadCheckpoints(*checkpoints)
+	if err != nil {
+		return err
+	}
+	if err := audit.VerifyCheckpoints(d, audit.Key(), cs); err != nil {
+		return err
+	}
+	printf("verified %d checkpoints\n", len(cs))
+	return nil
+}
+
+// checkpoint signs the head of the audit chain and appends it to the checkpoint file.
+func checkpoint(args []string) error {
+	fs := flag.NewFlagSet("checkpoint", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	output := fs.String("o", audit.File(), "checkpoint file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	c, err := audit.WriteCheckpoint(d, audit.Key(), *output)
+	if err != nil {
+		return errors.Wrap(err, "checkpoint")
+	}
+	printf("checkpoint at position %d: %s\n", c.Seq, c.Hash)
+	return nil
+}
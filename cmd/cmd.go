@@ -0,0 +1,66 @@
+// Package cmd holds the subcommands of the binary, used by ops to work on the database
+// directly. Without a subcommand the binary serves the api, see serve.
+package cmd
+
+import (
+	"code_challenge1/db"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+// stdout is where commands print their results and openDB how they reach the database,
+// both replaced in tests.
+var (
+	stdout io.Writer = os.Stdout
+	openDB           = db.Open
+)
+
+var commands = []command{
+	{name: "serve", usage: "serve [-addr <addr>] [-grpc <addr>]  run the http api and the gRPC service, the default without a command", run: serve},
+	{name: "migrate", usage: "migrate  bring the database schema up to date", run: migrate},
+	{name: "user", usage: "user create <name> <balance> | show <id> | freeze -operator <name> -reason <text> <id>  manage a user", run: user},
+	{name: "deposit", usage: "deposit <user-id> <amount>  deposit to the user's main account, a negative amount withdraws and pays the fee", run: deposit},
+	{name: "transfer", usage: "transfer <from-user-id> <to-user-id> <amount>  transfer between the main accounts of two users, the sender pays the fee", run: transfer},
+	{name: "records", usage: "records <user-id>  print the records of the user", run: records},
+	{name: "import-users", usage: "import-users <file.csv>  create users with opening balances from a name,balance csv file", run: importUsers},
+	{name: "interest", usage: "interest [-until <date>]  accrue the interest of the days before the date and post the months before it", run: accrueInterest},
+	{name: "reconcile", usage: "reconcile  check every account balance against its records", run: reconcile},
+	{name: "verify", usage: "verify [-checkpoints <file>]  verify the records audit chain and the signed checkpoints", run: verify},
+	{name: "checkpoint", usage: "checkpoint [-o <file>]  sign the head of the audit chain and append it to the checkpoint file", run: checkpoint},
+	{name: "export", usage: "export -user <id> [-account <id>] [-from <date>] [-to <date>] [-format csv|json|ofx] [-o <file>]  export an account statement", run: export},
+}
+
+func Usage() string {
+	s := make([]string, 0, len(commands))
+	for _, c := range commands {
+		s = append(s, "  "+c.usage)
+	}
+	return "commands:\n" + strings.Join(s, "\n")
+}
+
+// Run executes the subcommand named by args[0] with the rest of args.
+func Run(args []string) error {
+	if len(args) == 0 {
+		return errors.New(Usage())
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	return errors.Errorf("unknown command %q\n%s", args[0], Usage())
+}
+
+func printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(stdout, format, args...)
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bytes"
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDbTest() (*db.DB, *bytes.Buffer) {
+	os.Setenv("TEST_ENV", "true")
+	db.Schema = db.SqliteSchema
+	d, err := db.Open()
+	if err != nil {
+		panic(err)
+	}
+	openDB = func() (*db.DB, error) {
+		return d, nil
+	}
+	out := new(bytes.Buffer)
+	stdout = out
+	return d, out
+}
+
+func TestRun(t *testing.T) {
+	setupDbTest()
+	assert.NotNil(t, Run(nil))
+	assert.NotNil(t, Run([]string{"unknown"}))
+	assert.Contains(t, Usage(), "import-users")
+}
+
+func TestImportUsers(t *testing.T) {
+	_, out := setupDbTest()
+	f := filepath.Join(t.TempDir(), "users.csv")
+	assert.Nil(t, os.WriteFile(f, []byte("name,balance\nalice,10\nbob,1.5\n"), 0o600))
+
+	assert.Nil(t, Run([]string{"import-users", f}))
+	assert.Equal(t, "imported 2 users\n", out.String())
+	assert.NotNil(t, Run([]string{"import-users", f}))
+
+	assert.NotNil(t, Run([]string{"import-users"}))
+	assert.NotNil(t, Run([]string{"import-users", filepath.Join(t.TempDir(), "missing.csv")}))
+}
+
+func TestExport(t *testing.T) {
+	d, out := setupDbTest()
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+
+	assert.Nil(t, Run([]string{"export", "-user", strconv.Itoa(u.ID)}))
+	assert.Contains(t, out.String(), "closing balance,,,101.00")
+
+	f := filepath.Join(t.TempDir(), "statement.ofx")
+	assert.Nil(t, Run([]string{"export", "-user", strconv.Itoa(u.ID), "-format", "ofx", "-o", f}))
+	data, err := os.ReadFile(f)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "<BALAMT>101.00</BALAMT>")
+
+	assert.NotNil(t, Run([]string{"export"}))
+	assert.NotNil(t, Run([]string{"export", "-user", "1", "-from", "yesterday"}))
+	assert.NotNil(t, Run([]string{"export", "-user", "9999"}))
+	assert.NotNil(t, Run([]string{"export", "-unknown"}))
+}
+
+func TestReconcile(t *testing.T) {
+	d, out := setupDbTest()
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+
+	assert.Nil(t, Run([]string{"reconcile"}))
+	assert.Contains(t, out.String(), "total balance: 101.00\nnet deposits: 101.00\nok\n")
+
+	assert.NotNil(t, Run([]string{"reconcile", "now"}))
+}
+
+func TestVerify(t *testing.T) {
+	d, out := setupDbTest()
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	f := filepath.Join(t.TempDir(), "checkpoints.jsonl")
+
+	os.Unsetenv("AUDIT_SIGNING_KEY")
+	assert.NotNil(t, Run([]string{"checkpoint", "-o", f}))
+	os.Setenv("AUDIT_SIGNING_KEY", "secret")
+	defer os.Unsetenv("AUDIT_SIGNING_KEY")
+	assert.Nil(t, Run([]string{"checkpoint", "-o", f}))
+	assert.Contains(t, out.String(), "checkpoint at position 1")
+
+	assert.Nil(t, Run([]string{"verify", "-checkpoints", f}))
+	assert.Contains(t, out.String(), "verified 1 records\nverified 1 checkpoints\n")
+
+	os.Setenv("AUDIT_SIGNING_KEY", "other")
+	assert.NotNil(t, Run([]string{"verify", "-checkpoints", f}))
+	assert.NotNil(t, Run([]string{"verify", "-checkpoints", filepath.Join(t.TempDir(), "missing.jsonl")}))
+	assert.NotNil(t, Run([]string{"verify", "-unknown"}))
+}
+
+func TestServe(t *testing.T) {
+	setupDbTest()
+	assert.NotNil(t, Run([]string{"serve", "-addr", "bad address", "-grpc", ""}))
+	assert.NotNil(t, Run([]string{"serve", "-unknown"}))
+}
+
+func TestMigrate(t *testing.T) {
+	_, out := setupDbTest()
+	assert.Nil(t, Run([]string{"migrate"}))
+	assert.Equal(t, "database schema is up to date\n", out.String())
+	assert.NotNil(t, Run([]string{"migrate", "now"}))
+}
+
+func TestUser(t *testing.T) {
+	_, out := setupDbTest()
+	assert.Nil(t, Run([]string{"user", "create", " alice ", "10.5"}))
+	assert.Equal(t, "created user 1 alice with balance 10.50\n", out.String())
+	assert.NotNil(t, Run([]string{"user", "create", "alice", "1"}))
+	assert.NotNil(t, Run([]string{"user", "create", "bob", "abc"}))
+	assert.NotNil(t, Run([]string{"user", "create", " ", "1"}))
+	assert.NotNil(t, Run([]string{"user", "create", "_fees", "1"}))
+	assert.NotNil(t, Run([]string{"user", "create", "bob"}))
+
+	out.Reset()
+	assert.Nil(t, Run([]string{"user", "show", "1"}))
+	assert.Equal(t, "id: 1\nname: alice\nstatus: active\naccount 1 main: 10.50\n", out.String())
+	assert.NotNil(t, Run([]string{"user", "show", "2"}))
+	assert.NotNil(t, Run([]string{"user", "show", "one"}))
+
+	out.Reset()
+	assert.NotNil(t, Run([]string{"user", "freeze", "1"}))
+	assert.Nil(t, Run([]string{"user", "freeze", "-operator", "ops", "-reason", "incident 12", "1"}))
+	assert.Equal(t, "user 1 alice is frozen\n", out.String())
+	assert.NotNil(t, Run([]string{"user", "freeze", "-operator", "ops", "-reason", "again", "1"}))
+	assert.NotNil(t, Run([]string{"user", "freeze", "-operator", "ops"}))
+
+	assert.NotNil(t, Run([]string{"user"}))
+	assert.NotNil(t, Run([]string{"user", "delete", "1"}))
+}
+
+func TestDepositTransferRecords(t *testing.T) {
+	d, out := setupDbTest()
+	a, _ := d.AddUser("alice", money.MustParse("100"))
+	b, _ := d.AddUser("bob", money.MustParse("0"))
+
+	assert.Nil(t, Run([]string{"deposit", "1", "5.25"}))
+	assert.Equal(t, "balance of user 1 alice: 105.25\n", out.String())
+	assert.NotNil(t, Run([]string{"deposit", "1", "-1000"}))
+	assert.NotNil(t, Run([]string{"deposit", "1", "1.001"}))
+	assert.NotNil(t, Run([]string{"deposit", "x", "1"}))
+	assert.NotNil(t, Run([]string{"deposit", "1"}))
+
+	out.Reset()
+	assert.Nil(t, Run([]string{"transfer", strconv.Itoa(a.ID), strconv.Itoa(b.ID), "5"}))
+	assert.Equal(t, "transferred 5.00 from user 1 to user 2\n", out.String())
+	assert.NotNil(t, Run([]string{"transfer", "1", "2", "-5"}))
+	assert.NotNil(t, Run([]string{"transfer", "1", "2", "1000"}))
+	assert.NotNil(t, Run([]string{"transfer", "1", "x", "1"}))
+	assert.NotNil(t, Run([]string{"transfer", "1", "2"}))
+
+	//risk rules apply like on /transfer
+	os.Setenv("RISK_RULES", `[{"type":"burst","action":"block","window":"1m","max":1}]`)
+	assert.NotNil(t, Run([]string{"transfer", "1", "2", "1"}))
+	os.Unsetenv("RISK_RULES")
+
+	out.Reset()
+	assert.Nil(t, Run([]string{"records", "2"}))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 1, len(lines))
+	assert.Contains(t, lines[0], "account 1 (user 1) -> account 2 (user 2) 5.00")
+	assert.NotNil(t, Run([]string{"records", "9"}))
+	assert.NotNil(t, Run([]string{"records"}))
+}
+
+func TestInterest(t *testing.T) {
+	d, out := setupDbTest()
+	u, _ := d.AddUser("alice", money.MustParse("100"))
+	assert.Nil(t, d.SetInterestRate(u.MainAccount, big.NewRat(1, 20)))
+
+	assert.Nil(t, Run([]string{"interest"}))
+	assert.Equal(t, "accrued 0 days, posted 0 months\n", out.String())
+	assert.NotNil(t, Run([]string{"interest", "-until", "2999-01-01"}))
+	assert.NotNil(t, Run([]string{"interest", "-until", "tomorrow"}))
+	assert.NotNil(t, Run([]string{"interest", "now"}))
+
+	os.Setenv("INTEREST_RATES", `{"main":"-1"}`)
+	defer os.Unsetenv("INTEREST_RATES")
+	assert.NotNil(t, Run([]string{"interest"}))
+}
+
+func TestFees(t *testing.T) {
+	d, out := setupDbTest()
+	_, _ = d.AddUser("alice", money.MustParse("100"))
+	_, _ = d.AddUser("bob", money.MustParse("0"))
+	os.Setenv("FEES", `[{"transaction":"transfer","kind":"percentage","rate":"0.01","min":"0.5"},{"transaction":"withdraw","kind":"flat","amount":"1"}]`)
+	defer os.Unsetenv("FEES")
+
+	assert.Nil(t, Run([]string{"transfer", "1", "2", "10"}))
+	assert.Equal(t, "transferred 10.00 from user 1 to user 2, fee 0.50\n", out.String())
+	out.Reset()
+	assert.Nil(t, Run([]string{"deposit", "1", "-10"}))
+	assert.Equal(t, "balance of user 1 alice: 78.50, fee 1.00\n", out.String())
+	out.Reset()
+	assert.Nil(t, Run([]string{"deposit", "1", "10"}))
+	assert.Equal(t, "balance of user 1 alice: 88.50\n", out.String())
+
+	os.Setenv("FEES", `[{"transaction":"deposit","kind":"flat","amount":"1"}]`)
+	assert.NotNil(t, Run([]string{"deposit", "1", "10"}))
+	assert.NotNil(t, Run([]string{"transfer", "1", "2", "10"}))
+}
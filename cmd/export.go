@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"code_challenge1/statement"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// export writes the statement of a user's account, to stdout unless -o is given.
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	user := fs.Int("user", 0, "user id")
+	account := fs.Int("account", 0, "account id, the user's main account when not set")
+	from := fs.String("from", "", "start of the statement, RFC3339 or yyyy-mm-dd")
+	to := fs.String("to", "", "end of the statement, RFC3339 or yyyy-mm-dd, the whole day is included")
+	format := fs.String("format", statement.FormatCSV, "csv, json or ofx")
+	output := fs.String("o", "", "output file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *user == 0 {
+		return errors.Errorf("-user is required")
+	}
+	start, end, err := statement.ParseRange(*from, *to)
+	if err != nil {
+		return errors.Wrap(err, "range")
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	st, err := statement.Build(d, *user, *account, start, end)
+	if err != nil {
+		return errors.Wrap(err, "build statement")
+	}
+
+	w := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return errors.Wrap(err, "create output")
+		}
+		defer f.Close()
+		w = io.Writer(f)
+	}
+	return st.Render(w, *format)
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/interest"
+	"flag"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// accrueInterest runs the interest job once, to catch up after an outage or to post a month
+// without waiting for the server.
+func accrueInterest(args []string) error {
+	fs := flag.NewFlagSet("interest", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	until := fs.String("until", "", "accrue the days before this yyyy-mm-dd day, today when not set")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.Errorf("usage: interest [-until <date>]")
+	}
+	end := time.Now()
+	if *until != "" {
+		t, err := time.Parse(db.DayFormat, *until)
+		if err != nil {
+			return errors.Wrap(err, "-until")
+		}
+		if t.After(end) {
+			return errors.Errorf("-until cannot be in the future: %s", *until)
+		}
+		end = t
+	}
+	rates, err := interest.LoadRates()
+	if err != nil {
+		return errors.Wrap(err, "load interest rates")
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	r, err := interest.Run(d, rates, end)
+	if err != nil {
+		return errors.Wrap(err, "interest")
+	}
+	printf("accrued %d days, posted %d months\n", r.Accruals, r.Postings)
+	return nil
+}
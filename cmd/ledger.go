@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"code_challenge1/fees"
+	"code_challenge1/money"
+	"code_challenge1/risk"
+	"code_challenge1/server"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// deposit deposits to the user's main account, a negative amount withdraws.
+func deposit(args []string) error {
+	if len(args) != 2 {
+		return errors.Errorf("usage: deposit <user-id> <amount>")
+	}
+	id, err := parseID("user id", args[0])
+	if err != nil {
+		return err
+	}
+	amount, err := money.Parse(args[1])
+	if err != nil {
+		return err
+	}
+	schedule, err := fees.Load()
+	if err != nil {
+		return errors.Wrap(err, "load fees")
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	u, fee, err := server.WithdrawOrDeposit(d, schedule, id, amount)
+	if err != nil {
+		return errors.Wrap(err, "WithdrawOrDeposit")
+	}
+	printf("balance of user %d %s: %s%s\n", u.ID, u.Name, u.Balance.String(), feeNote(fee))
+	return nil
+}
+
+// transfer moves money between the main accounts of two users, screened by the risk rules
+// like /transfer.
+func transfer(args []string) error {
+	if len(args) != 3 {
+		return errors.Errorf("usage: transfer <from-user-id> <to-user-id> <amount>")
+	}
+	from, err := parseID("from user id", args[0])
+	if err != nil {
+		return err
+	}
+	to, err := parseID("to user id", args[1])
+	if err != nil {
+		return err
+	}
+	amount, err := money.Parse(args[2])
+	if err != nil {
+		return err
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	rules, err := risk.LoadRules()
+	if err != nil {
+		return errors.Wrap(err, "load risk rules")
+	}
+	engine, err := risk.NewEngine(d, rules)
+	if err != nil {
+		return errors.Wrap(err, "risk engine")
+	}
+	schedule, err := fees.Load()
+	if err != nil {
+		return errors.Wrap(err, "load fees")
+	}
+	flagged, err := server.ScreenTransfer(d, engine, from, to, amount)
+	if err != nil {
+		return err
+	}
+	fee, err := server.QuoteFee(d, schedule, fees.Transfer, from, amount)
+	if err != nil {
+		return err
+	}
+	if err := d.TransferWithFee(from, to, amount, fee); err != nil {
+		return errors.Wrap(err, "transfer")
+	}
+	flagged()
+	printf("transferred %s from user %d to user %d%s\n", amount.String(), from, to, feeNote(fee))
+	return nil
+}
+
+// feeNote tells the fee charged, if any.
+func feeNote(fee money.Money) string {
+	if fee.Sign() == 0 {
+		return ""
+	}
+	return ", fee " + fee.String()
+}
+
+// records prints the records of the user, oldest first.
+func records(args []string) error {
+	if len(args) != 1 {
+		return errors.Errorf("usage: records <user-id>")
+	}
+	id, err := parseID("user id", args[0])
+	if err != nil {
+		return err
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	if _, err := d.GetUser(id); err != nil {
+		return errors.Wrap(err, "get user")
+	}
+	rs, err := d.UserRecords(id)
+	if err != nil {
+		return errors.Wrap(err, "query db")
+	}
+	for _, r := range rs {
+		printf("%d %s account %d (user %d) -> account %d (user %d) %s\n", r.ID, r.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+			r.FromAccount, r.FromUser, r.ToAccount, r.ToUser, r.Amount.String())
+	}
+	return nil
+}
+
+func parseID(name, s string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, errors.Errorf("%s should be a number: %q", name, s)
+	}
+	return id, nil
+}
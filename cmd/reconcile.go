@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/pkg/errors"
+)
+
+// reconcile checks every account balance against its records and prints the mismatches,
+// it fails when the ledger is not reconciled so scripts can alert on it.
+func reconcile(args []string) error {
+	if len(args) != 0 {
+		return errors.Errorf("usage: reconcile")
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	r, err := d.Reconcile()
+	if err != nil {
+		return errors.Wrap(err, "reconcile")
+	}
+	printf("accounts: %d\ntotal balance: %s\nnet deposits: %s\n", r.Accounts, r.TotalBalance.String(),
+		r.NetDeposits.String())
+	for _, m := range r.Mismatches {
+		printf("mismatch: account %d of user %d has balance %s, records say %s\n", m.AccountID, m.UserID,
+			m.Balance.String(), m.Expected.String())
+	}
+	if !r.OK {
+		return errors.Errorf("ledger is not reconciled")
+	}
+	printf("ok\n")
+	return nil
+}
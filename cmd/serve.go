@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"code_challenge1/log"
+	"code_challenge1/server"
+	"flag"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// serve runs the http api and the gRPC service until the http server fails, it is what the
+// binary does without a command.
+func serve(args []string) error {
+	grpcDefault := os.Getenv("GRPC_ADDR")
+	if grpcDefault == "" {
+		grpcDefault = ":9090"
+	}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	addr := fs.String("addr", ":8080", "http listen address")
+	grpcAddr := fs.String("grpc", grpcDefault, "gRPC listen address, empty to not serve gRPC")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	s, err := server.NewServer()
+	if err != nil {
+		return errors.Wrap(err, "new server")
+	}
+	defer s.Close()
+	if *grpcAddr != "" {
+		go func() {
+			if err := s.ServeGRPC(*grpcAddr); err != nil {
+				log.Errorf("serve grpc error: %v", err)
+			}
+		}()
+	}
+	return errors.Wrap(s.Serve(*addr), "serve")
+}
+
+// migrate brings the database schema up to date, which opening the database does.
+func migrate(args []string) error {
+	if len(args) != 0 {
+		return errors.Errorf("usage: migrate")
+	}
+	if _, err := openDB(); err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	printf("database schema is up to date\n")
+	return nil
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/importer"
+	"code_challenge1/money"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// importUsers reads the csv file given as argument, - reads from stdin.
+func importUsers(args []string) error {
+	if len(args) != 1 {
+		return errors.Errorf("usage: import-users <file.csv>")
+	}
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return errors.Wrap(err, "open csv")
+		}
+		defer f.Close()
+		r = f
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	n, err := importer.ImportUsers(d, r)
+	if err != nil {
+		return err
+	}
+	printf("imported %d users\n", n)
+	return nil
+}
+
+const userUsage = "usage: user create <name> <balance> | user show <id> | user freeze -operator <name> -reason <text> <id>"
+
+// user creates, shows and freezes single users.
+func user(args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	switch args[0] {
+	case "create":
+		return createUser(args[1:])
+	case "show":
+		return showUser(args[1:])
+	case "freeze":
+		return freezeUser(args[1:])
+	}
+	return errors.Errorf("unknown user command %q\n%s", args[0], userUsage)
+}
+
+func createUser(args []string) error {
+	if len(args) != 2 {
+		return errors.New(userUsage)
+	}
+	name := strings.TrimSpace(args[0])
+	if err := db.CheckUserName(name); err != nil {
+		return err
+	}
+	balance, err := money.Parse(args[1])
+	if err != nil {
+		return err
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	u, err := d.AddUser(name, balance)
+	if err != nil {
+		return err
+	}
+	printf("created user %d %s with balance %s\n", u.ID, u.Name, u.Balance.String())
+	return nil
+}
+
+func showUser(args []string) error {
+	if len(args) != 1 {
+		return errors.New(userUsage)
+	}
+	id, err := parseID("user id", args[0])
+	if err != nil {
+		return err
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	u, err := d.GetUser(id)
+	if err != nil {
+		return errors.Wrap(err, "get user")
+	}
+	accounts, err := d.UserAccounts(id)
+	if err != nil {
+		return errors.Wrap(err, "user accounts")
+	}
+	printf("id: %d\nname: %s\nstatus: %s\n", u.ID, u.Name, u.Status)
+	for _, a := range accounts {
+		printf("account %d %s: %s\n", a.ID, a.Name, a.Balance.String())
+	}
+	return nil
+}
+
+func freezeUser(args []string) error {
+	fs := flag.NewFlagSet("user freeze", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	operator := fs.String("operator", "", "who freezes the user")
+	reason := fs.String("reason", "", "why the user is frozen")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(userUsage)
+	}
+	id, err := parseID("user id", fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	d, err := openDB()
+	if err != nil {
+		return errors.Wrap(err, "open db")
+	}
+	u, err := d.SetUserStatus(id, db.StatusFrozen, strings.TrimSpace(*operator), strings.TrimSpace(*reason))
+	if err != nil {
+		return errors.Wrap(err, "set user status")
+	}
+	printf("user %d %s is %s\n", u.ID, u.Name, u.Status)
+	return nil
+}
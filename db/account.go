@@ -0,0 +1,352 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAccount is the account every user gets on creation.
+const DefaultAccount = "main"
+
+type Account struct {
+	ID        int
+	UserID    int
+	Name      string
+	Balance   money.Money
+	CreatedAt time.Time
+}
+
+// AddAccount opens a new empty account for the user, account names are unique per user.
+func (d *DB) AddAccount(userID int, name string) (*Account, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.Errorf("account name should not be empty")
+	}
+	u, err := getUser(d.db, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get user")
+	}
+	if err := u.canReceive(); err != nil {
+		return nil, err
+	}
+	a := Account{UserID: userID, Name: name, CreatedAt: now()}
+	err = d.db.QueryRow(`INSERT INTO accounts (user_id, name, balance, opening_balance, created_at)
+		VALUES ($1, $2, $3, $3, $4) RETURNING id`, userID, name, 0, a.CreatedAt).Scan(&a.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "add account")
+	}
+	return &a, nil
+}
+
+func (d *DB) GetAccount(id int) (*Account, error) {
+	return getAccount(d.db, id)
+}
+
+func getAccount(q querier, id int) (*Account, error) {
+	row := q.QueryRow("SELECT id, user_id, name, balance, created_at FROM accounts WHERE id=$1", id)
+	return scanAccount(row)
+}
+
+// UserAccounts lists all accounts of the user, the main account first.
+func (d *DB) UserAccounts(userID int) ([]Account, error) {
+	return userAccounts(d.db, userID)
+}
+
+func userAccounts(q querier, userID int) ([]Account, error) {
+	rows, err := q.Query("SELECT id, user_id, name, balance, created_at FROM accounts WHERE user_id=$1 ORDER BY id", userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query accounts")
+	}
+	defer rows.Close()
+
+	var res []Account
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *a)
+	}
+	return res, rows.Err()
+}
+
+func scanAccount(row scanner) (*Account, error) {
+	var a Account
+	if err := row.Scan(&a.ID, &a.UserID, &a.Name, &a.Balance, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// AccountRecords returns the records of the account created at or after since, oldest first.
+func (d *DB) AccountRecords(accountID int, since time.Time) ([]Record, error) {
+	return accountRecords(d.db, accountID, since)
+}
+
+func accountRecords(q querier, accountID int, since time.Time) ([]Record, error) {
+	rows, err := q.Query(`SELECT id, from_user, to_user, from_account, to_account, amount, created_at FROM records
+		WHERE (from_account=$1 OR to_account=$1) AND created_at>=$2 ORDER BY id`, accountID, dbTime(since))
+	if err != nil {
+		return nil, errors.Wrap(err, "query records")
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var r Record
+		err = rows.Scan(&r.ID, &r.FromUser, &r.ToUser, &r.FromAccount, &r.ToAccount, &r.Amount, &r.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan record")
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// AccountHistory returns the account with its records created at or after since, read in one
+// transaction so that the balance is the one right after the last record.
+func (d *DB) AccountHistory(accountID int, since time.Time) (*Account, []Record, error) {
+	return accountHistory(d.db, d.snapshot, accountID, since)
+}
+
+func accountHistory(db *sql.DB, opts *sql.TxOptions, accountID int, since time.Time) (*Account, []Record, error) {
+	tx, err := db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create tx")
+	}
+	//nothing was written, there is nothing to commit
+	defer func() { _ = tx.Rollback() }()
+	a, err := getAccount(tx, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := accountRecords(tx, accountID, since)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, records, nil
+}
+
+// Effect returns how much the record changed the balance of the account, transfers count
+// negative for the sender. Deposits and withdraws have the same from and to account and
+// their amount is signed already.
+func (r *Record) Effect(accountID int) money.Money {
+	switch accountID {
+	case r.ToAccount:
+		return r.Amount
+	case r.FromAccount:
+		return r.Amount.Neg()
+	default:
+		return 0
+	}
+}
+
+// accountOwner returns the account together with the user owning it, read from the database
+// and not the cache as money is moved based on them.
+func (d *DB) accountOwner(id int) (*Account, *User, error) {
+	a, err := d.GetAccount(id)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get account %d", id)
+	}
+	u, err := getUser(d.db, a.UserID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get user %d", a.UserID)
+	}
+	return a, u, nil
+}
+
+func (d *DB) AccountWithdrawOrDeposit(id int, amount money.Money) (*Account, error) {
+	return d.AccountWithdrawOrDepositWithFee(id, amount, 0)
+}
+
+// AccountWithdrawOrDepositWithFee is AccountWithdrawOrDeposit also charging the account the
+// fee, paid to the fee account in the same transaction. A zero fee charges nothing.
+func (d *DB) AccountWithdrawOrDepositWithFee(id int, amount, fee money.Money) (*Account, error) {
+	if err := checkFee(fee); err != nil {
+		return nil, err
+	}
+
+	a, u, err := d.accountOwner(id)
+	if err != nil {
+		return nil, err
+	}
+	check := (*User).canReceive
+	if amount.Sign() < 0 {
+		check = (*User).canSend
+	}
+	if err := check(u); err != nil {
+		return nil, err
+	}
+	net, err := amount.Sub(fee)
+	if err != nil {
+		return nil, errors.Wrap(err, "new balance")
+	}
+
+	//the balance is checked and updated in place, so concurrent changes are not lost
+	var b1, paid money.Money
+	record, entry := recordStatement(a, a, amount)
+	statements := []Statement{
+		d.statusCheck(u.ID, check),
+		{exec: func(tx *sql.Tx) error {
+			var err error
+			if net.Sign() < 0 {
+				paid, err = debitBalance(tx, id, net.Neg())
+				if errors.Is(err, ErrInsufficientFunds) {
+					return errors.Wrap(err, "cannot withdraw larger than balance")
+				}
+			} else {
+				paid, err = addBalance(tx, id, net)
+			}
+			if err != nil {
+				return errors.Wrap(err, "new balance")
+			}
+			b1, err = paid.Add(fee)
+			return errors.Wrap(err, "new balance")
+		}, users: []int{a.UserID}},
+		record,
+		{exec: func(tx *sql.Tx) error {
+			return fundsMovedStatement(a, amount, b1, entry).exec(tx)
+		}},
+	}
+	if fee.Sign() > 0 {
+		feeStatements, err := d.feeStatements(a, fee, &paid)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, feeStatements...)
+	}
+	err = d.transaction(statements)
+	if err != nil {
+		return nil, errors.Wrap(err, "transaction")
+	}
+
+	return d.GetAccount(id)
+}
+
+// TransferAccounts moves money between two accounts, which may belong to the same user.
+func (d *DB) TransferAccounts(fromId, toId int, amount money.Money) error {
+	return d.TransferAccountsWithFee(fromId, toId, amount, 0)
+}
+
+// TransferAccountsWithFee is TransferAccounts also charging the sender the fee on top of the
+// amount, paid to the fee account in the same transaction. A zero fee charges nothing.
+func (d *DB) TransferAccountsWithFee(fromId, toId int, amount, fee money.Money) error {
+	if err := checkFee(fee); err != nil {
+		return err
+	}
+	if amount.Sign() < 0 {
+		return errors.Errorf("transfer amount should not be negtive: %v", amount)
+	}
+	if fromId == toId {
+		return errors.Errorf("cannot transfer to the same account")
+	}
+	from, fromUser, err := d.accountOwner(fromId)
+	if err != nil {
+		return errors.Wrap(err, "from account")
+	}
+	to, toUser, err := d.accountOwner(toId)
+	if err != nil {
+		return errors.Wrap(err, "to account")
+	}
+	if err := fromUser.canSend(); err != nil {
+		return err
+	}
+	if err := toUser.canReceive(); err != nil {
+		return err
+	}
+
+	debit, err := amount.Add(fee)
+	if err != nil {
+		return errors.Wrap(err, "from balance")
+	}
+
+	//the balances are checked and updated in place, so concurrent changes are not lost
+	var paid, newFromBalance, newToBalance money.Money
+	record, entry := recordStatement(from, to, amount)
+	statements := []Statement{
+		d.statusCheck(fromUser.ID, (*User).canSend),
+		d.statusCheck(toUser.ID, (*User).canReceive),
+		{exec: func(tx *sql.Tx) error {
+			var err error
+			if paid, err = debitBalance(tx, fromId, debit); err != nil {
+				return errors.Wrap(err, "from balance")
+			}
+			newFromBalance = paid + fee
+			return nil
+		}, users: []int{from.UserID}},
+		{exec: func(tx *sql.Tx) error {
+			var err error
+			newToBalance, err = addBalance(tx, toId, amount)
+			return errors.Wrap(err, "to balance")
+		}, users: []int{to.UserID}},
+		record,
+		{exec: func(tx *sql.Tx) error {
+			return transferStatement(from, to, amount, newFromBalance, newToBalance, entry).exec(tx)
+		}},
+	}
+	if fee.Sign() > 0 {
+		feeStatements, err := d.feeStatements(from, fee, &paid)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, feeStatements...)
+	}
+	err = d.transaction(statements)
+	if err != nil {
+		return errors.Wrap(err, "transaction")
+	}
+	return nil
+}
+
+// recordStatement inserts the ledger record of money moving between two accounts,
+// from and to are the same account for deposits and withdraws. The record is chained into
+// the audit log, see appendRecord, and its id is set in the returned entry once inserted.
+func recordStatement(from, to *Account, amount money.Money) (Statement, *chainEntry) {
+	e := &chainEntry{
+		FromUser:    from.UserID,
+		ToUser:      to.UserID,
+		FromAccount: from.ID,
+		ToAccount:   to.ID,
+		Amount:      int64(amount),
+		CreatedAt:   now(),
+	}
+	return Statement{exec: func(tx *sql.Tx) error { return appendRecord(tx, e) }}, e
+}
+
+// ErrInsufficientFunds is returned when the balance does not cover the money taken out.
+var ErrInsufficientFunds = errors.New("balance is not sufficient")
+
+// debitBalance takes the amount off the balance of the account in place. The update itself
+// checks the balance covers it, so concurrent debits cannot spend the same money twice.
+func debitBalance(tx *sql.Tx, accountID int, amount money.Money) (money.Money, error) {
+	var balance money.Money
+	err := tx.QueryRow("UPDATE accounts SET balance=balance-$1 WHERE id=$2 AND balance>=$1 RETURNING balance",
+		amount, accountID).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.Wrapf(ErrInsufficientFunds, "account %d", accountID)
+	}
+	return balance, err
+}
+
+// addBalance adds the amount to the balance of the account in place, for accounts many
+// transactions update at once. It fails instead of taking the balance out of range.
+func addBalance(tx *sql.Tx, accountID int, amount money.Money) (money.Money, error) {
+	query := "UPDATE accounts SET balance=balance+$1 WHERE id=$2 AND balance<=$3 RETURNING balance"
+	limit := money.Max - amount
+	if amount.Sign() < 0 {
+		query = "UPDATE accounts SET balance=balance+$1 WHERE id=$2 AND balance>=$3 RETURNING balance"
+		limit = money.Min - amount
+	}
+	var balance money.Money
+	err := tx.QueryRow(query, amount, accountID, limit).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		//the account was read before, so it is the limit that did not match
+		return 0, errors.Wrapf(money.ErrOverflow, "balance of account %d", accountID)
+	}
+	return balance, err
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_AddAccount(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u, _ := db.AddUser("test1", money.MustParse("100"))
+
+	a, err := db.AddAccount(u.ID, " savings ")
+	assert.Nil(t, err)
+	assert.Equal(t, "savings", a.Name)
+	assert.Equal(t, 0, a.Balance.Sign())
+
+	_, err = db.AddAccount(u.ID, "savings")
+	assert.NotNil(t, err)
+	_, err = db.AddAccount(u.ID, "")
+	assert.NotNil(t, err)
+	_, err = db.AddAccount(9999, "savings")
+	assert.NotNil(t, err)
+
+	accounts, err := db.UserAccounts(u.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(accounts))
+	assert.Equal(t, DefaultAccount, accounts[0].Name)
+	assert.Equal(t, u.MainAccount, accounts[0].ID)
+	assert.Equal(t, "100.00", accounts[0].Balance.String())
+}
+
+func TestDB_TransferAccounts(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	u2, _ := db.AddUser("test2", money.MustParse("100"))
+	savings, _ := db.AddAccount(u1.ID, "savings")
+
+	//between accounts of the same user
+	assert.Nil(t, db.TransferAccounts(u1.MainAccount, savings.ID, money.MustParse("30")))
+	//to another user's main account
+	assert.Nil(t, db.TransferAccounts(savings.ID, u2.MainAccount, money.MustParse("10")))
+
+	a, _ := db.GetAccount(savings.ID)
+	assert.Equal(t, "20.00", a.Balance.String())
+	u, _ := db.GetUser(u1.ID)
+	assert.Equal(t, "70.00", u.Balance.String())
+	u, _ = db.GetUser(u2.ID)
+	assert.Equal(t, "110.00", u.Balance.String())
+
+	assert.NotNil(t, db.TransferAccounts(savings.ID, savings.ID, money.MustParse("1")))
+	assert.NotNil(t, db.TransferAccounts(savings.ID, u2.MainAccount, money.MustParse("21")))
+	assert.NotNil(t, db.TransferAccounts(9999, u2.MainAccount, money.MustParse("1")))
+	assert.NotNil(t, db.TransferAccounts(savings.ID, 9999, money.MustParse("1")))
+
+	records, err := db.UserRecords(u1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, savings.ID, records[1].FromAccount)
+	assert.Equal(t, u2.MainAccount, records[1].ToAccount)
+
+	a, records, err = db.AccountHistory(savings.ID, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, "20.00", a.Balance.String())
+	assert.Equal(t, 2, len(records))
+	_, _, err = db.AccountHistory(9999, time.Time{})
+	assert.NotNil(t, err)
+
+	//closing requires every account to be empty
+	_, err = db.WithdrawOrDeposit(u1.ID, money.MustParse("-70"))
+	assert.Nil(t, err)
+	_, err = db.SetUserStatus(u1.ID, StatusClosed, "ops", "test")
+	assert.NotNil(t, err)
+	_, err = db.AccountWithdrawOrDeposit(savings.ID, money.MustParse("-20"))
+	assert.Nil(t, err)
+	_, err = db.SetUserStatus(u1.ID, StatusClosed, "ops", "test")
+	assert.Nil(t, err)
+	_, err = db.AddAccount(u1.ID, "another")
+	assert.NotNil(t, err)
+}
+
+func TestDB_BalanceOverflow(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u1, _ := d.AddUser("test1", money.Max)
+	u2, _ := d.AddUser("test2", money.MustParse("1"))
+
+	_, err = d.WithdrawOrDeposit(u1.ID, money.MustParse("0.01"))
+	assert.True(t, errors.Is(err, money.ErrOverflow))
+	err = d.Transfer(u2.ID, u1.ID, money.MustParse("1"))
+	assert.True(t, errors.Is(err, money.ErrOverflow))
+	u1, _ = d.GetUser(u1.ID)
+	assert.Equal(t, money.Max, u1.Balance)
+
+	assert.Nil(t, d.Transfer(u1.ID, u2.ID, money.MustParse("1")))
+	u2, _ = d.GetUser(u2.ID)
+	assert.Equal(t, "2.00", u2.Balance.String())
+}
+
+func TestDB_LargeAmounts(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	//well past what 32-bit cents hold
+	u1, err := d.AddUser("test1", money.MustParse("1000000000000.00"))
+	assert.Nil(t, err)
+	u2, _ := d.AddUser("test2", money.MustParse("50000000"))
+
+	assert.Nil(t, d.Transfer(u1.ID, u2.ID, money.MustParse("30000000.01")))
+	_, err = d.WithdrawOrDeposit(u2.ID, money.MustParse("90000000000000000"))
+	assert.Nil(t, err)
+	u1, _ = d.GetUser(u1.ID)
+	u2, _ = d.GetUser(u2.ID)
+	assert.Equal(t, "999969999999.99", u1.Balance.String())
+	assert.Equal(t, "90000000080000000.01", u2.Balance.String())
+
+	records, _ := d.UserRecords(u2.ID)
+	assert.Equal(t, "30000000.01", records[0].Amount.String())
+	assert.Equal(t, "90000000000000000.00", records[1].Amount.String())
+	b, err := d.BalanceAtRecord(u2.MainAccount, records[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "80000000.01", b.String())
+
+	r, err := d.Reconcile()
+	assert.Nil(t, err)
+	assert.True(t, r.OK)
+	assert.Equal(t, "90001000050000000.00", r.TotalBalance.String())
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// AddAPIKey issues a new key authenticating the user, only its hash is kept so the key
+// cannot be shown again.
+func (d *DB) AddAPIKey(userID int) (string, error) {
+	if _, err := d.GetUser(userID); err != nil {
+		return "", errors.Wrap(err, "get user")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "random key")
+	}
+	key := hex.EncodeToString(b)
+	_, err := d.db.Exec("INSERT INTO api_keys (user_id, key_hash, created_at) VALUES ($1, $2, $3)", userID, hashKey(key), now())
+	if err != nil {
+		return "", errors.Wrap(err, "add api key")
+	}
+	return key, nil
+}
+
+// APIKeyUser returns the user the key was issued to.
+func (d *DB) APIKeyUser(key string) (int, error) {
+	var userID int
+	err := d.db.QueryRow("SELECT user_id FROM api_keys WHERE key_hash=$1 AND revoked_at IS NULL", hashKey(key)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.Errorf("api key not valid")
+	}
+	return userID, errors.Wrap(err, "query api key")
+}
+
+// RevokeAPIKeys revokes every key of the user and returns how many there were.
+func (d *DB) RevokeAPIKeys(userID int) (int, error) {
+	res, err := d.db.Exec("UPDATE api_keys SET revoked_at=$1 WHERE user_id=$2 AND revoked_at IS NULL", now(), userID)
+	if err != nil {
+		return 0, errors.Wrap(err, "revoke api keys")
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func hashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
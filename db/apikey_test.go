@@ -0,0 +1,36 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_APIKeys(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+
+	_, err = db.AddAPIKey(9999)
+	assert.NotNil(t, err)
+	k1, err := db.AddAPIKey(u1.ID)
+	assert.Nil(t, err)
+	k2, _ := db.AddAPIKey(u1.ID)
+	assert.NotEqual(t, k1, k2)
+
+	id, err := db.APIKeyUser(k1)
+	assert.Nil(t, err)
+	assert.Equal(t, u1.ID, id)
+	_, err = db.APIKeyUser("unknown")
+	assert.NotNil(t, err)
+
+	n, err := db.RevokeAPIKeys(u1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	_, err = db.APIKeyUser(k2)
+	assert.NotNil(t, err)
+	n, _ = db.RevokeAPIKeys(u1.ID)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// chainEntry is the content of a record covered by its hash.
+type chainEntry struct {
+	// id is set once the record is inserted.
+	id          int
+	FromUser    int
+	ToUser      int
+	FromAccount int
+	ToAccount   int
+	Amount      int64
+	CreatedAt   time.Time
+}
+
+// hash chains the entry at position seq to the hash of the record before it.
+func (e *chainEntry) hash(seq int64, prev string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%s|%d|%d|%d|%d|%d|%s", seq, prev, e.FromUser, e.ToUser, e.FromAccount, e.ToAccount, e.Amount,
+		dbTime(e.CreatedAt).Format(time.RFC3339))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// advanceHead moves the chain head to the entry and returns its position and hashes. The
+// head row stays locked until the transaction ends, so records are chained one at a time.
+func advanceHead(tx *sql.Tx, e *chainEntry) (int64, string, string, error) {
+	var seq int64
+	var prev string
+	err := tx.QueryRow("UPDATE audit_head SET seq=seq+1 WHERE id=1 RETURNING seq, hash").Scan(&seq, &prev)
+	if err != nil {
+		return 0, "", "", errors.Wrap(err, "move chain head")
+	}
+	hash := e.hash(seq, prev)
+	if _, err := tx.Exec("UPDATE audit_head SET hash=$1 WHERE id=1", hash); err != nil {
+		return 0, "", "", errors.Wrap(err, "move chain head")
+	}
+	return seq, prev, hash, nil
+}
+
+// appendRecord inserts the record at the end of the chain.
+func appendRecord(tx *sql.Tx, e *chainEntry) error {
+	seq, prev, hash, err := advanceHead(tx, e)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(`INSERT INTO records (from_user, to_user, from_account, to_account, amount, created_at, seq, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		e.FromUser, e.ToUser, e.FromAccount, e.ToAccount, e.Amount, e.CreatedAt, seq, prev, hash).Scan(&e.id)
+	return errors.Wrap(err, "insert record")
+}
+
+// sealRecords chains the records written before the audit log existed, oldest first.
+func (d *DB) sealRecords() (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "create tx")
+	}
+	defer tx.Rollback()
+	//lock the head first so that two servers starting together do not both seal
+	if _, err := tx.Exec("UPDATE audit_head SET seq=seq WHERE id=1"); err != nil {
+		return 0, errors.Wrap(err, "lock chain head")
+	}
+	rows, err := tx.Query(`SELECT id, from_user, to_user, from_account, to_account, amount, created_at FROM records
+		WHERE hash IS NULL ORDER BY id`)
+	if err != nil {
+		return 0, errors.Wrap(err, "query records")
+	}
+	var ids []int
+	var entries []chainEntry
+	for rows.Next() {
+		var id int
+		var e chainEntry
+		if err := rows.Scan(&id, &e.FromUser, &e.ToUser, &e.FromAccount, &e.ToAccount, &e.Amount, &e.CreatedAt); err != nil {
+			rows.Close()
+			return 0, errors.Wrap(err, "scan record")
+		}
+		ids = append(ids, id)
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, errors.Wrap(err, "query records")
+	}
+
+	for i := range entries {
+		seq, prev, hash, err := advanceHead(tx, &entries[i])
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec("UPDATE records SET seq=$1, prev_hash=$2, hash=$3 WHERE id=$4", seq, prev, hash, ids[i])
+		if err != nil {
+			return 0, errors.Wrap(err, "seal record")
+		}
+	}
+	return len(entries), errors.Wrap(tx.Commit(), "commit tx")
+}
+
+// ChainBreak is the first record where the audit chain does not hold.
+type ChainBreak struct {
+	// RecordID is 0 when records at the end of the chain are missing.
+	RecordID int
+	Seq      int64
+	Reason   string
+}
+
+func (b *ChainBreak) Error() string {
+	if b.RecordID == 0 {
+		return fmt.Sprintf("audit chain broken at position %d: %s", b.Seq, b.Reason)
+	}
+	return fmt.Sprintf("audit chain broken at record %d (position %d): %s", b.RecordID, b.Seq, b.Reason)
+}
+
+// VerifyChain walks the records in chain order, recomputing every hash, and returns how many
+// records were checked. A *ChainBreak error points at the first broken link.
+func (d *DB) VerifyChain() (int, error) {
+	headSeq, headHash, err := d.ChainHead()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := d.db.Query(`SELECT id, seq, prev_hash, hash, from_user, to_user, from_account, to_account, amount, created_at
+		FROM records ORDER BY seq, id`)
+	if err != nil {
+		return 0, errors.Wrap(err, "query records")
+	}
+	defer rows.Close()
+
+	var n int
+	var last int64
+	var lastHash string
+	for rows.Next() {
+		var id int
+		var seq sql.NullInt64
+		var prev, hash sql.NullString
+		var e chainEntry
+		err := rows.Scan(&id, &seq, &prev, &hash, &e.FromUser, &e.ToUser, &e.FromAccount, &e.ToAccount, &e.Amount, &e.CreatedAt)
+		if err != nil {
+			return n, errors.Wrap(err, "scan record")
+		}
+		switch {
+		case !seq.Valid || !hash.Valid:
+			return n, &ChainBreak{RecordID: id, Reason: "record is not in the chain"}
+		case seq.Int64 != last+1:
+			return n, &ChainBreak{RecordID: id, Seq: seq.Int64, Reason: fmt.Sprintf("expected position %d, records before it are missing", last+1)}
+		case prev.String != lastHash:
+			return n, &ChainBreak{RecordID: id, Seq: seq.Int64, Reason: "previous hash does not match the record before it"}
+		case e.hash(seq.Int64, prev.String) != hash.String:
+			return n, &ChainBreak{RecordID: id, Seq: seq.Int64, Reason: "content does not match its hash"}
+		}
+		n++
+		last, lastHash = seq.Int64, hash.String
+	}
+	if err := rows.Err(); err != nil {
+		return n, errors.Wrap(err, "query records")
+	}
+	if last != headSeq || lastHash != headHash {
+		return n, &ChainBreak{Seq: last + 1, Reason: fmt.Sprintf("chain head is at position %d, records after %d are missing", headSeq, last)}
+	}
+	return n, nil
+}
+
+// ChainHead returns the position and hash of the last record in the audit chain.
+func (d *DB) ChainHead() (int64, string, error) {
+	var seq int64
+	var hash string
+	err := d.db.QueryRow("SELECT seq, hash FROM audit_head WHERE id=1").Scan(&seq, &hash)
+	return seq, hash, errors.Wrap(err, "query chain head")
+}
+
+// ChainHash returns the hash of the record at the position of the audit chain.
+func (d *DB) ChainHash(seq int64) (string, error) {
+	var hash string
+	err := d.db.QueryRow("SELECT hash FROM records WHERE seq=$1", seq).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errors.Errorf("no record at position %d", seq)
+	}
+	return hash, errors.Wrap(err, "query record")
+}
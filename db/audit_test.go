@@ -0,0 +1,100 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_VerifyChain(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	n, err := db.VerifyChain()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	u2, _ := db.AddUser("test2", money.MustParse("100"))
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("10"))
+	_ = db.Transfer(u1.ID, u2.ID, money.MustParse("30"))
+	_, _ = db.BatchTransfer("k1", u2.MainAccount, []BatchLeg{{ToAccount: u1.MainAccount, Amount: money.MustParse("1")},
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("2")}})
+
+	n, err = db.VerifyChain()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	seq, hash, err := db.ChainHead()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), seq)
+	h, err := db.ChainHash(4)
+	assert.Nil(t, err)
+	assert.Equal(t, hash, h)
+	_, err = db.ChainHash(5)
+	assert.NotNil(t, err)
+
+	breakAt := func(recordID int, reason string) {
+		_, err := db.VerifyChain()
+		b, ok := err.(*ChainBreak)
+		if assert.True(t, ok, "%v", err) {
+			assert.Equal(t, recordID, b.RecordID)
+			assert.Contains(t, b.Reason, reason)
+		}
+	}
+
+	_, _ = db.db.Exec("UPDATE records SET amount=amount+1 WHERE id=2")
+	breakAt(2, "content")
+	_, _ = db.db.Exec("UPDATE records SET amount=amount-1 WHERE id=2")
+	_, err = db.VerifyChain()
+	assert.Nil(t, err)
+
+	//rehashing an edited record breaks the link to the next one
+	var e chainEntry
+	var prev string
+	err = db.db.QueryRow(`SELECT from_user, to_user, from_account, to_account, amount, created_at, prev_hash FROM records
+		WHERE id=2`).Scan(&e.FromUser, &e.ToUser, &e.FromAccount, &e.ToAccount, &e.Amount, &e.CreatedAt, &prev)
+	assert.Nil(t, err)
+	e.Amount++
+	_, _ = db.db.Exec("UPDATE records SET amount=$1, hash=$2 WHERE id=2", e.Amount, e.hash(2, prev))
+	breakAt(3, "previous hash")
+
+	setupDbTest()
+	db, _ = Open()
+	u1, _ = db.AddUser("test1", money.MustParse("100"))
+	for i := 0; i < 3; i++ {
+		_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+	}
+	_, _ = db.db.Exec("DELETE FROM records WHERE id=3")
+	breakAt(0, "missing")
+	_, _ = db.db.Exec("DELETE FROM records WHERE id=1")
+	breakAt(2, "missing")
+}
+
+func TestDB_sealRecords(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+
+	//records written before the audit chain existed
+	for i := 0; i < 2; i++ {
+		_, err = db.db.Exec(`INSERT INTO records (from_user, to_user, from_account, to_account, amount, created_at)
+			VALUES ($1, $1, $2, $2, 100, $3)`, u1.ID, u1.MainAccount, now())
+		assert.Nil(t, err)
+	}
+	_, err = db.VerifyChain()
+	assert.NotNil(t, err)
+
+	n, err := db.sealRecords()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.sealRecords()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	verified, err := db.VerifyChain()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, verified)
+}
@@ -0,0 +1,296 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaxBatchLegs limits how many payees a single batch transfer can pay.
+const MaxBatchLegs = 100
+
+type BatchLeg struct {
+	ToAccount int
+	Amount    money.Money
+	// Fee is charged to the payer on top of the amount, like for a single transfer.
+	Fee money.Money
+}
+
+type Batch struct {
+	ID             int
+	IdempotencyKey string
+	FromAccount    int
+	// Total is the sum of the amounts, Fee the sum of the fees.
+	Total     money.Money
+	Fee       money.Money
+	Legs      []BatchLeg
+	CreatedAt time.Time
+	// Replayed is set when the batch was done already by an earlier request with the key.
+	Replayed bool
+}
+
+// batchLegJSON is how legs are stored in the batches table.
+type batchLegJSON struct {
+	ToAccount int   `json:"to_account"`
+	Amount    int64 `json:"amount"`
+	Fee       int64 `json:"fee,omitempty"`
+}
+
+// BatchError lists the legs that made a batch fail validation, keyed by the leg index.
+type BatchError struct {
+	Legs map[int]string
+	// Err is set when the batch fails as a whole, eg. the balance is not sufficient.
+	Err error
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BatchError) Error() string {
+	var s []string
+	if e.Err != nil {
+		s = append(s, e.Err.Error())
+	}
+	idx := make([]int, 0, len(e.Legs))
+	for i := range e.Legs {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	for _, i := range idx {
+		s = append(s, fmt.Sprintf("leg %d: %s", i, e.Legs[i]))
+	}
+	return "batch rejected: " + strings.Join(s, "; ")
+}
+
+// errBatchDone aborts the transaction of a batch whose key was taken by a concurrent request.
+var errBatchDone = errors.New("batch already done")
+
+// BatchByKey returns the completed batch the account paid with the idempotency key, nil if
+// there is none. Keys are scoped to the paying account.
+func (d *DB) BatchByKey(fromAccount int, key string) (*Batch, error) {
+	row := d.db.QueryRow(`SELECT id, idempotency_key, from_account, total, legs, created_at FROM batches
+		WHERE from_account=$1 AND idempotency_key=$2`, fromAccount, key)
+	var b Batch
+	var legs string
+	err := row.Scan(&b.ID, &b.IdempotencyKey, &b.FromAccount, &b.Total, &legs, &b.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "query batch")
+	}
+	var ls []batchLegJSON
+	if err := json.Unmarshal([]byte(legs), &ls); err != nil {
+		return nil, errors.Wrap(err, "decode legs")
+	}
+	for _, l := range ls {
+		b.Legs = append(b.Legs, BatchLeg{ToAccount: l.ToAccount, Amount: money.Money(l.Amount), Fee: money.Money(l.Fee)})
+		//the fees were paid out of one balance, their sum fits
+		b.Fee += money.Money(l.Fee)
+	}
+	return &b, nil
+}
+
+// BatchTransfer pays every leg from one account, all or nothing, inside one transaction.
+// The fees of the legs are paid to the fee account in the same transaction, the balance has
+// to cover the total and the fees. A batch is identified by its idempotency key: sending the
+// same batch, fees included, again returns the batch already done, reusing the key for a
+// different batch is an error.
+func (d *DB) BatchTransfer(key string, fromAccount int, legs []BatchLeg) (*Batch, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, errors.Errorf("idempotency key is required")
+	}
+	if len(legs) == 0 || len(legs) > MaxBatchLegs {
+		return nil, errors.Errorf("batch should have between 1 and %d legs, got %d", MaxBatchLegs, len(legs))
+	}
+	hash := batchHash(fromAccount, legs)
+
+	if b, err := d.batchReplay(fromAccount, key, hash); b != nil || err != nil {
+		return b, err
+	}
+
+	from, fromUser, err := d.accountOwner(fromAccount)
+	if err != nil {
+		return nil, errors.Wrap(err, "from account")
+	}
+	if err := fromUser.canSend(); err != nil {
+		return nil, err
+	}
+
+	berr := &BatchError{Legs: map[int]string{}}
+	var total, fee money.Money
+	//an account can appear in several legs, sum them up before updating its balance
+	credits := map[int]money.Money{}
+	accounts := map[int]*Account{}
+	var order []int
+	for i, l := range legs {
+		if l.Amount.Sign() <= 0 {
+			berr.Legs[i] = "amount should be positive"
+			continue
+		}
+		if l.ToAccount == fromAccount {
+			berr.Legs[i] = "cannot transfer to the same account"
+			continue
+		}
+		to, ok := accounts[l.ToAccount]
+		if !ok {
+			a, u, err := d.accountOwner(l.ToAccount)
+			if err != nil {
+				berr.Legs[i] = err.Error()
+				continue
+			}
+			if err := u.canReceive(); err != nil {
+				berr.Legs[i] = err.Error()
+				continue
+			}
+			to = a
+			accounts[a.ID] = a
+			order = append(order, a.ID)
+		}
+		credit, err := credits[to.ID].Add(l.Amount)
+		if err != nil {
+			berr.Legs[i] = err.Error()
+			continue
+		}
+		credits[to.ID] = credit
+		if err := checkFee(l.Fee); err != nil {
+			berr.Legs[i] = err.Error()
+			continue
+		}
+		if total, err = total.Add(l.Amount); err != nil {
+			berr.Legs[i] = err.Error()
+			continue
+		}
+		if fee, err = fee.Add(l.Fee); err != nil {
+			berr.Legs[i] = err.Error()
+		}
+	}
+	debit, err := total.Add(fee)
+	if err != nil && len(berr.Legs) == 0 {
+		berr.Err = errors.Wrap(err, "batch total and fees")
+	}
+	if len(berr.Legs) > 0 || berr.Err != nil {
+		return nil, berr
+	}
+
+	stored := make([]batchLegJSON, 0, len(legs))
+	for _, l := range legs {
+		stored = append(stored, batchLegJSON{ToAccount: l.ToAccount, Amount: int64(l.Amount), Fee: int64(l.Fee)})
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode legs")
+	}
+
+	//the balances are checked and updated in place, so concurrent changes are not lost. They
+	//are kept as before the batch, for the events to tell the balances right after each leg.
+	var fromBalance, paid money.Money
+	balances := map[int]money.Money{}
+	statements := []Statement{
+		{exec: func(tx *sql.Tx) error {
+			//a concurrent request with the same key may have done the batch meanwhile
+			res, err := tx.Exec(`INSERT INTO batches (idempotency_key, request_hash, from_account, total, legs, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (from_account, idempotency_key) DO NOTHING`,
+				key, hash, fromAccount, total, string(data), now())
+			if err != nil {
+				return errors.Wrap(err, "insert batch")
+			}
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				return errBatchDone
+			}
+			return nil
+		}},
+		d.statusCheck(from.UserID, (*User).canSend),
+		{exec: func(tx *sql.Tx) error {
+			var err error
+			paid, err = debitBalance(tx, fromAccount, debit)
+			if errors.Is(err, ErrInsufficientFunds) {
+				return &BatchError{Legs: map[int]string{}, Err: errors.Wrapf(err, "batch total %s and fees %s", total, fee)}
+			}
+			fromBalance = paid + debit
+			return err
+		}, users: []int{from.UserID}},
+	}
+	for _, id := range order {
+		statements = append(statements, d.statusCheck(accounts[id].UserID, (*User).canReceive))
+	}
+	for _, id := range order {
+		statements = append(statements, Statement{exec: func(tx *sql.Tx) error {
+			b, err := addBalance(tx, id, credits[id])
+			if err != nil {
+				return err
+			}
+			balances[id] = b - credits[id]
+			return nil
+		}, users: []int{accounts[id].UserID}})
+	}
+	for _, l := range legs {
+		to := accounts[l.ToAccount]
+		record, entry := recordStatement(from, to, l.Amount)
+		statements = append(statements, record, Statement{exec: func(tx *sql.Tx) error {
+			fromBalance -= l.Amount
+			balances[to.ID] += l.Amount
+			return transferStatement(from, to, l.Amount, fromBalance, balances[to.ID], entry).exec(tx)
+		}})
+	}
+	if fee.Sign() > 0 {
+		feeStatements, err := d.feeStatements(from, fee, &paid)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, feeStatements...)
+	}
+
+	err = d.transaction(statements)
+	if errors.Is(err, errBatchDone) {
+		return d.batchReplay(fromAccount, key, hash)
+	}
+	if err != nil {
+		var berr *BatchError
+		if errors.As(err, &berr) {
+			return nil, berr
+		}
+		return nil, errors.Wrap(err, "transaction")
+	}
+	return d.BatchByKey(fromAccount, key)
+}
+
+// batchReplay returns the batch already done with the key, making sure it is the same batch.
+func (d *DB) batchReplay(fromAccount int, key, hash string) (*Batch, error) {
+	var stored string
+	err := d.db.QueryRow("SELECT request_hash FROM batches WHERE from_account=$1 AND idempotency_key=$2",
+		fromAccount, key).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "query batch")
+	}
+	if stored != hash {
+		return nil, errors.Errorf("idempotency key %s is already used by a different batch", key)
+	}
+	b, err := d.BatchByKey(fromAccount, key)
+	if b != nil {
+		b.Replayed = true
+	}
+	return b, err
+}
+
+func batchHash(fromAccount int, legs []BatchLeg) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d", fromAccount)
+	for _, l := range legs {
+		fmt.Fprintf(h, "|%d:%s:%s", l.ToAccount, l.Amount.Rat().RatString(), l.Fee.Rat().RatString())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
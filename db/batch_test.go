@@ -0,0 +1,157 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_BatchTransfer(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	payer, _ := db.AddUser("payer", money.MustParse("100"))
+	u1, _ := db.AddUser("test1", money.MustParse("0"))
+	u2, _ := db.AddUser("test2", money.MustParse("0"))
+
+	legs := []BatchLeg{
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("10")},
+		{ToAccount: u2.MainAccount, Amount: money.MustParse("20")},
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("5")},
+	}
+	b, err := db.BatchTransfer("payroll-1", payer.MainAccount, legs)
+	assert.Nil(t, err)
+	assert.Equal(t, "35.00", b.Total.String())
+	assert.Equal(t, 3, len(b.Legs))
+	assert.False(t, b.Replayed)
+
+	u, _ := db.GetUser(payer.ID)
+	assert.Equal(t, "65.00", u.Balance.String())
+	u, _ = db.GetUser(u1.ID)
+	assert.Equal(t, "15.00", u.Balance.String())
+	u, _ = db.GetUser(u2.ID)
+	assert.Equal(t, "20.00", u.Balance.String())
+	records, _ := db.UserRecords(payer.ID)
+	assert.Equal(t, 3, len(records))
+
+	//same key, same batch: nothing moves again
+	b1, err := db.BatchTransfer("payroll-1", payer.MainAccount, legs)
+	assert.Nil(t, err)
+	assert.Equal(t, b.ID, b1.ID)
+	assert.True(t, b1.Replayed)
+	u, _ = db.GetUser(payer.ID)
+	assert.Equal(t, "65.00", u.Balance.String())
+
+	//same key, different batch
+	_, err = db.BatchTransfer("payroll-1", payer.MainAccount, legs[:1])
+	assert.NotNil(t, err)
+
+	//keys are scoped to the payer
+	b2, err := db.BatchTransfer("payroll-1", u1.MainAccount, []BatchLeg{{ToAccount: u2.MainAccount, Amount: money.MustParse("5")}})
+	assert.Nil(t, err)
+	assert.NotEqual(t, b.ID, b2.ID)
+	assert.False(t, b2.Replayed)
+	u, _ = db.GetUser(u1.ID)
+	assert.Equal(t, "10.00", u.Balance.String())
+}
+
+func TestDB_BatchTransferRejected(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	payer, _ := db.AddUser("payer", money.MustParse("100"))
+	u1, _ := db.AddUser("test1", money.MustParse("0"))
+
+	_, err = db.BatchTransfer("", payer.MainAccount, []BatchLeg{{ToAccount: u1.MainAccount, Amount: money.MustParse("1")}})
+	assert.NotNil(t, err)
+	_, err = db.BatchTransfer("k", payer.MainAccount, nil)
+	assert.NotNil(t, err)
+	_, err = db.BatchTransfer("k", payer.MainAccount, make([]BatchLeg, MaxBatchLegs+1))
+	assert.NotNil(t, err)
+	_, err = db.BatchTransfer("k", 9999, []BatchLeg{{ToAccount: u1.MainAccount, Amount: money.MustParse("1")}})
+	assert.NotNil(t, err)
+
+	_, err = db.BatchTransfer("k", payer.MainAccount, []BatchLeg{
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("1")},
+		{ToAccount: 9999, Amount: money.MustParse("1")},
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("-1")},
+		{ToAccount: payer.MainAccount, Amount: money.MustParse("1")},
+	})
+	berr, ok := err.(*BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, 3, len(berr.Legs))
+	assert.NotContains(t, berr.Legs, 0)
+	assert.Contains(t, berr.Error(), "leg 1:")
+
+	//total is not sufficient
+	_, err = db.BatchTransfer("k", payer.MainAccount, []BatchLeg{
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("60")},
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("60")},
+	})
+	berr, ok = err.(*BatchError)
+	assert.True(t, ok)
+	assert.True(t, errors.Is(berr.Err, ErrInsufficientFunds))
+
+	//nothing moved, and the key is still free
+	u, _ := db.GetUser(payer.ID)
+	assert.Equal(t, "100.00", u.Balance.String())
+	b, err := db.BatchByKey(payer.MainAccount, "k")
+	assert.Nil(t, err)
+	assert.Nil(t, b)
+}
+
+func TestDB_BatchTransferWithFee(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	payer, _ := db.AddUser("payer", money.MustParse("100"))
+	u1, _ := db.AddUser("test1", money.MustParse("0"))
+	u2, _ := db.AddUser("test2", money.MustParse("0"))
+
+	//the fees count against the balance
+	_, err = db.BatchTransfer("k", payer.MainAccount, []BatchLeg{
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("60"), Fee: money.MustParse("0.60")},
+		{ToAccount: u2.MainAccount, Amount: money.MustParse("40"), Fee: money.MustParse("0.40")},
+	})
+	assert.True(t, errors.Is(err, ErrInsufficientFunds))
+	_, err = db.BatchTransfer("k", payer.MainAccount, []BatchLeg{
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("1"), Fee: money.MustParse("-1")},
+	})
+	assert.NotNil(t, err)
+
+	b, err := db.BatchTransfer("k", payer.MainAccount, []BatchLeg{
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("60"), Fee: money.MustParse("0.60")},
+		{ToAccount: u2.MainAccount, Amount: money.MustParse("30"), Fee: money.MustParse("0.30")},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "90.00", b.Total.String())
+	assert.Equal(t, "0.90", b.Fee.String())
+	u, _ := db.GetUser(payer.ID)
+	assert.Equal(t, "9.10", u.Balance.String())
+	fees, err := db.FeeAccount()
+	assert.Nil(t, err)
+	assert.Equal(t, "0.90", fees.Balance.String())
+
+	//the fee is a record of its own
+	records, _ := db.UserRecords(payer.ID)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, fees.ID, records[2].ToAccount)
+
+	//the same batch charged other fees is a different batch
+	_, err = db.BatchTransfer("k", payer.MainAccount, []BatchLeg{
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("60")},
+		{ToAccount: u2.MainAccount, Amount: money.MustParse("30")},
+	})
+	assert.NotNil(t, err)
+
+	b, err = db.BatchByKey(payer.MainAccount, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.90", b.Fee.String())
+	assert.Equal(t, "0.60", b.Legs[0].Fee.String())
+
+	r, err := db.Reconcile()
+	assert.Nil(t, err)
+	assert.True(t, r.OK)
+}
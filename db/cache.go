@@ -0,0 +1,254 @@
+package db
+
+import (
+	"code_challenge1/log"
+	"database/sql"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Defaults of the user cache, USER_CACHE_SIZE and USER_CACHE_TTL override them. A size of
+// 0 disables the cache.
+const (
+	DefaultUserCacheSize = 10000
+	DefaultUserCacheTTL  = time.Minute
+)
+
+// userChannel is the postgres channel the ids of changed users are notified on.
+const userChannel = "user_changed"
+
+// listenerPingInterval is how often the listener connection is checked while it is idle.
+const listenerPingInterval = 90 * time.Second
+
+// CacheStats are the counters of the user cache.
+type CacheStats struct {
+	Enabled bool
+	// Active is false while changes of other instances may be missed, the cache is then
+	// bypassed.
+	Active        bool
+	Size          int
+	Hits          int64
+	Misses        int64
+	Invalidations int64
+}
+
+// userCache keeps GetUser results. Entries are dropped when the user changes, here or in
+// another instance, and expire after the ttl in case the database is changed by hand.
+type userCache struct {
+	max int
+	ttl time.Duration
+
+	mu    sync.Mutex
+	users map[int]cachedUser
+	// gen counts the invalidations, a result read before one is not cached.
+	gen    uint64
+	active bool
+
+	hits, misses, invalidations atomic.Int64
+}
+
+type cachedUser struct {
+	u  User
+	at time.Time
+}
+
+// newUserCache reads USER_CACHE_SIZE and USER_CACHE_TTL, nil when the cache is disabled.
+func newUserCache() (*userCache, error) {
+	size, err := envInt("USER_CACHE_SIZE", DefaultUserCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := envDuration("USER_CACHE_TTL", DefaultUserCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || ttl == 0 {
+		return nil, nil
+	}
+	return &userCache{max: size, ttl: ttl, users: map[int]cachedUser{}, active: true}, nil
+}
+
+// get returns a copy of the cached user, and the generation to put a user read on a miss with.
+func (c *userCache) get(id int) (*User, uint64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.users[id]
+	if ok && c.active && time.Since(e.at) < c.ttl {
+		c.hits.Add(1)
+		return e.u.clone(), c.gen, true
+	}
+	c.misses.Add(1)
+	return nil, c.gen, false
+}
+
+// put caches the user read at generation gen, unless it changed since.
+func (c *userCache) put(u *User, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen || !c.active {
+		return
+	}
+	if _, ok := c.users[u.ID]; !ok && len(c.users) >= c.max {
+		//make room by dropping any entry, the expired ones first
+		for id, e := range c.users {
+			if time.Since(e.at) >= c.ttl {
+				delete(c.users, id)
+			}
+		}
+		for id := range c.users {
+			if len(c.users) < c.max {
+				break
+			}
+			delete(c.users, id)
+		}
+	}
+	c.users[u.ID] = cachedUser{u: *u.clone(), at: time.Now()}
+}
+
+func (c *userCache) invalidate(ids ...int) {
+	if c == nil || len(ids) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, id := range ids {
+		delete(c.users, id)
+	}
+	c.invalidations.Add(int64(len(ids)))
+}
+
+// setActive turns the cache on or off, dropping every entry.
+func (c *userCache) setActive(active bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.users = map[int]cachedUser{}
+	c.active = active
+}
+
+func (c *userCache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Enabled:       true,
+		Active:        c.active,
+		Size:          len(c.users),
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.Metadata = make(map[string]string, len(u.Metadata))
+	for k, v := range u.Metadata {
+		c.Metadata[k] = v
+	}
+	return &c
+}
+
+// CacheStats returns the counters of the user cache, all zero when it is disabled.
+func (d *DB) CacheStats() CacheStats {
+	return d.cache.stats()
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// notifyUsers tells the other instances that the users changed. Sent in a transaction the
+// notifications go out on commit only.
+func (d *DB) notifyUsers(e execer, ids []int) error {
+	if !d.notify {
+		return nil
+	}
+	for _, id := range ids {
+		if _, err := e.Exec("SELECT pg_notify($1, $2)", userChannel, strconv.Itoa(id)); err != nil {
+			return errors.Wrap(err, "notify user changed")
+		}
+	}
+	return nil
+}
+
+// usersChanged notifies and invalidates the users changed by statements already committed.
+func (d *DB) usersChanged(ids ...int) error {
+	d.cache.invalidate(ids...)
+	return d.notifyUsers(d.db, ids)
+}
+
+// listenUsers invalidates the users other instances change. Until the listener is
+// connected changes may be missed, so the cache is off until then and while it reconnects.
+func (d *DB) listenUsers(conninfo string) {
+	d.cache.setActive(false)
+	l := pq.NewListener(conninfo, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			log.Warnf("user cache listener disconnected, cache is off until it reconnects: %v", err)
+			d.cache.setActive(false)
+		case pq.ListenerEventReconnected:
+			log.Infof("user cache listener reconnected")
+			d.cache.setActive(true)
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Warnf("user cache listener cannot connect: %v", err)
+		}
+	})
+	d.listener, d.stop, d.done = l, make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(d.done)
+		//blocks until connected, or the listener is closed
+		if err := l.Listen(userChannel); err != nil {
+			select {
+			case <-d.stop:
+			default:
+				log.Errorf("user cache listener cannot listen, cache stays off: %v", err)
+				_ = l.Close()
+			}
+			return
+		}
+		d.cache.setActive(true)
+		t := time.NewTicker(listenerPingInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case n, ok := <-l.Notify:
+				//closed with the listener
+				if !ok {
+					return
+				}
+				//nil after reconnecting, handled by the event callback
+				if n == nil {
+					continue
+				}
+				id, err := strconv.Atoi(n.Extra)
+				if err != nil {
+					log.Warnf("user changed notification not valid: %q", n.Extra)
+					continue
+				}
+				d.cache.invalidate(id)
+			case <-t.C:
+				_ = l.Ping()
+			}
+		}
+	}()
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_UserCache(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u1, _ := d.AddUser("test1", money.MustParse("100"))
+	u2, _ := d.AddUser("test2", money.MustParse("100"))
+
+	_, _ = d.GetUser(u1.ID)
+	u, err := d.GetUser(u1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "100.00", u.Balance.String())
+	s := d.CacheStats()
+	assert.True(t, s.Enabled)
+	assert.Equal(t, int64(1), s.Hits)
+	assert.Equal(t, 1, s.Size)
+
+	//a copy is returned
+	u.Metadata["k"] = "v"
+	u, _ = d.GetUser(u1.ID)
+	assert.Empty(t, u.Metadata)
+
+	//every change is seen right after it commits
+	_ = d.Transfer(u1.ID, u2.ID, money.MustParse("10"))
+	u, _ = d.GetUser(u1.ID)
+	assert.Equal(t, "90.00", u.Balance.String())
+	_, _ = d.GetUser(u2.ID)
+	_, _ = d.WithdrawOrDeposit(u2.ID, money.MustParse("1"))
+	u, _ = d.GetUser(u2.ID)
+	assert.Equal(t, "111.00", u.Balance.String())
+	_ = d.TransferWithFee(u1.ID, u2.ID, money.MustParse("1"), money.MustParse("1"))
+	fees, _ := d.FeeAccount()
+	u, _ = d.GetUser(fees.UserID)
+	assert.Equal(t, "1.00", u.Balance.String())
+	_ = d.TransferWithFee(u1.ID, u2.ID, money.MustParse("1"), money.MustParse("1"))
+	u, _ = d.GetUser(fees.UserID)
+	assert.Equal(t, "2.00", u.Balance.String())
+	u, _ = d.RenameUser(u1.ID, "test3")
+	assert.Equal(t, "test3", u.Name)
+	u, _ = d.UpdateUserMetadata(u1.ID, map[string]string{"k": "v"})
+	assert.Equal(t, "v", u.Metadata["k"])
+	u, _ = d.SetUserTier(u1.ID, "gold")
+	assert.Equal(t, "gold", u.Tier)
+	u, _ = d.SetUserStatus(u1.ID, StatusFrozen, "ops", "test")
+	assert.Equal(t, StatusFrozen, u.Status)
+	assert.True(t, d.CacheStats().Invalidations > 0)
+
+	//changes made around the db layer are only seen once the entry expires
+	_, err = d.db.Exec("UPDATE accounts SET balance=$1 WHERE id=$2", 0, u1.MainAccount)
+	assert.Nil(t, err)
+	u, _ = d.GetUser(u1.ID)
+	assert.Equal(t, "86.00", u.Balance.String())
+	d.cache.ttl = 0
+	u, _ = d.GetUser(u1.ID)
+	assert.Equal(t, "0.00", u.Balance.String())
+}
+
+func TestUserCache(t *testing.T) {
+	c := &userCache{max: 2, ttl: time.Minute, users: map[int]cachedUser{}, active: true}
+
+	//a user read before an invalidation is not cached
+	_, gen, ok := c.get(1)
+	assert.False(t, ok)
+	c.invalidate(1)
+	c.put(&User{ID: 1}, gen)
+	_, _, ok = c.get(1)
+	assert.False(t, ok)
+
+	for id := 1; id <= 3; id++ {
+		_, gen, _ = c.get(id)
+		c.put(&User{ID: id}, gen)
+	}
+	assert.Equal(t, 2, c.stats().Size)
+	_, _, ok = c.get(3)
+	assert.True(t, ok)
+
+	c.setActive(false)
+	_, gen, _ = c.get(3)
+	c.put(&User{ID: 3}, gen)
+	assert.Equal(t, 0, c.stats().Size)
+	assert.False(t, c.stats().Active)
+}
+
+func TestDB_UserCacheDisabled(t *testing.T) {
+	setupDbTest()
+	os.Setenv("USER_CACHE_SIZE", "0")
+	defer os.Unsetenv("USER_CACHE_SIZE")
+	d, err := Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	_, _ = d.GetUser(u.ID)
+	_, _ = d.GetUser(u.ID)
+	assert.Equal(t, CacheStats{}, d.CacheStats())
+
+	os.Setenv("USER_CACHE_TTL", "1")
+	defer os.Unsetenv("USER_CACHE_TTL")
+	_, err = Open()
+	assert.NotNil(t, err)
+}
+
+func TestDB_Close(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+
+	//the listener never connects, Close still ends it
+	d.listenUsers("host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	assert.False(t, d.CacheStats().Active)
+	assert.Nil(t, d.Close())
+	_, err = d.GetUser(1)
+	assert.NotNil(t, err)
+}
@@ -2,89 +2,232 @@ package db
 
 import (
 	"code_challenge1/log"
+	"code_challenge1/money"
 	"context"
 	"database/sql"
 	_ "embed"
-	"math/big"
 	"os"
 	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	_ "github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
 	"github.com/pkg/errors"
 )
 
-const CurrencyDecimal = 2
+const CurrencyDecimal = money.Decimals
+
+// CurrencyCode is the ISO 4217 code of the money handled, used in exports.
+const CurrencyCode = "USD"
 
 //go:embed schema.sql
 var Schema string
 
+// SqliteSchema is the sqlite flavour of Schema, used by tests running with TEST_ENV.
+//
+//go:embed schema_sqlite.sql
+var SqliteSchema string
+
 type User struct {
-	ID      int
-	Name    string
-	Balance *big.Rat
+	ID     int
+	Name   string
+	Status string
+	// Tier is the fee tier of the user.
+	Tier string
+	// Metadata are free form attributes of the user.
+	Metadata map[string]string
+	// MainAccount and Balance are of the user's main account, which the endpoints
+	// addressing users instead of accounts work on.
+	MainAccount int
+	Balance     money.Money
 }
 
 type Record struct {
-	ID       int
-	FromUser int
-	ToUser   int
-	Amount   *big.Rat
+	ID          int
+	FromUser    int
+	ToUser      int
+	FromAccount int
+	ToAccount   int
+	Amount      money.Money
+	CreatedAt   time.Time
 }
 
 func Open() (*DB, error) {
 	connectInfo := os.Getenv("DB_CONNECT_INFO")
+	pool, err := LoadPoolConfig()
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := envInt("DB_CONNECT_ATTEMPTS", DefaultConnectAttempts)
+	if err != nil {
+		return nil, err
+	}
 
-	return open(connectInfo)
-
+	d, err := open(connectInfo, pool, attempts)
+	if err != nil {
+		return nil, err
+	}
+	d.replica, err = openReplica(pool)
+	if err != nil {
+		_ = d.db.Close()
+		return nil, err
+	}
+	d.cache, err = newUserCache()
+	if err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	if d.cache != nil && d.notify {
+		d.listenUsers(connectInfo)
+	}
+	return d, nil
 }
 
-func open(conninfo string) (*DB, error) {
+// open connects to the database, trying up to attempts times, and creates the schema.
+func open(conninfo string, pool PoolConfig, attempts int) (*DB, error) {
 	log.Debugf("connect string: %s", conninfo)
 	var db *sql.DB
 	var err error
 	if os.Getenv("TEST_ENV") == "true" { //for testing purpose
 		db, err = sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			return nil, errors.Wrap(err, "open db")
+		}
+		//every connection to :memory: is a new database, so stick to one and keep it
+		db.SetMaxOpenConns(1)
 	} else {
 		db, err = sql.Open("postgres", conninfo)
+		if err != nil {
+			return nil, errors.Wrap(err, "open db")
+		}
+		pool.apply(db)
 	}
-	if err != nil {
-		return nil, errors.Wrap(err, "open db")
+	if err := connect(db, attempts); err != nil {
+		_ = db.Close()
+		return nil, err
 	}
 	_, err = db.Exec(Schema)
 	if err != nil {
 		return nil, errors.Wrap(err, "create schema")
 	}
+	//sqlite only runs in one process, there is no one to notify. Its transactions are
+	//serializable, and so consistent snapshots already.
+	d := &DB{db: db, notify: os.Getenv("TEST_ENV") != "true"}
+	if d.notify {
+		d.snapshot = snapshotTx
+		d.rowLocks = true
+	}
+	n, err := d.sealRecords()
+	if err != nil {
+		return nil, errors.Wrap(err, "seal records")
+	}
+	if n > 0 {
+		log.Infof("added %d existing records to the audit chain", n)
+	}
 	log.Infof("open database success!")
-	return &DB{db: db}, nil
+	return d, nil
 }
 
+// Close stops listening to the users other instances change and closes the connections to
+// the database and its replica.
+func (d *DB) Close() error {
+	if d.listener != nil {
+		close(d.stop)
+		//closed already when it could not listen
+		_ = d.listener.Close()
+		<-d.done
+	}
+	if d.replica != nil {
+		if err := d.replica.db.Close(); err != nil {
+			log.Warnf("close replica: %v", err)
+		}
+	}
+	return errors.Wrap(d.db.Close(), "close db")
+}
+
+// snapshotTx reads one point in time on postgres.
+var snapshotTx = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
 type DB struct {
 	db *sql.DB
+	// replica serves the reads of Eventual views, nil without one.
+	replica *replica
+	// cache keeps GetUser results, nil when disabled. notify is whether changed users are
+	// notified to other instances.
+	cache  *userCache
+	notify bool
+	// listener receives the users other instances change, nil when not listening. stop is
+	// closed by Close to end listenUsers, which closes done once it returned.
+	listener   *pq.Listener
+	stop, done chan struct{}
+	// snapshot are the options of transactions reading one point in time.
+	snapshot *sql.TxOptions
+	// rowLocks is whether reads can lock the rows they read, sqlite has no row locks as it
+	// runs one transaction at a time.
+	rowLocks bool
 }
 
-func (d *DB) AddUser(name string, balance *big.Rat) (*User, error) {
-	b := balanceToInt(balance)
+// lock returns the locking clause, eg. " FOR UPDATE", when reads can lock rows.
+func (d *DB) lock(clause string) string {
+	if !d.rowLocks {
+		return ""
+	}
+	return clause
+}
+
+// AddUser creates the user with its main account holding the balance, which should not be
+// negative. Names are checked by CheckUserName, the system users are added by addUser.
+func (d *DB) AddUser(name string, balance money.Money) (*User, error) {
+	if err := CheckUserName(name); err != nil {
+		return nil, err
+	}
+	if err := checkOpeningBalance(balance); err != nil {
+		return nil, err
+	}
+	return d.addUser(name, balance)
+}
+
+func checkOpeningBalance(balance money.Money) error {
+	if balance.Sign() < 0 {
+		return errors.Errorf("balance should not be negative: %s", balance)
+	}
+	return nil
+}
+
+func (d *DB) addUser(name string, balance money.Money) (*User, error) {
 	tx, err := d.db.BeginTx(context.Background(), nil)
 	if err != nil {
 		return nil, err
 	}
-	_, err = tx.Exec("INSERT INTO users(name, balance) VALUES ($1, $2)", name, b)
+	_, err = tx.Exec("INSERT INTO users(name) VALUES ($1)", name)
 	if err != nil {
 		_ = tx.Rollback()
 		return nil, errors.Wrap(err, "add user")
 	}
-	row := tx.QueryRow("SELECT * FROM users WHERE name=$1", name)
+	row := tx.QueryRow("SELECT id, name, status, tier FROM users WHERE name=$1", name)
 	var u User
-	var b1 int64
-	err = row.Scan(&u.ID, &u.Name, &b1)
+	err = row.Scan(&u.ID, &u.Name, &u.Status, &u.Tier)
 	if err != nil {
 		_ = tx.Rollback()
 		return nil, errors.Wrap(err, "query user")
 	}
 	u.Name = strings.TrimSpace(u.Name)
-	u.Balance = IntToBalance(b1)
+	u.Balance = balance
+	u.Metadata = map[string]string{}
+
+	err = tx.QueryRow(`INSERT INTO accounts (user_id, name, balance, opening_balance, created_at)
+		VALUES ($1, $2, $3, $3, $4) RETURNING id`, u.ID, DefaultAccount, balance, now()).Scan(&u.MainAccount)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors.Wrap(err, "add account")
+	}
+	err = insertEvent(tx, EventUserCreated, UserCreated{UserID: u.ID, Name: u.Name, AccountID: u.MainAccount,
+		Balance: u.Balance.String()})
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -95,46 +238,92 @@ func (d *DB) AddUser(name string, balance *big.Rat) (*User, error) {
 	return &u, nil
 }
 
+type NewUser struct {
+	Name    string
+	Balance money.Money
+}
+
+// AddUsers creates all the users with their main account in one transaction, none when a
+// name does not pass CheckUserName or a balance is negative.
+func (d *DB) AddUsers(users []NewUser) error {
+	for _, u := range users {
+		if err := CheckUserName(u.Name); err != nil {
+			return err
+		}
+		if err := checkOpeningBalance(u.Balance); err != nil {
+			return errors.Wrapf(err, "user %s", u.Name)
+		}
+	}
+	statements := make([]Statement, 0, 3*len(users))
+	for _, u := range users {
+		statements = append(statements, Statement{
+			S:    "INSERT INTO users(name) VALUES ($1)",
+			Args: []interface{}{u.Name},
+		}, Statement{
+			S: `INSERT INTO accounts (user_id, name, balance, opening_balance, created_at)
+				SELECT id, $1, $2, $2, $3 FROM users WHERE name=$4`,
+			Args: []interface{}{DefaultAccount, u.Balance, now(), u.Name},
+		}, eventStatement(EventUserCreated, func(tx *sql.Tx) (interface{}, error) {
+			e := UserCreated{Name: u.Name, Balance: u.Balance.String()}
+			err := tx.QueryRow(`SELECT u.id, a.id FROM users u JOIN accounts a ON a.user_id=u.id
+				WHERE u.name=$1 AND a.name=$2`, u.Name, DefaultAccount).Scan(&e.UserID, &e.AccountID)
+			return e, err
+		}))
+	}
+	return d.transaction(statements)
+}
+
+// ExistingUserNames returns which of the names are already taken.
+func (d *DB) ExistingUserNames(names []string) (map[string]bool, error) {
+	res := map[string]bool{}
+	for _, name := range names {
+		var n int
+		if err := d.db.QueryRow("SELECT COUNT(*) FROM users WHERE name=$1", name).Scan(&n); err != nil {
+			return nil, errors.Wrap(err, "count users")
+		}
+		if n > 0 {
+			res[name] = true
+		}
+	}
+	return res, nil
+}
+
+// GetUser returns the user along with the balance of its main account.
+// Results may come from the user cache, changes made through DB are seen right after they
+// commit. Money movement reads the user from the database instead.
 func (d *DB) GetUser(id int) (*User, error) {
-	row := d.db.QueryRow("SELECT * FROM users WHERE id=$1", id)
-	var u User
-	var b1 int64
-	err := row.Scan(&u.ID, &u.Name, &b1)
+	u, gen, ok := d.cache.get(id)
+	if ok {
+		return u, nil
+	}
+	u, err := getUser(d.db, id)
 	if err != nil {
 		return nil, err
 	}
-	u.Name = strings.TrimSpace(u.Name)
-	u.Balance = IntToBalance(b1)
-	return &u, nil
+	d.cache.put(u, gen)
+	return u, nil
 }
 
-func (d *DB) WithdrawOrDeposit(id int, amount *big.Rat) (*User, error) {
-	if n, ok := amount.FloatPrec(); n > 2 || !ok {
-		return nil, errors.Errorf("amount should only have atmost 2 decimal number, eg. 10.02")
-	}
+func getUser(q querier, id int) (*User, error) {
+	row := q.QueryRow(`SELECT `+userSelectColumns+` FROM users u
+		JOIN accounts a ON a.user_id=u.id WHERE u.id=$1 AND a.name=$2`, id, DefaultAccount)
+	return scanUser(row)
+}
 
+// WithdrawOrDeposit changes the balance of the user's main account.
+func (d *DB) WithdrawOrDeposit(id int, amount money.Money) (*User, error) {
+	return d.WithdrawOrDepositWithFee(id, amount, 0)
+}
+
+// WithdrawOrDepositWithFee is WithdrawOrDeposit also charging the user the fee, see
+// AccountWithdrawOrDepositWithFee.
+func (d *DB) WithdrawOrDepositWithFee(id int, amount, fee money.Money) (*User, error) {
 	u, err := d.GetUser(id)
 	if err != nil {
 		return nil, errors.Wrap(err, "get user")
 	}
-	b1 := new(big.Rat).Add(u.Balance, amount)
-	if b1.Sign() < 0 {
-		return nil, errors.Errorf("cannot withdraw larger than balance, balance is: %v", u.Balance.FloatString(2))
-	}
-
-	b := balanceToInt(b1)
-	err = d.transaction([]Statement{
-		{
-			S:    "UPDATE users SET balance=$1 WHERE id=$2",
-			Args: []interface{}{b, id},
-		},
-		{
-			S:    "INSERT INTO records (from_user, to_user, amount) VALUES ($1, $1, $2)",
-			Args: []interface{}{id, balanceToInt(amount)},
-		},
-	})
-	if err != nil {
-		return nil, errors.Wrap(err, "transaction")
+	if _, err := d.AccountWithdrawOrDepositWithFee(u.MainAccount, amount, fee); err != nil {
+		return nil, err
 	}
 
 	u, err = d.GetUser(id)
@@ -146,33 +335,37 @@ func (d *DB) WithdrawOrDeposit(id int, amount *big.Rat) (*User, error) {
 }
 
 func (d *DB) UserRecords(userID int) ([]Record, error) {
+	return userRecords(d.db, userID)
+}
+
+func userRecords(q querier, userID int) ([]Record, error) {
 	var records []Record
 
-	rows, err := d.db.Query("SELECT * FROM records WHERE from_user=$1 OR to_user=$1", userID)
+	rows, err := q.Query(`SELECT id, from_user, to_user, from_account, to_account, amount, created_at FROM records
+		WHERE from_user=$1 OR to_user=$1 ORDER BY id`, userID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var his Record
-		var b int64
-		err = rows.Scan(&his.ID, &his.FromUser, &his.ToUser, &b)
+		err = rows.Scan(&his.ID, &his.FromUser, &his.ToUser, &his.FromAccount, &his.ToAccount, &his.Amount, &his.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
-		his.Amount = IntToBalance(b)
 
 		records = append(records, his)
 	}
 	return records, nil
 }
 
-func (d *DB) Transfer(fromId, toId int, amount *big.Rat) error {
-	if n, ok := amount.FloatPrec(); n > 2 || !ok {
-		return errors.Errorf("amount should only have atmost 2 decimal number, eg. 10.02")
-	}
-	if amount.Sign() < 0 {
-		return errors.Errorf("transfer amount should not be negtive: %v", amount.FloatString(2))
-	}
+// Transfer moves money between the main accounts of two users.
+func (d *DB) Transfer(fromId, toId int, amount money.Money) error {
+	return d.TransferWithFee(fromId, toId, amount, 0)
+}
+
+// TransferWithFee is Transfer also charging the sender the fee, see TransferAccountsWithFee.
+func (d *DB) TransferWithFee(fromId, toId int, amount, fee money.Money) error {
 	fromUser, err := d.GetUser(fromId)
 	if err != nil {
 		return errors.Wrap(err, "get from user")
@@ -181,38 +374,17 @@ func (d *DB) Transfer(fromId, toId int, amount *big.Rat) error {
 	if err != nil {
 		return errors.Wrap(err, "get to user")
 	}
-
-	newFromUserBalance := new(big.Rat).Sub(fromUser.Balance, amount)
-	if newFromUserBalance.Sign() < 0 {
-		return errors.Errorf("user balance is not sufficient")
-	}
-	newToUserBalance := new(big.Rat).Add(toUser.Balance, amount)
-
-	b := balanceToInt(amount)
-
-	err = d.transaction([]Statement{
-		{
-			S:    "UPDATE users SET balance=$1 WHERE id=$2",
-			Args: []interface{}{balanceToInt(newFromUserBalance), fromId},
-		},
-		{
-			S:    "UPDATE users SET balance=$1 WHERE id=$2",
-			Args: []interface{}{balanceToInt(newToUserBalance), toId},
-		},
-		{
-			S:    "INSERT INTO records (from_user, to_user, amount) VALUES ($1, $2, $3)",
-			Args: []interface{}{fromId, toId, b},
-		},
-	})
-	if err != nil {
-		return errors.Wrap(err, "transaction")
-	}
-	return nil
+	return d.TransferAccountsWithFee(fromUser.MainAccount, toUser.MainAccount, amount, fee)
 }
 
 type Statement struct {
 	S    string
 	Args []interface{}
+	// exec runs instead of S for statements that need to read inside the transaction, eg.
+	// ledger inserts chained to the audit chain head.
+	exec func(tx *sql.Tx) error
+	// users are the ids of the users the statement changes, see usersChanged.
+	users []int
 }
 
 func (d *DB) transaction(statements []Statement) error {
@@ -220,25 +392,39 @@ func (d *DB) transaction(statements []Statement) error {
 	if err != nil {
 		return errors.Wrap(err, "create tx")
 	}
+	var users []int
 	for _, statement := range statements {
-		_, err := tx.Exec(statement.S, statement.Args...)
+		if statement.exec != nil {
+			err = statement.exec(tx)
+		} else {
+			_, err = tx.Exec(statement.S, statement.Args...)
+		}
 		if err != nil {
 			_ = tx.Rollback()
 			return errors.Wrap(err, "exec statement")
 		}
+		users = append(users, statement.users...)
+	}
+	if err := d.notifyUsers(tx, users); err != nil {
+		_ = tx.Rollback()
+		return err
 	}
 	err = tx.Commit()
 	if err != nil {
 		_ = tx.Rollback()
 		return errors.Wrap(err, "commit tx")
 	}
+	d.cache.invalidate(users...)
 	return nil
 }
 
-func balanceToInt(b *big.Rat) int64 {
-	return new(big.Rat).Mul(b, big.NewRat(100, 1)).Num().Int64()
+// now returns the timestamp stored with new rows.
+func now() time.Time {
+	return dbTime(time.Now())
 }
 
-func IntToBalance(b int64) *big.Rat {
-	return big.NewRat(b, 100)
+// dbTime converts a time to how it is stored and compared in the database. It is truncated
+// to seconds so that timestamps compare the same way on postgres and sqlite.
+func dbTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
 }
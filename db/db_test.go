@@ -1,38 +1,17 @@
 package db
 
 import (
-	"math/big"
+	"code_challenge1/money"
 	"os"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestBalanceToInt(t *testing.T) {
-	b := big.NewRat(100, 1)
-	i := balanceToInt(b)
-	assert.Equal(t, int64(10000), i)
-}
-
 func setupDbTest() {
 	os.Setenv("TEST_ENV", "true")
-	s := `CREATE TABLE IF NOT EXISTS "users" (
-	"id" INTEGER NOT NULL UNIQUE ,
-	"name" CHAR(256) NOT NULL UNIQUE,
-	"balance" INTEGER NOT NULL,
-	PRIMARY KEY("id")
-);
-
-
-CREATE TABLE IF NOT EXISTS "records" (
-	"id" INTEGER NOT NULL UNIQUE,
-	"from_user" INTEGER NOT NULL,
-	"to_user" INTEGER NOT NULL,
-	"amount" INTEGER NOT NULL,
-	PRIMARY KEY("id")
-);
-`
-	Schema = s
+	Schema = SqliteSchema
 }
 
 func TestOpen(t *testing.T) {
@@ -49,16 +28,35 @@ func TestDB_AddUser(t *testing.T) {
 	setupDbTest()
 	db, err := Open()
 	assert.Nil(t, err)
-	u, err := db.AddUser("test1", big.NewRat(100, 1))
+	u, err := db.AddUser("test1", money.MustParse("100"))
 	assert.Nil(t, err)
 	assert.Equal(t, "test1", u.Name)
 }
 
+func TestDB_AddUsers(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	err = db.AddUsers([]NewUser{{Name: "test1", Balance: money.MustParse("10")}, {Name: "test2", Balance: money.MustParse("20")}})
+	assert.Nil(t, err)
+	u, err := db.GetUser(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "test2", u.Name)
+	assert.Equal(t, "20.00", u.Balance.String())
+
+	//all or nothing
+	err = db.AddUsers([]NewUser{{Name: "test3", Balance: money.MustParse("10")}, {Name: "test1", Balance: money.MustParse("20")}})
+	assert.NotNil(t, err)
+	existing, err := db.ExistingUserNames([]string{"test1", "test3"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]bool{"test1": true}, existing)
+}
+
 func TestDB_GetUser(t *testing.T) {
 	setupDbTest()
 	db, err := Open()
 	assert.Nil(t, err)
-	u, err := db.AddUser("test1", big.NewRat(100, 1))
+	u, err := db.AddUser("test1", money.MustParse("100"))
 	assert.Nil(t, err)
 	assert.Equal(t, "test1", u.Name)
 
@@ -74,21 +72,18 @@ func TestDB_WithdrawOrDeposit(t *testing.T) {
 	setupDbTest()
 	db, err := Open()
 	assert.Nil(t, err)
-	u, err := db.AddUser("test1", big.NewRat(100, 1))
+	u, err := db.AddUser("test1", money.MustParse("100"))
 	assert.Nil(t, err)
 	assert.Equal(t, "test1", u.Name)
-	u1, err := db.WithdrawOrDeposit(u.ID, big.NewRat(1, 1))
+	u1, err := db.WithdrawOrDeposit(u.ID, money.MustParse("1"))
 	assert.Nil(t, err)
-	assert.Equal(t, int64(101), u1.Balance.Num().Int64())
+	assert.Equal(t, money.MustParse("101"), u1.Balance)
 
-	_, err = db.WithdrawOrDeposit(u.ID, big.NewRat(1, 1000))
+	_, err = db.WithdrawOrDeposit(9999, money.MustParse("1"))
 	assert.NotNil(t, err)
 
-	_, err = db.WithdrawOrDeposit(9999, big.NewRat(1, 1))
-	assert.NotNil(t, err)
-
-	_, err = db.WithdrawOrDeposit(u.ID, big.NewRat(-1000, 1))
-	assert.NotNil(t, err)
+	_, err = db.WithdrawOrDeposit(u.ID, money.MustParse("-1000"))
+	assert.True(t, errors.Is(err, ErrInsufficientFunds))
 
 }
 
@@ -96,12 +91,12 @@ func TestDB_UserRecords(t *testing.T) {
 	setupDbTest()
 	db, err := Open()
 	assert.Nil(t, err)
-	u, err := db.AddUser("test1", big.NewRat(100, 1))
+	u, err := db.AddUser("test1", money.MustParse("100"))
 	assert.Nil(t, err)
 	assert.Equal(t, "test1", u.Name)
-	u1, err := db.WithdrawOrDeposit(u.ID, big.NewRat(1, 1))
+	u1, err := db.WithdrawOrDeposit(u.ID, money.MustParse("1"))
 	assert.Nil(t, err)
-	assert.Equal(t, int64(101), u1.Balance.Num().Int64())
+	assert.Equal(t, money.MustParse("101"), u1.Balance)
 	r, err := db.UserRecords(u.ID)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(r))
@@ -111,26 +106,25 @@ func TestDB_Transfer(t *testing.T) {
 	setupDbTest()
 	db, err := Open()
 	assert.Nil(t, err)
-	u1, err := db.AddUser("test1", big.NewRat(100, 1))
+	u1, err := db.AddUser("test1", money.MustParse("100"))
 	assert.Nil(t, err)
 	assert.Equal(t, "test1", u1.Name)
-	u2, err := db.AddUser("test2", big.NewRat(100, 1))
+	u2, err := db.AddUser("test2", money.MustParse("100"))
 	assert.Nil(t, err)
 	assert.Equal(t, "test2", u2.Name)
-	err = db.Transfer(u1.ID, u2.ID, big.NewRat(1, 1))
+	err = db.Transfer(u1.ID, u2.ID, money.MustParse("1"))
 	assert.Nil(t, err)
 
-	err = db.Transfer(u1.ID, u2.ID, big.NewRat(1, 1000))
-	assert.NotNil(t, err)
-
-	err = db.Transfer(u1.ID, u2.ID, big.NewRat(-1, 1))
-	assert.NotNil(t, err)
-	err = db.Transfer(u1.ID, u2.ID, big.NewRat(10000, 1))
+	err = db.Transfer(u1.ID, u2.ID, money.MustParse("-1"))
 	assert.NotNil(t, err)
+	err = db.Transfer(u1.ID, u2.ID, money.MustParse("10000"))
+	assert.True(t, errors.Is(err, ErrInsufficientFunds))
+	u, _ := db.GetUser(u1.ID)
+	assert.Equal(t, "99.00", u.Balance.String())
 
-	err = db.Transfer(9999, u2.ID, big.NewRat(1, 1))
+	err = db.Transfer(9999, u2.ID, money.MustParse("1"))
 	assert.NotNil(t, err)
-	err = db.Transfer(u1.ID, 9999, big.NewRat(1, 1))
+	err = db.Transfer(u1.ID, 9999, money.MustParse("1"))
 	assert.NotNil(t, err)
 
 }
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Domain events written to the outbox in the same transaction as the change they describe.
+const (
+	EventUserCreated       = "UserCreated"
+	EventFundsDeposited    = "FundsDeposited"
+	EventFundsWithdrawn    = "FundsWithdrawn"
+	EventTransferCompleted = "TransferCompleted"
+)
+
+type Event struct {
+	ID        int
+	Type      string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+type UserCreated struct {
+	UserID    int    `json:"user_id"`
+	Name      string `json:"name"`
+	AccountID int    `json:"account_id"`
+	Balance   string `json:"balance"`
+}
+
+// FundsMoved is the payload of deposits and withdraws, Amount is always positive.
+type FundsMoved struct {
+	RecordID  int    `json:"record_id"`
+	UserID    int    `json:"user_id"`
+	AccountID int    `json:"account_id"`
+	Amount    string `json:"amount"`
+	Balance   string `json:"balance"`
+}
+
+type TransferCompleted struct {
+	RecordID    int    `json:"record_id"`
+	FromUser    int    `json:"from_user"`
+	FromAccount int    `json:"from_account"`
+	ToUser      int    `json:"to_user"`
+	ToAccount   int    `json:"to_account"`
+	Amount      string `json:"amount"`
+	FromBalance string `json:"from_balance"`
+	ToBalance   string `json:"to_balance"`
+}
+
+func insertEvent(tx *sql.Tx, typ string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "encode event")
+	}
+	_, err = tx.Exec("INSERT INTO outbox_events (type, payload, created_at) VALUES ($1, $2, $3)", typ, string(data), now())
+	return errors.Wrapf(err, "insert %s event", typ)
+}
+
+// eventStatement writes the event to the outbox. The payload is made when the transaction
+// runs, so that it can read what the statements before it wrote, eg. a record id.
+func eventStatement(typ string, payload func(tx *sql.Tx) (interface{}, error)) Statement {
+	return Statement{exec: func(tx *sql.Tx) error {
+		p, err := payload(tx)
+		if err != nil {
+			return errors.Wrapf(err, "%s event", typ)
+		}
+		return insertEvent(tx, typ, p)
+	}}
+}
+
+// fundsMovedStatement writes the event of a deposit or withdraw recorded by the entry.
+func fundsMovedStatement(a *Account, amount, balance money.Money, record *chainEntry) Statement {
+	typ := EventFundsDeposited
+	if amount.Sign() < 0 {
+		typ = EventFundsWithdrawn
+	}
+	return eventStatement(typ, func(*sql.Tx) (interface{}, error) {
+		return FundsMoved{
+			RecordID:  record.id,
+			UserID:    a.UserID,
+			AccountID: a.ID,
+			Amount:    amount.Abs().String(),
+			Balance:   balance.String(),
+		}, nil
+	})
+}
+
+// transferStatement writes the event of a transfer recorded by the entry.
+func transferStatement(from, to *Account, amount, fromBalance, toBalance money.Money, record *chainEntry) Statement {
+	return eventStatement(EventTransferCompleted, func(*sql.Tx) (interface{}, error) {
+		return TransferCompleted{
+			RecordID:    record.id,
+			FromUser:    from.UserID,
+			FromAccount: from.ID,
+			ToUser:      to.UserID,
+			ToAccount:   to.ID,
+			Amount:      amount.String(),
+			FromBalance: fromBalance.String(),
+			ToBalance:   toBalance.String(),
+		}, nil
+	})
+}
+
+// PendingEvents returns up to limit events of the outbox not sent yet, oldest first.
+func (d *DB) PendingEvents(limit int) ([]Event, error) {
+	return d.queryEvents("SELECT id, type, payload, created_at FROM outbox_events WHERE sent_at IS NULL ORDER BY id LIMIT $1", limit)
+}
+
+func (d *DB) queryEvents(q string, args ...interface{}) ([]Event, error) {
+	rows, err := d.db.Query(q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query events")
+	}
+	defer rows.Close()
+
+	var res []Event
+	for rows.Next() {
+		var e Event
+		var payload string
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "scan event")
+		}
+		e.Payload = json.RawMessage(payload)
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// EventsAfter returns up to limit events written after the event id, sent or not, oldest first.
+func (d *DB) EventsAfter(id, limit int) ([]Event, error) {
+	return d.queryEvents("SELECT id, type, payload, created_at FROM outbox_events WHERE id>$1 ORDER BY id LIMIT $2", id, limit)
+}
+
+// LastEventBefore returns the id of the last event written before the time, 0 if none.
+func (d *DB) LastEventBefore(t time.Time) (int, error) {
+	var id sql.NullInt64
+	err := d.db.QueryRow("SELECT MAX(id) FROM outbox_events WHERE created_at<$1", dbTime(t)).Scan(&id)
+	return int(id.Int64), errors.Wrap(err, "query events")
+}
+
+// outboxLease is the lease of the instance dispatching the outbox.
+const outboxLease = "outbox"
+
+// ClaimOutbox makes the holder the only one dispatching the outbox for the lease, so that
+// instances do not publish the same events. It reports whether the holder has the outbox,
+// newly or still. A lease not renewed in time is taken over, the outbox keeps moving when the
+// instance holding it stops.
+func (d *DB) ClaimOutbox(holder string, lease time.Duration) (bool, error) {
+	at := now()
+	res, err := d.db.Exec(`INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET holder=excluded.holder, expires_at=excluded.expires_at
+		WHERE leases.holder=excluded.holder OR leases.expires_at<$4`, outboxLease, holder, at.Add(lease), at)
+	if err != nil {
+		return false, errors.Wrap(err, "claim outbox")
+	}
+	n, err := res.RowsAffected()
+	return n == 1, errors.Wrap(err, "claim outbox")
+}
+
+// MarkEventSent takes the event out of the pending ones.
+func (d *DB) MarkEventSent(id int) error {
+	_, err := d.db.Exec("UPDATE outbox_events SET sent_at=$1 WHERE id=$2", now(), id)
+	return errors.Wrap(err, "mark event sent")
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Events(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	u2, _ := db.AddUser("test2", money.MustParse("100"))
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("10"))
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("-5"))
+	_ = db.Transfer(u1.ID, u2.ID, money.MustParse("30"))
+	//failed changes write no event
+	_ = db.Transfer(u1.ID, u2.ID, money.MustParse("3000"))
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("-3000"))
+	_, _ = db.BatchTransfer("k1", u2.MainAccount, []BatchLeg{{ToAccount: u1.MainAccount, Amount: money.MustParse("1")},
+		{ToAccount: u1.MainAccount, Amount: money.MustParse("2")}})
+	assert.Nil(t, db.AddUsers([]NewUser{{Name: "test3", Balance: money.MustParse("7")}}))
+
+	events, err := db.PendingEvents(100)
+	assert.Nil(t, err)
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{EventUserCreated, EventUserCreated, EventFundsDeposited, EventFundsWithdrawn,
+		EventTransferCompleted, EventTransferCompleted, EventTransferCompleted, EventUserCreated}, types)
+
+	var created UserCreated
+	assert.Nil(t, json.Unmarshal(events[0].Payload, &created))
+	assert.Equal(t, UserCreated{UserID: u1.ID, Name: "test1", AccountID: u1.MainAccount, Balance: "100.00"}, created)
+
+	var moved FundsMoved
+	assert.Nil(t, json.Unmarshal(events[3].Payload, &moved))
+	assert.Equal(t, FundsMoved{RecordID: 2, UserID: u1.ID, AccountID: u1.MainAccount, Amount: "5.00", Balance: "105.00"}, moved)
+
+	var transfer TransferCompleted
+	assert.Nil(t, json.Unmarshal(events[6].Payload, &transfer))
+	assert.Equal(t, TransferCompleted{RecordID: 5, FromUser: u2.ID, FromAccount: u2.MainAccount, ToUser: u1.ID,
+		ToAccount: u1.MainAccount, Amount: "2.00", FromBalance: "127.00", ToBalance: "78.00"}, transfer)
+
+	u3, _ := db.GetUser(3)
+	assert.Nil(t, json.Unmarshal(events[7].Payload, &created))
+	assert.Equal(t, UserCreated{UserID: u3.ID, Name: "test3", AccountID: u3.MainAccount, Balance: "7.00"}, created)
+
+	events, err = db.PendingEvents(2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(events))
+	assert.Nil(t, db.MarkEventSent(events[0].ID))
+	events, err = db.PendingEvents(100)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(events))
+	assert.Equal(t, EventUserCreated, events[0].Type)
+
+	last, err := db.LastEventBefore(time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, events[6].ID, last)
+	last, err = db.LastEventBefore(time.Now().Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, last)
+}
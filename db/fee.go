@@ -0,0 +1,78 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FeeUser is the system user whose main account collects the fees.
+const FeeUser = "_fees"
+
+// DefaultTier is the fee tier of users until they are given another one.
+const DefaultTier = "standard"
+
+// FeeAccount returns the revenue account collecting the fees, created on first use.
+func (d *DB) FeeAccount() (*Account, error) {
+	return d.systemAccount(FeeUser)
+}
+
+// SetUserTier puts the user in the fee tier.
+func (d *DB) SetUserTier(id int, tier string) (*User, error) {
+	tier = strings.TrimSpace(tier)
+	if tier == "" || len(tier) > 32 {
+		return nil, errors.Errorf("tier should be 1 to 32 characters: %q", tier)
+	}
+	res, err := d.db.Exec("UPDATE users SET tier=$1 WHERE id=$2", tier, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "update user")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, errors.Errorf("user %d not found", id)
+	}
+	if err := d.usersChanged(id); err != nil {
+		return nil, err
+	}
+	return d.GetUser(id)
+}
+
+func checkFee(fee money.Money) error {
+	if fee.Sign() < 0 {
+		return errors.Errorf("fee should not be negative: %s", fee)
+	}
+	return nil
+}
+
+// feeStatements pay the fee from the account to the fee account as a record of its own,
+// balance is the account's balance once the fee is paid, set by the statements before. The
+// fee account is updated in place as many transactions pay into it at once.
+func (d *DB) feeStatements(from *Account, fee money.Money, balance *money.Money) ([]Statement, error) {
+	fees, err := d.FeeAccount()
+	if err != nil {
+		return nil, err
+	}
+	var feesBalance money.Money
+	record, entry := recordStatement(from, fees, fee)
+	return []Statement{
+		{exec: func(tx *sql.Tx) error {
+			var err error
+			feesBalance, err = addBalance(tx, fees.ID, fee)
+			return errors.Wrap(err, "update fee account")
+		}, users: []int{fees.UserID}},
+		record,
+		eventStatement(EventTransferCompleted, func(*sql.Tx) (interface{}, error) {
+			return TransferCompleted{
+				RecordID:    entry.id,
+				FromUser:    from.UserID,
+				FromAccount: from.ID,
+				ToUser:      fees.UserID,
+				ToAccount:   fees.ID,
+				Amount:      fee.String(),
+				FromBalance: balance.String(),
+				ToBalance:   feesBalance.String(),
+			}, nil
+		}),
+	}, nil
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_SetUserTier(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	assert.Equal(t, DefaultTier, u.Tier)
+
+	u, err = d.SetUserTier(u.ID, " premium ")
+	assert.Nil(t, err)
+	assert.Equal(t, "premium", u.Tier)
+	_, err = d.SetUserTier(u.ID, " ")
+	assert.NotNil(t, err)
+	_, err = d.SetUserTier(9999, "premium")
+	assert.NotNil(t, err)
+}
+
+func TestDB_TransferWithFee(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u1, _ := d.AddUser("test1", money.MustParse("100"))
+	u2, _ := d.AddUser("test2", money.MustParse("0"))
+
+	//the fee counts against the balance
+	assert.NotNil(t, d.TransferWithFee(u1.ID, u2.ID, money.MustParse("100"), money.MustParse("0.01")))
+	assert.NotNil(t, d.TransferWithFee(u1.ID, u2.ID, money.MustParse("1"), money.MustParse("-1")))
+
+	assert.Nil(t, d.TransferWithFee(u1.ID, u2.ID, money.MustParse("10"), money.MustParse("0.25")))
+	u1, _ = d.GetUser(u1.ID)
+	u2, _ = d.GetUser(u2.ID)
+	assert.Equal(t, "89.75", u1.Balance.String())
+	assert.Equal(t, "10.00", u2.Balance.String())
+	fees, err := d.FeeAccount()
+	assert.Nil(t, err)
+	assert.Equal(t, "0.25", fees.Balance.String())
+
+	//the fee is a record and an event of its own
+	records, _ := d.UserRecords(u1.ID)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, fees.ID, records[1].ToAccount)
+	assert.Equal(t, "0.25", records[1].Amount.String())
+	events, _ := d.PendingEvents(100)
+	var e TransferCompleted
+	assert.Nil(t, json.Unmarshal(events[len(events)-1].Payload, &e))
+	assert.Equal(t, records[1].ID, e.RecordID)
+	assert.Equal(t, "89.75", e.FromBalance)
+	assert.Equal(t, "0.25", e.ToBalance)
+	assert.Nil(t, json.Unmarshal(events[len(events)-2].Payload, &e))
+	assert.Equal(t, "90.00", e.FromBalance)
+
+	_, err = d.WithdrawOrDepositWithFee(u1.ID, money.MustParse("-10"), money.MustParse("1"))
+	assert.Nil(t, err)
+	_, err = d.WithdrawOrDepositWithFee(u1.ID, money.MustParse("-78"), money.MustParse("1"))
+	assert.NotNil(t, err)
+	u1, _ = d.GetUser(u1.ID)
+	assert.Equal(t, "78.75", u1.Balance.String())
+	fees, _ = d.FeeAccount()
+	assert.Equal(t, "1.25", fees.Balance.String())
+
+	r, err := d.Reconcile()
+	assert.Nil(t, err)
+	assert.True(t, r.OK)
+
+	//a fee the fee account cannot hold fails the whole transfer
+	_, err = d.db.Exec("UPDATE accounts SET balance=$1 WHERE id=$2", money.Max, fees.ID)
+	assert.Nil(t, err)
+	err = d.TransferWithFee(u1.ID, u2.ID, money.MustParse("1"), money.MustParse("0.01"))
+	assert.True(t, errors.Is(err, money.ErrOverflow))
+	u1, _ = d.GetUser(u1.ID)
+	assert.Equal(t, "78.75", u1.Balance.String())
+	fees, _ = d.FeeAccount()
+	assert.Equal(t, money.Max, fees.Balance)
+}
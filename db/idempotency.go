@@ -0,0 +1,91 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IdempotencyReservationTimeout is how long a key stays reserved by a request that neither
+// saved its response nor released the key, eg. because its instance died. After that the key
+// can be taken again.
+const IdempotencyReservationTimeout = 5 * time.Minute
+
+// Reservation is an idempotency key held by a request, until it saves its response or
+// releases the key.
+type Reservation struct {
+	Key   string
+	Route string
+	// holder tells this reservation from a later one taking the key over after the timeout.
+	holder string
+}
+
+// ReserveIdempotencyKey claims the key for a request on the route, hash identifies the request.
+// Keys are scoped to their route. When a request with the key already succeeded its saved
+// response is returned with a nil reservation, the caller then replays it instead of running
+// the request again.
+func (d *DB) ReserveIdempotencyKey(key, route, hash string) (*Reservation, string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", errors.Wrap(err, "random holder")
+	}
+	r := &Reservation{Key: key, Route: route, holder: hex.EncodeToString(b)}
+	at := now()
+	res, err := d.db.Exec(`INSERT INTO idempotency_keys (key, route, request_hash, created_at, holder) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (route, key) DO UPDATE SET request_hash=excluded.request_hash, created_at=excluded.created_at,
+		holder=excluded.holder WHERE idempotency_keys.response IS NULL AND idempotency_keys.created_at<$6`,
+		key, route, hash, at, r.holder, at.Add(-IdempotencyReservationTimeout))
+	if err != nil {
+		return nil, "", errors.Wrap(err, "reserve idempotency key")
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return r, "", nil
+	}
+
+	var storedHash string
+	var response sql.NullString
+	err = d.db.QueryRow("SELECT request_hash, response FROM idempotency_keys WHERE route=$1 AND key=$2", route, key).
+		Scan(&storedHash, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		//released by a failed request in the meantime
+		return d.ReserveIdempotencyKey(key, route, hash)
+	}
+	if err != nil {
+		return nil, "", errors.Wrap(err, "query idempotency key")
+	}
+	if storedHash != hash {
+		return nil, "", errors.Errorf("idempotency key %s is already used by a different request", key)
+	}
+	if !response.Valid {
+		return nil, "", errors.Errorf("a request with idempotency key %s is in progress", key)
+	}
+	return nil, response.String, nil
+}
+
+// SaveIdempotentResponse keeps the response of the request holding the reservation. Nothing
+// is saved when the reservation timed out and another request took the key.
+func (d *DB) SaveIdempotentResponse(r *Reservation, response string) error {
+	_, err := d.db.Exec("UPDATE idempotency_keys SET response=$1 WHERE route=$2 AND key=$3 AND holder=$4",
+		response, r.Route, r.Key, r.holder)
+	return errors.Wrap(err, "save idempotent response")
+}
+
+// ReleaseIdempotencyKey frees the key of a failed request so that it can be retried.
+func (d *DB) ReleaseIdempotencyKey(r *Reservation) error {
+	_, err := d.db.Exec("DELETE FROM idempotency_keys WHERE route=$1 AND key=$2 AND holder=$3 AND response IS NULL",
+		r.Route, r.Key, r.holder)
+	return errors.Wrap(err, "release idempotency key")
+}
+
+// PruneIdempotencyKeys deletes the keys taken before, returning how many. Requests retried
+// with a deleted key run again.
+func (d *DB) PruneIdempotencyKeys(before time.Time) (int64, error) {
+	res, err := d.db.Exec("DELETE FROM idempotency_keys WHERE created_at<$1", dbTime(before))
+	if err != nil {
+		return 0, errors.Wrap(err, "delete idempotency keys")
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_IdempotencyKey(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+
+	r1, _, err := d.ReserveIdempotencyKey("k1", "/deposit", "h1")
+	assert.Nil(t, err)
+	assert.NotNil(t, r1)
+
+	//in progress, then done
+	_, _, err = d.ReserveIdempotencyKey("k1", "/deposit", "h1")
+	assert.NotNil(t, err)
+	assert.Nil(t, d.SaveIdempotentResponse(r1, `{"code":0}`))
+	r, saved, err := d.ReserveIdempotencyKey("k1", "/deposit", "h1")
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+	assert.Equal(t, `{"code":0}`, saved)
+
+	//another request with the key, keys of other routes are apart
+	_, _, err = d.ReserveIdempotencyKey("k1", "/deposit", "h2")
+	assert.NotNil(t, err)
+	r, _, err = d.ReserveIdempotencyKey("k1", "/transfer", "h1")
+	assert.Nil(t, err)
+	assert.NotNil(t, r)
+
+	//a released key is free again, a saved one is kept
+	r2, _, err := d.ReserveIdempotencyKey("k2", "/deposit", "h1")
+	assert.Nil(t, err)
+	assert.Nil(t, d.ReleaseIdempotencyKey(r2))
+	r2, _, err = d.ReserveIdempotencyKey("k2", "/deposit", "h2")
+	assert.Nil(t, err)
+	assert.NotNil(t, r2)
+	assert.Nil(t, d.ReleaseIdempotencyKey(r1))
+	r, _, _ = d.ReserveIdempotencyKey("k1", "/deposit", "h1")
+	assert.Nil(t, r)
+
+	//a reservation never saved nor released times out, its holder then cannot touch the key
+	_, err = d.db.Exec("UPDATE idempotency_keys SET created_at=$1 WHERE key=$2",
+		now().Add(-IdempotencyReservationTimeout-time.Second), "k2")
+	assert.Nil(t, err)
+	r3, _, err := d.ReserveIdempotencyKey("k2", "/deposit", "h3")
+	assert.Nil(t, err)
+	assert.NotNil(t, r3)
+	assert.Nil(t, d.ReleaseIdempotencyKey(r2))
+	_, _, err = d.ReserveIdempotencyKey("k2", "/deposit", "h3")
+	assert.NotNil(t, err)
+
+	//old keys are pruned and free again
+	_, err = d.db.Exec("UPDATE idempotency_keys SET created_at=$1 WHERE route=$2", now().Add(-time.Hour), "/transfer")
+	assert.Nil(t, err)
+	n, err := d.PruneIdempotencyKeys(time.Now().Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = d.PruneIdempotencyKeys(time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	r, _, err = d.ReserveIdempotencyKey("k1", "/deposit", "h2")
+	assert.Nil(t, err)
+	assert.NotNil(t, r)
+}
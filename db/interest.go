@@ -0,0 +1,305 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"context"
+	"database/sql"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// InterestUser is the system user whose main account pays the interest, its balance goes
+// negative by the interest paid.
+const InterestUser = "_interest"
+
+// DayFormat is how accrual days are stored, months are the first 7 characters.
+const DayFormat = "2006-01-02"
+
+// Accrual is the interest earned by an account on a day, kept exact until posted.
+type Accrual struct {
+	ID        int
+	AccountID int
+	Day       string
+	// Balance is the balance at the end of the day, Rate the annual rate then.
+	Balance money.Money
+	Rate    *big.Rat
+	Amount  *big.Rat
+	// PostingID is the posting that paid the accrual, 0 until then.
+	PostingID int
+}
+
+// InterestPosting pays the interest accrued by an account in a month.
+type InterestPosting struct {
+	ID        int
+	AccountID int
+	Month     string
+	// Accrued is the interest of the month plus the carry of the previous posting, Amount
+	// what is paid of it in whole cents and Carry the rest, paid with the next posting.
+	Accrued   *big.Rat
+	Amount    money.Money
+	Carry     *big.Rat
+	RecordID  int
+	CreatedAt time.Time
+}
+
+// SetInterestRate sets the annual interest rate of the account, overriding the rate of its
+// product. A nil rate removes the override.
+func (d *DB) SetInterestRate(accountID int, rate *big.Rat) error {
+	if _, err := d.GetAccount(accountID); err != nil {
+		return errors.Wrap(err, "get account")
+	}
+	if rate == nil {
+		_, err := d.db.Exec("DELETE FROM interest_rates WHERE account_id=$1", accountID)
+		return errors.Wrap(err, "delete rate")
+	}
+	_, err := d.db.Exec(`INSERT INTO interest_rates (account_id, rate, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (account_id) DO UPDATE SET rate=excluded.rate, updated_at=excluded.updated_at`, accountID, rate.RatString(), now())
+	return errors.Wrap(err, "save rate")
+}
+
+// InterestRates returns the rates set on single accounts, by account id.
+func (d *DB) InterestRates() (map[int]*big.Rat, error) {
+	rows, err := d.db.Query("SELECT account_id, rate FROM interest_rates")
+	if err != nil {
+		return nil, errors.Wrap(err, "query rates")
+	}
+	defer rows.Close()
+	res := map[int]*big.Rat{}
+	for rows.Next() {
+		var id int
+		var rate string
+		if err := rows.Scan(&id, &rate); err != nil {
+			return nil, errors.Wrap(err, "scan rate")
+		}
+		res[id], err = parseRat(rate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, rows.Err()
+}
+
+// InterestAccount returns the account paying the interest, created on first use.
+func (d *DB) InterestAccount() (*Account, error) {
+	return d.systemAccount(InterestUser)
+}
+
+// systemAccount returns the main account of the system user, created on first use.
+func (d *DB) systemAccount(user string) (*Account, error) {
+	var id int
+	err := d.db.QueryRow(`SELECT a.id FROM accounts a JOIN users u ON u.id=a.user_id
+		WHERE u.name=$1 AND a.name=$2`, user, DefaultAccount).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		u, err := d.addUser(user, 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "add system user %s", user)
+		}
+		id = u.MainAccount
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "query system user %s", user)
+	}
+	return d.GetAccount(id)
+}
+
+// Accounts returns every account, oldest first.
+func (d *DB) Accounts() ([]Account, error) {
+	rows, err := d.db.Query("SELECT id, user_id, name, balance, created_at FROM accounts ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "query accounts")
+	}
+	defer rows.Close()
+	var res []Account
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *a)
+	}
+	return res, rows.Err()
+}
+
+// LastAccrualDay returns the last day interest was accrued for the account, "" if none.
+func (d *DB) LastAccrualDay(accountID int) (string, error) {
+	var day sql.NullString
+	err := d.db.QueryRow("SELECT MAX(day) FROM interest_accruals WHERE account_id=$1", accountID).Scan(&day)
+	return day.String, errors.Wrap(err, "query accruals")
+}
+
+// AddAccrual saves the accrual unless the day is accrued already, which it reports with false.
+func (d *DB) AddAccrual(a Accrual) (bool, error) {
+	res, err := d.db.Exec(`INSERT INTO interest_accruals (account_id, day, balance, rate, amount, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (account_id, day) DO NOTHING`,
+		a.AccountID, a.Day, a.Balance, a.Rate.RatString(), a.Amount.RatString(), now())
+	if err != nil {
+		return false, errors.Wrap(err, "insert accrual")
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// UnpostedAccruals returns the accruals not paid yet of days before the day, by account and day.
+func (d *DB) UnpostedAccruals(before string) ([]Accrual, error) {
+	rows, err := d.db.Query(`SELECT id, account_id, day, balance, rate, amount FROM interest_accruals
+		WHERE posting_id IS NULL AND day<$1 ORDER BY account_id, day`, before)
+	if err != nil {
+		return nil, errors.Wrap(err, "query accruals")
+	}
+	defer rows.Close()
+	var res []Accrual
+	for rows.Next() {
+		var a Accrual
+		var rate, amount string
+		if err := rows.Scan(&a.ID, &a.AccountID, &a.Day, &a.Balance, &rate, &amount); err != nil {
+			return nil, errors.Wrap(err, "scan accrual")
+		}
+		if a.Rate, err = parseRat(rate); err != nil {
+			return nil, err
+		}
+		if a.Amount, err = parseRat(amount); err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+// InterestCarry returns the carry of the last posting of the account, zero without one.
+func (d *DB) InterestCarry(accountID int) (*big.Rat, error) {
+	var carry string
+	err := d.db.QueryRow("SELECT carry FROM interest_postings WHERE account_id=$1 ORDER BY month DESC LIMIT 1", accountID).Scan(&carry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return new(big.Rat), nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "query posting")
+	}
+	return parseRat(carry)
+}
+
+// InterestPostings returns the postings of the account, oldest first.
+func (d *DB) InterestPostings(accountID int) ([]InterestPosting, error) {
+	rows, err := d.db.Query(`SELECT id, account_id, month, accrued, amount, carry, COALESCE(record_id, 0), created_at
+		FROM interest_postings WHERE account_id=$1 ORDER BY month`, accountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query postings")
+	}
+	defer rows.Close()
+	var res []InterestPosting
+	for rows.Next() {
+		var p InterestPosting
+		var accrued, carry string
+		err := rows.Scan(&p.ID, &p.AccountID, &p.Month, &accrued, &p.Amount, &carry, &p.RecordID, &p.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan posting")
+		}
+		if p.Accrued, err = parseRat(accrued); err != nil {
+			return nil, err
+		}
+		if p.Carry, err = parseRat(carry); err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// PostInterest pays the posting from the interest account and marks the accruals of the
+// month paid, in one transaction. A month already posted for the account is left alone and
+// reported with false, so runs can be repeated. Accounts of closed users are paid nothing,
+// the whole interest is carried instead.
+func (d *DB) PostInterest(p *InterestPosting) (bool, error) {
+	if p.Amount.Sign() < 0 {
+		return false, errors.Errorf("interest amount should not be negative: %s", p.Amount)
+	}
+	to, err := d.GetAccount(p.AccountID)
+	if err != nil {
+		return false, errors.Wrap(err, "get account")
+	}
+	from, err := d.InterestAccount()
+	if err != nil {
+		return false, err
+	}
+	month, err := time.Parse("2006-01", p.Month)
+	if err != nil {
+		return false, errors.Wrap(err, "month")
+	}
+
+	tx, err := d.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return false, errors.Wrap(err, "create tx")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	owner, err := d.lockStatus(tx, to.UserID)
+	if err != nil {
+		return false, err
+	}
+	if owner.canReceive() != nil {
+		p.Amount, p.Carry = 0, new(big.Rat).Set(p.Accrued)
+	}
+	p.CreatedAt = now()
+	err = tx.QueryRow(`INSERT INTO interest_postings (account_id, month, accrued, amount, carry, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (account_id, month) DO NOTHING RETURNING id`,
+		p.AccountID, p.Month, p.Accrued.RatString(), p.Amount, p.Carry.RatString(), p.CreatedAt).Scan(&p.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "insert posting")
+	}
+	_, err = tx.Exec(`UPDATE interest_accruals SET posting_id=$1 WHERE account_id=$2 AND day>=$3 AND day<$4 AND posting_id IS NULL`,
+		p.ID, p.AccountID, month.Format(DayFormat), month.AddDate(0, 1, 0).Format(DayFormat))
+	if err != nil {
+		return false, errors.Wrap(err, "mark accruals")
+	}
+
+	var users []int
+	if p.Amount.Sign() > 0 {
+		if err := payInterest(tx, from, to, p); err != nil {
+			return false, err
+		}
+		users = []int{from.UserID, to.UserID}
+	}
+	if err := d.notifyUsers(tx, users); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "commit tx")
+	}
+	d.cache.invalidate(users...)
+	return true, nil
+}
+
+// payInterest moves the posting amount from the interest account to the account, the
+// balances are updated in place as the interest account may go as negative as an amount can.
+func payInterest(tx *sql.Tx, from, to *Account, p *InterestPosting) error {
+	fromBalance, err := addBalance(tx, from.ID, p.Amount.Neg())
+	if err != nil {
+		return errors.Wrap(err, "update interest account")
+	}
+	toBalance, err := addBalance(tx, to.ID, p.Amount)
+	if err != nil {
+		return errors.Wrap(err, "update account")
+	}
+	record, entry := recordStatement(from, to, p.Amount)
+	if err := record.exec(tx); err != nil {
+		return err
+	}
+	p.RecordID = entry.id
+	if _, err := tx.Exec("UPDATE interest_postings SET record_id=$1 WHERE id=$2", p.RecordID, p.ID); err != nil {
+		return errors.Wrap(err, "update posting")
+	}
+	event := transferStatement(from, to, p.Amount, fromBalance, toBalance, entry)
+	return event.exec(tx)
+}
+
+func parseRat(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, errors.Errorf("not a number: %q", s)
+	}
+	return r, nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_SetInterestRate(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+
+	assert.Nil(t, d.SetInterestRate(u.MainAccount, big.NewRat(7, 200)))
+	assert.Nil(t, d.SetInterestRate(u.MainAccount, big.NewRat(1, 20)))
+	rates, err := d.InterestRates()
+	assert.Nil(t, err)
+	assert.Equal(t, "1/20", rates[u.MainAccount].RatString())
+
+	assert.Nil(t, d.SetInterestRate(u.MainAccount, nil))
+	rates, err = d.InterestRates()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rates))
+	assert.NotNil(t, d.SetInterestRate(9999, big.NewRat(1, 20)))
+}
+
+func TestDB_PostInterest(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+
+	accrual := Accrual{AccountID: u.MainAccount, Day: "2024-01-31", Balance: money.MustParse("100"), Rate: big.NewRat(1, 20),
+		Amount: big.NewRat(1, 73)}
+	added, err := d.AddAccrual(accrual)
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = d.AddAccrual(accrual)
+	assert.Nil(t, err)
+	assert.False(t, added)
+	day, err := d.LastAccrualDay(u.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-01-31", day)
+
+	accruals, err := d.UnpostedAccruals("2024-02-01")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(accruals))
+	assert.Equal(t, "1/73", accruals[0].Amount.RatString())
+	assert.Equal(t, "100.00", accruals[0].Balance.String())
+
+	_, err = d.PostInterest(&InterestPosting{AccountID: u.MainAccount, Month: "2024-01", Accrued: big.NewRat(1, 73),
+		Amount: money.MustParse("-1"), Carry: new(big.Rat)})
+	assert.NotNil(t, err)
+
+	p := &InterestPosting{AccountID: u.MainAccount, Month: "2024-01", Accrued: big.NewRat(101, 73),
+		Amount: money.MustParse("1.38"), Carry: big.NewRat(1, 7300)}
+	posted, err := d.PostInterest(p)
+	assert.Nil(t, err)
+	assert.True(t, posted)
+	assert.NotZero(t, p.RecordID)
+	posted, err = d.PostInterest(&InterestPosting{AccountID: u.MainAccount, Month: "2024-01", Accrued: big.NewRat(101, 73),
+		Amount: money.MustParse("1.38"), Carry: big.NewRat(1, 7300)})
+	assert.Nil(t, err)
+	assert.False(t, posted)
+
+	accruals, err = d.UnpostedAccruals("2024-02-01")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(accruals))
+	carry, err := d.InterestCarry(u.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, "1/7300", carry.RatString())
+
+	ps, err := d.InterestPostings(u.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ps))
+	assert.Equal(t, "1.38", ps[0].Amount.String())
+	assert.Equal(t, p.RecordID, ps[0].RecordID)
+
+	a, _ := d.GetAccount(u.MainAccount)
+	assert.Equal(t, "101.38", a.Balance.String())
+	system, err := d.InterestAccount()
+	assert.Nil(t, err)
+	assert.Equal(t, "-1.38", system.Balance.String())
+	records, err := d.UserRecords(u.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	//closed accounts are paid nothing, the interest is carried
+	closed, _ := d.AddUser("test2", 0)
+	_, err = d.SetUserStatus(closed.ID, StatusClosed, "ops", "customer request")
+	assert.Nil(t, err)
+	p = &InterestPosting{AccountID: closed.MainAccount, Month: "2024-01", Accrued: big.NewRat(101, 73),
+		Amount: money.MustParse("1.38"), Carry: big.NewRat(1, 7300)}
+	posted, err = d.PostInterest(p)
+	assert.Nil(t, err)
+	assert.True(t, posted)
+	assert.Zero(t, p.RecordID)
+	carry, err = d.InterestCarry(closed.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, "101/73", carry.RatString())
+	a, _ = d.GetAccount(closed.MainAccount)
+	assert.Equal(t, "0.00", a.Balance.String())
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"code_challenge1/log"
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PoolConfig sizes the connection pool of the primary and of the replica.
+type PoolConfig struct {
+	// MaxOpen caps the connections open to the database, in use or idle.
+	MaxOpen int
+	// MaxIdle is how many unused connections are kept for reuse.
+	MaxIdle int
+	// MaxLifetime closes connections that old, so they move to new servers behind a
+	// proxy or failover. MaxIdleTime closes connections unused that long.
+	MaxLifetime time.Duration
+	MaxIdleTime time.Duration
+}
+
+// DefaultPoolConfig leaves room under the default 100 connections of postgres for a few
+// instances and the ops commands.
+var DefaultPoolConfig = PoolConfig{
+	MaxOpen:     20,
+	MaxIdle:     10,
+	MaxLifetime: 30 * time.Minute,
+	MaxIdleTime: 5 * time.Minute,
+}
+
+// DefaultConnectAttempts is how many times the database is tried at start, unless
+// DB_CONNECT_ATTEMPTS says otherwise.
+const DefaultConnectAttempts = 5
+
+// connectBackoff is the wait after the first failed attempt, doubled after every other one
+// up to maxConnectBackoff.
+var (
+	connectBackoff    = 500 * time.Millisecond
+	maxConnectBackoff = 10 * time.Second
+)
+
+// LoadPoolConfig reads DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME and
+// DB_CONN_MAX_IDLE_TIME, DefaultPoolConfig for those not set.
+func LoadPoolConfig() (PoolConfig, error) {
+	c := DefaultPoolConfig
+	var err error
+	if c.MaxOpen, err = envInt("DB_MAX_OPEN_CONNS", c.MaxOpen); err != nil {
+		return c, err
+	}
+	if c.MaxIdle, err = envInt("DB_MAX_IDLE_CONNS", c.MaxIdle); err != nil {
+		return c, err
+	}
+	if c.MaxLifetime, err = envDuration("DB_CONN_MAX_LIFETIME", c.MaxLifetime); err != nil {
+		return c, err
+	}
+	if c.MaxIdleTime, err = envDuration("DB_CONN_MAX_IDLE_TIME", c.MaxIdleTime); err != nil {
+		return c, err
+	}
+	if c.MaxOpen > 0 && c.MaxIdle > c.MaxOpen {
+		return c, errors.Errorf("DB_MAX_IDLE_CONNS %d should not be above DB_MAX_OPEN_CONNS %d", c.MaxIdle, c.MaxOpen)
+	}
+	return c, nil
+}
+
+func (c PoolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(c.MaxOpen)
+	db.SetMaxIdleConns(c.MaxIdle)
+	db.SetConnMaxLifetime(c.MaxLifetime)
+	db.SetConnMaxIdleTime(c.MaxIdleTime)
+}
+
+// connect pings the database until it answers, waiting longer after every failed attempt,
+// so the server can start before the database is up.
+func connect(db *sql.DB, attempts int) error {
+	wait := connectBackoff
+	for i := 1; ; i++ {
+		err := db.Ping()
+		if err == nil {
+			return nil
+		}
+		if i >= attempts {
+			return errors.Wrapf(err, "database not reachable after %d attempts", attempts)
+		}
+		log.Warnf("database not reachable, retry in %v: %v", wait, err)
+		time.Sleep(wait)
+		wait = min(2*wait, maxConnectBackoff)
+	}
+}
+
+// PoolStats are the connection pool statistics of the primary, and of the replica if any.
+type PoolStats struct {
+	Primary sql.DBStats
+	Replica *sql.DBStats
+}
+
+func (d *DB) PoolStats() PoolStats {
+	res := PoolStats{Primary: d.db.Stats()}
+	if d.replica != nil {
+		s := d.replica.db.Stats()
+		res.Replica = &s
+	}
+	return res
+}
+
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("%s should be a number not below 0: %q", key, v)
+	}
+	return n, nil
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("%s should be a duration not below 0, eg. 30m: %q", key, v)
+	}
+	return d, nil
+}
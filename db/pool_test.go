@@ -0,0 +1,76 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPoolConfig(t *testing.T) {
+	c, err := LoadPoolConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPoolConfig, c)
+
+	os.Setenv("DB_MAX_OPEN_CONNS", "50")
+	defer os.Unsetenv("DB_MAX_OPEN_CONNS")
+	os.Setenv("DB_CONN_MAX_LIFETIME", "1h")
+	defer os.Unsetenv("DB_CONN_MAX_LIFETIME")
+	c, err = LoadPoolConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, 50, c.MaxOpen)
+	assert.Equal(t, DefaultPoolConfig.MaxIdle, c.MaxIdle)
+	assert.Equal(t, time.Hour, c.MaxLifetime)
+
+	for key, value := range map[string]string{
+		"DB_MAX_IDLE_CONNS":     "-1",
+		"DB_CONN_MAX_IDLE_TIME": "5",
+	} {
+		os.Setenv(key, value)
+		_, err = LoadPoolConfig()
+		assert.NotNil(t, err, key)
+		os.Unsetenv(key)
+	}
+	os.Setenv("DB_MAX_IDLE_CONNS", "51")
+	defer os.Unsetenv("DB_MAX_IDLE_CONNS")
+	_, err = LoadPoolConfig()
+	assert.NotNil(t, err)
+}
+
+func TestConnect(t *testing.T) {
+	connectBackoff, maxConnectBackoff = time.Millisecond, 2*time.Millisecond
+	defer func() { connectBackoff, maxConnectBackoff = 500*time.Millisecond, 10*time.Second }()
+
+	//nothing listens there
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable")
+	assert.Nil(t, err)
+	err = connect(db, 3)
+	assert.ErrorContains(t, err, "after 3 attempts")
+
+	setupDbTest()
+	os.Setenv("DB_CONNECT_ATTEMPTS", "x")
+	_, err = Open()
+	assert.NotNil(t, err)
+	os.Unsetenv("DB_CONNECT_ATTEMPTS")
+}
+
+func TestDB_PoolStats(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	s := d.PoolStats()
+	assert.Equal(t, 1, s.Primary.MaxOpenConnections)
+	assert.Equal(t, 1, s.Primary.OpenConnections)
+	assert.Nil(t, s.Replica)
+
+	os.Setenv("DB_REPLICA_CONNECT_INFO", "host=127.0.0.1 port=1 sslmode=disable")
+	defer os.Unsetenv("DB_REPLICA_CONNECT_INFO")
+	d, err = Open()
+	assert.Nil(t, err)
+	s = d.PoolStats()
+	if assert.NotNil(t, s.Replica) {
+		assert.Equal(t, DefaultPoolConfig.MaxOpen, s.Replica.MaxOpenConnections)
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UpdateRateBucket runs update on the rate limit bucket of key and saves what it returns,
+// with the row locked so that instances sharing the database take tokens one at a time.
+// A bucket not seen before has found false.
+func (d *DB) UpdateRateBucket(key string, update func(tokens float64, updated time.Time, found bool) (float64, time.Time)) error {
+	tx, err := d.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return errors.Wrap(err, "create tx")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	//the no-op update takes the row lock before reading it
+	res, err := tx.Exec("UPDATE rate_limits SET tokens=tokens WHERE key=$1", key)
+	if err != nil {
+		return errors.Wrap(err, "lock bucket")
+	}
+	found := false
+	var tokens float64
+	var micros int64
+	if n, _ := res.RowsAffected(); n == 1 {
+		if err := tx.QueryRow("SELECT tokens, updated_at FROM rate_limits WHERE key=$1", key).Scan(&tokens, &micros); err != nil {
+			return errors.Wrap(err, "query bucket")
+		}
+		found = true
+	}
+	tokens, updated := update(tokens, time.UnixMicro(micros), found)
+
+	//two new buckets of the same key racing end with the last one written, which at worst
+	//lets the caller in once more
+	_, err = tx.Exec(`INSERT INTO rate_limits (key, tokens, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET tokens=excluded.tokens, updated_at=excluded.updated_at`, key, tokens, updated.UnixMicro())
+	if err != nil {
+		return errors.Wrap(err, "save bucket")
+	}
+	return errors.Wrap(tx.Commit(), "commit tx")
+}
+
+// PruneRateBuckets deletes the buckets not used since before, returning how many.
+func (d *DB) PruneRateBuckets(before time.Time) (int64, error) {
+	res, err := d.db.Exec("DELETE FROM rate_limits WHERE updated_at<$1", before.UnixMicro())
+	if err != nil {
+		return 0, errors.Wrap(err, "delete buckets")
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_UpdateRateBucket(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+
+	now := time.UnixMicro(1700000000123456)
+	err = d.UpdateRateBucket("a", func(tokens float64, updated time.Time, found bool) (float64, time.Time) {
+		assert.False(t, found)
+		return 1.5, now
+	})
+	assert.Nil(t, err)
+	err = d.UpdateRateBucket("a", func(tokens float64, updated time.Time, found bool) (float64, time.Time) {
+		assert.True(t, found)
+		assert.Equal(t, 1.5, tokens)
+		assert.True(t, now.Equal(updated))
+		return 0.5, now.Add(time.Hour)
+	})
+	assert.Nil(t, err)
+
+	n, err := d.PruneRateBuckets(now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = d.PruneRateBuckets(now.Add(2 * time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+}
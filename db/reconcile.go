@@ -0,0 +1,127 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Mismatch struct {
+	AccountID int
+	UserID    int
+	Balance   money.Money
+	// Expected is the opening balance plus every record of the account.
+	Expected money.Money
+}
+
+type Reconciliation struct {
+	ID         int
+	Accounts   int
+	Mismatches []Mismatch
+	// TotalBalance is the money in all accounts, NetDeposits all opening balances plus
+	// deposits minus withdraws. Transfers only move money around, so they must be equal.
+	TotalBalance money.Money
+	NetDeposits  money.Money
+	OK           bool
+	CreatedAt    time.Time
+}
+
+type mismatchJSON struct {
+	AccountID int   `json:"account_id"`
+	UserID    int   `json:"user_id"`
+	Balance   int64 `json:"balance"`
+	Expected  int64 `json:"expected"`
+}
+
+// Reconcile recomputes the balance of every account from its records and checks that the
+// money in the system equals the net deposits. The result is saved, see LastReconciliation.
+func (d *DB) Reconcile() (*Reconciliation, error) {
+	//one statement, so every number comes from the same snapshot of the database
+	rows, err := d.db.Query(`SELECT a.id, a.user_id, a.balance, a.opening_balance,
+		COALESCE((SELECT SUM(CASE WHEN r.to_account=a.id THEN r.amount ELSE -r.amount END) FROM records r
+			WHERE r.from_account=a.id OR r.to_account=a.id), 0),
+		COALESCE((SELECT SUM(r.amount) FROM records r WHERE r.from_account=a.id AND r.to_account=a.id), 0)
+		FROM accounts a ORDER BY a.id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "query accounts")
+	}
+	defer rows.Close()
+
+	res := Reconciliation{CreatedAt: now()}
+	var mismatches []mismatchJSON
+	for rows.Next() {
+		var id, userID int
+		var balance, opening, effects, deposits money.Money
+		if err := rows.Scan(&id, &userID, &balance, &opening, &effects, &deposits); err != nil {
+			return nil, errors.Wrap(err, "scan account")
+		}
+		res.Accounts++
+		if res.TotalBalance, err = res.TotalBalance.Add(balance); err != nil {
+			return nil, errors.Wrap(err, "total balance")
+		}
+		if res.NetDeposits, err = res.NetDeposits.Add(opening); err != nil {
+			return nil, errors.Wrap(err, "net deposits")
+		}
+		if res.NetDeposits, err = res.NetDeposits.Add(deposits); err != nil {
+			return nil, errors.Wrap(err, "net deposits")
+		}
+		//an expected balance out of range cannot match, it is reported as zero
+		expected, err := opening.Add(effects)
+		if err != nil || expected != balance {
+			mismatches = append(mismatches, mismatchJSON{AccountID: id, UserID: userID,
+				Balance: int64(balance), Expected: int64(expected)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "query accounts")
+	}
+	res.OK = len(mismatches) == 0 && res.TotalBalance == res.NetDeposits
+	res.Mismatches = toMismatches(mismatches)
+
+	data, err := json.Marshal(mismatches)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode mismatches")
+	}
+	err = d.db.QueryRow(`INSERT INTO reconciliations (accounts, mismatches, total_balance, net_deposits, ok, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`, res.Accounts, string(data), res.TotalBalance, res.NetDeposits, res.OK, res.CreatedAt).Scan(&res.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "save reconciliation")
+	}
+	return &res, nil
+}
+
+// LastReconciliation returns the result of the latest reconciliation, nil if there is none.
+func (d *DB) LastReconciliation() (*Reconciliation, error) {
+	var res Reconciliation
+	var mismatches string
+	err := d.db.QueryRow(`SELECT id, accounts, mismatches, total_balance, net_deposits, ok, created_at FROM reconciliations
+		ORDER BY id DESC LIMIT 1`).Scan(&res.ID, &res.Accounts, &mismatches, &res.TotalBalance, &res.NetDeposits, &res.OK, &res.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "query reconciliation")
+	}
+	var ms []mismatchJSON
+	if err := json.Unmarshal([]byte(mismatches), &ms); err != nil {
+		return nil, errors.Wrap(err, "decode mismatches")
+	}
+	res.Mismatches = toMismatches(ms)
+	return &res, nil
+}
+
+func toMismatches(ms []mismatchJSON) []Mismatch {
+	res := make([]Mismatch, 0, len(ms))
+	for _, m := range ms {
+		res = append(res, Mismatch{
+			AccountID: m.AccountID,
+			UserID:    m.UserID,
+			Balance:   money.Money(m.Balance),
+			Expected:  money.Money(m.Expected),
+		})
+	}
+	return res
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Reconcile(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+
+	last, err := db.LastReconciliation()
+	assert.Nil(t, err)
+	assert.Nil(t, last)
+
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	u2, _ := db.AddUser("test2", money.MustParse("50"))
+	a, _ := db.AddAccount(u1.ID, "savings")
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("10"))
+	_, _ = db.WithdrawOrDeposit(u2.ID, money.MustParse("-5"))
+	_ = db.Transfer(u1.ID, u2.ID, money.MustParse("30"))
+	_ = db.TransferAccounts(u1.MainAccount, a.ID, money.MustParse("20"))
+
+	r, err := db.Reconcile()
+	assert.Nil(t, err)
+	assert.True(t, r.OK)
+	assert.Equal(t, 3, r.Accounts)
+	assert.Empty(t, r.Mismatches)
+	assert.Equal(t, "155.00", r.TotalBalance.String())
+	assert.Equal(t, "155.00", r.NetDeposits.String())
+
+	//a balance changed without a record
+	_, err = db.db.Exec("UPDATE accounts SET balance=$1 WHERE id=$2", 1000, a.ID)
+	assert.Nil(t, err)
+	r, err = db.Reconcile()
+	assert.Nil(t, err)
+	assert.False(t, r.OK)
+	assert.Equal(t, "145.00", r.TotalBalance.String())
+	if assert.Len(t, r.Mismatches, 1) {
+		m := r.Mismatches[0]
+		assert.Equal(t, a.ID, m.AccountID)
+		assert.Equal(t, u1.ID, m.UserID)
+		assert.Equal(t, "10.00", m.Balance.String())
+		assert.Equal(t, "20.00", m.Expected.String())
+	}
+
+	last, err = db.LastReconciliation()
+	assert.Nil(t, err)
+	assert.Equal(t, r.ID, last.ID)
+	assert.False(t, last.OK)
+	assert.Equal(t, r.Mismatches, last.Mismatches)
+	assert.Equal(t, "155.00", last.NetDeposits.String())
+}
+
+func TestDB_ReconcileOverflow(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	_, _ = db.AddUser("test1", money.Max)
+	_, _ = db.AddUser("test2", money.Max)
+
+	_, err = db.Reconcile()
+	assert.True(t, errors.Is(err, money.ErrOverflow))
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"code_challenge1/log"
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReplicaMaxLag is how far the replica may lag behind before reads go back to the
+// primary, unless DB_REPLICA_MAX_LAG says otherwise.
+const DefaultReplicaMaxLag = 5 * time.Second
+
+// replicaCheckInterval is how long a replica check is trusted, so not every read pays for one.
+const replicaCheckInterval = time.Second
+
+// replicaCheckTimeout bounds a check, a replica not answering in time is down.
+const replicaCheckTimeout = time.Second
+
+// replicaLag returns how far the replica is behind the primary. A replica that replayed
+// everything it received is caught up however old its last replayed transaction is.
+var replicaLag = defaultReplicaLag
+
+func defaultReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRowContext(ctx, `SELECT CASE WHEN pg_last_wal_receive_lsn()=pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now()-pg_last_xact_replay_timestamp()), 0) END`).Scan(&seconds)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// querier runs read queries, on the primary or on the replica.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// replica is a read only copy of the database, which may be down or lag behind.
+type replica struct {
+	db     *sql.DB
+	maxLag time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	ok      bool
+}
+
+// openReplica connects to the replica set in DB_REPLICA_CONNECT_INFO, nil if there is none.
+// A replica down at start is not an error, reads use the primary until it is up.
+func openReplica(pool PoolConfig) (*replica, error) {
+	conninfo := os.Getenv("DB_REPLICA_CONNECT_INFO")
+	if conninfo == "" {
+		return nil, nil
+	}
+	maxLag, err := envDuration("DB_REPLICA_MAX_LAG", DefaultReplicaMaxLag)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", conninfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "open replica")
+	}
+	pool.apply(db)
+	return &replica{db: db, maxLag: maxLag}, nil
+}
+
+// usable reports whether the replica is up and lags less than allowed. Changes are logged.
+func (r *replica) usable() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) < replicaCheckInterval {
+		return r.ok
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+	lag, err := replicaLag(ctx, r.db)
+	ok := err == nil && lag <= r.maxLag
+	if ok != r.ok || r.checked.IsZero() {
+		switch {
+		case err != nil:
+			log.Warnf("replica is down, reading from the primary: %v", err)
+		case !ok:
+			log.Warnf("replica lags %v, more than %v, reading from the primary", lag, r.maxLag)
+		default:
+			log.Infof("replica is up, lagging %v", lag)
+		}
+	}
+	r.ok = ok
+	r.checked = time.Now()
+	return ok
+}
+
+// Eventual is a read only view of the database for reads that accept eventual consistency,
+// eg. balances shown to users and history. Money never moves through it, so nothing is
+// decided on data that may be behind.
+type Eventual struct {
+	q *sql.DB
+	// snapshot are the options of transactions reading one point in time.
+	snapshot *sql.TxOptions
+	// FromReplica is whether the view reads from the replica.
+	FromReplica bool
+}
+
+// Eventual returns a view reading from the replica when there is one that is up and not
+// lagging, from the primary otherwise. A view is meant for one request, all its reads come
+// from the same database so they are consistent with each other.
+func (d *DB) Eventual() *Eventual {
+	if d.replica != nil && d.replica.usable() {
+		return &Eventual{q: d.replica.db, snapshot: snapshotTx, FromReplica: true}
+	}
+	return &Eventual{q: d.db, snapshot: d.snapshot}
+}
+
+func (e *Eventual) GetUser(id int) (*User, error) {
+	return getUser(e.q, id)
+}
+
+func (e *Eventual) GetAccount(id int) (*Account, error) {
+	return getAccount(e.q, id)
+}
+
+func (e *Eventual) UserAccounts(userID int) ([]Account, error) {
+	return userAccounts(e.q, userID)
+}
+
+func (e *Eventual) UserRecords(userID int) ([]Record, error) {
+	return userRecords(e.q, userID)
+}
+
+func (e *Eventual) AccountRecords(accountID int, since time.Time) ([]Record, error) {
+	return accountRecords(e.q, accountID, since)
+}
+
+func (e *Eventual) AccountHistory(accountID int, since time.Time) (*Account, []Record, error) {
+	return accountHistory(e.q, e.snapshot, accountID, since)
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Eventual(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("10"))
+
+	//a replica that has the user but not the deposit yet
+	r, err := open("", DefaultPoolConfig, 1)
+	assert.Nil(t, err)
+	_, _ = r.AddUser("test1", money.MustParse("100"))
+	d.replica = &replica{db: r.db, maxLag: time.Second}
+
+	lag := time.Duration(0)
+	var lagErr error
+	replicaLag = func(context.Context, *sql.DB) (time.Duration, error) { return lag, lagErr }
+	defer func() { replicaLag = defaultReplicaLag }()
+
+	e := d.Eventual()
+	assert.True(t, e.FromReplica)
+	eu, err := e.GetUser(u.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "100.00", eu.Balance.String())
+	records, _ := e.UserRecords(u.ID)
+	assert.Empty(t, records)
+	//money still moves on the primary
+	du, _ := d.GetUser(u.ID)
+	assert.Equal(t, "110.00", du.Balance.String())
+
+	//lagging beyond the threshold, once the last check is stale
+	lag = 2 * time.Second
+	assert.True(t, d.Eventual().FromReplica)
+	d.replica.checked = time.Time{}
+	e = d.Eventual()
+	assert.False(t, e.FromReplica)
+	eu, _ = e.GetUser(u.ID)
+	assert.Equal(t, "110.00", eu.Balance.String())
+
+	//down
+	lag, lagErr = 0, errors.New("connection refused")
+	d.replica.checked = time.Time{}
+	assert.False(t, d.Eventual().FromReplica)
+	lagErr = nil
+	d.replica.checked = time.Time{}
+	assert.True(t, d.Eventual().FromReplica)
+}
+
+func TestOpenReplica(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	assert.Nil(t, d.replica)
+	assert.False(t, d.Eventual().FromReplica)
+
+	os.Setenv("DB_REPLICA_CONNECT_INFO", "host=127.0.0.1 port=1 sslmode=disable")
+	defer os.Unsetenv("DB_REPLICA_CONNECT_INFO")
+	os.Setenv("DB_REPLICA_MAX_LAG", "10")
+	_, err = Open()
+	assert.NotNil(t, err)
+	os.Setenv("DB_REPLICA_MAX_LAG", "10s")
+	defer os.Unsetenv("DB_REPLICA_MAX_LAG")
+	d, err = Open()
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, d.replica.maxLag)
+	//nothing listens there, reads fall back to the primary
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	e := d.Eventual()
+	assert.False(t, e.FromReplica)
+	eu, err := e.GetUser(u.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, u.ID, eu.ID)
+}
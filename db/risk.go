@@ -0,0 +1,158 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"database/sql"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+	// ReviewNone is stored for decisions that need no review, eg. blocked transfers.
+	ReviewNone = "none"
+
+	riskActionFlag = "flag"
+)
+
+type RiskDecision struct {
+	ID           int
+	FromUser     int
+	ToUser       int
+	Amount       money.Money
+	Action       string
+	Reasons      []string
+	ReviewStatus string
+	Reviewer     string
+	ReviewNote   string
+	CreatedAt    time.Time
+	ReviewedAt   *time.Time
+}
+
+// HasTransferred reports whether fromUser ever transferred money to toUser.
+func (d *DB) HasTransferred(fromUser, toUser int) (bool, error) {
+	var n int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM records WHERE from_user=$1 AND to_user=$2", fromUser, toUser).Scan(&n)
+	if err != nil {
+		return false, errors.Wrap(err, "count records")
+	}
+	return n > 0, nil
+}
+
+// AverageTransfer returns the average amount of the transfers sent by the user,
+// deposits and withdraws are not counted.
+func (d *DB) AverageTransfer(fromUser int) (*big.Rat, int, error) {
+	var n int
+	var sum money.Money
+	err := d.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM records WHERE from_user=$1 AND to_user<>$1",
+		fromUser).Scan(&n, &sum)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "sum records")
+	}
+	if n == 0 {
+		return new(big.Rat), 0, nil
+	}
+	avg := new(big.Rat).Quo(sum.Rat(), big.NewRat(int64(n), 1))
+	return avg, n, nil
+}
+
+// TransfersSince counts the transfers sent by the user since the given time.
+func (d *DB) TransfersSince(fromUser int, since time.Time) (int, error) {
+	var n int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM records WHERE from_user=$1 AND to_user<>$1 AND created_at>=$2",
+		fromUser, dbTime(since)).Scan(&n)
+	if err != nil {
+		return 0, errors.Wrap(err, "count records")
+	}
+	return n, nil
+}
+
+// AddRiskDecision persists the outcome of a risk evaluation. Flagged transfers enter the
+// review queue as pending.
+func (d *DB) AddRiskDecision(fromUser, toUser int, amount money.Money, action string, reasons []string) (*RiskDecision, error) {
+	status := ReviewNone
+	if action == riskActionFlag {
+		status = ReviewPending
+	}
+	r := RiskDecision{
+		FromUser:     fromUser,
+		ToUser:       toUser,
+		Amount:       amount,
+		Action:       action,
+		Reasons:      reasons,
+		ReviewStatus: status,
+		CreatedAt:    now(),
+	}
+	err := d.db.QueryRow(`INSERT INTO risk_decisions (from_user, to_user, amount, action, reasons, review_status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		fromUser, toUser, amount, action, strings.Join(reasons, "\n"), status, r.CreatedAt).Scan(&r.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "insert risk decision")
+	}
+	return &r, nil
+}
+
+// RiskDecisions lists decisions with the given review status, oldest first.
+func (d *DB) RiskDecisions(reviewStatus string) ([]RiskDecision, error) {
+	rows, err := d.db.Query(`SELECT id, from_user, to_user, amount, action, reasons, review_status, reviewer, review_note,
+		created_at, reviewed_at FROM risk_decisions WHERE review_status=$1 ORDER BY id`, reviewStatus)
+	if err != nil {
+		return nil, errors.Wrap(err, "query risk decisions")
+	}
+	defer rows.Close()
+
+	var res []RiskDecision
+	for rows.Next() {
+		r, err := scanRiskDecision(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *r)
+	}
+	return res, rows.Err()
+}
+
+// ReviewRiskDecision resolves a pending decision in the review queue.
+func (d *DB) ReviewRiskDecision(id int, status, reviewer, note string) (*RiskDecision, error) {
+	if status != ReviewApproved && status != ReviewRejected {
+		return nil, errors.Errorf("review status should be %s or %s: %s", ReviewApproved, ReviewRejected, status)
+	}
+	res, err := d.db.Exec(`UPDATE risk_decisions SET review_status=$1, reviewer=$2, review_note=$3, reviewed_at=$4
+		WHERE id=$5 AND review_status=$6`, status, reviewer, note, now(), id, ReviewPending)
+	if err != nil {
+		return nil, errors.Wrap(err, "update risk decision")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, errors.Errorf("no pending review with id %d", id)
+	}
+	row := d.db.QueryRow(`SELECT id, from_user, to_user, amount, action, reasons, review_status, reviewer, review_note,
+		created_at, reviewed_at FROM risk_decisions WHERE id=$1`, id)
+	return scanRiskDecision(row)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRiskDecision(row scanner) (*RiskDecision, error) {
+	var r RiskDecision
+	var reasons string
+	var reviewedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.FromUser, &r.ToUser, &r.Amount, &r.Action, &reasons, &r.ReviewStatus, &r.Reviewer,
+		&r.ReviewNote, &r.CreatedAt, &reviewedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "scan risk decision")
+	}
+	if reasons != "" {
+		r.Reasons = strings.Split(reasons, "\n")
+	}
+	if reviewedAt.Valid {
+		r.ReviewedAt = &reviewedAt.Time
+	}
+	return &r, nil
+}
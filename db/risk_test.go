@@ -0,0 +1,79 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_RiskHistory(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	u2, _ := db.AddUser("test2", money.MustParse("100"))
+
+	ok, err := db.HasTransferred(u1.ID, u2.ID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	avg, n, err := db.AverageTransfer(u1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, avg.Sign())
+
+	_, err = db.WithdrawOrDeposit(u1.ID, money.MustParse("50"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Transfer(u1.ID, u2.ID, money.MustParse("10")))
+	assert.Nil(t, db.Transfer(u1.ID, u2.ID, money.MustParse("20")))
+
+	ok, err = db.HasTransferred(u1.ID, u2.ID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	avg, n, err = db.AverageTransfer(u1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "15.00", avg.FloatString(2))
+
+	cnt, err := db.TransfersSince(u1.ID, time.Now().Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, cnt)
+	cnt, err = db.TransfersSince(u1.ID, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, cnt)
+}
+
+func TestDB_RiskDecisions(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+
+	r, err := db.AddRiskDecision(1, 2, money.MustParse("100"), "flag", []string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, ReviewPending, r.ReviewStatus)
+	_, err = db.AddRiskDecision(1, 2, money.MustParse("100"), "block", []string{"c"})
+	assert.Nil(t, err)
+
+	pending, err := db.RiskDecisions(ReviewPending)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+	assert.Equal(t, []string{"a", "b"}, pending[0].Reasons)
+	assert.Nil(t, pending[0].ReviewedAt)
+
+	_, err = db.ReviewRiskDecision(r.ID, "unknown", "ops", "")
+	assert.NotNil(t, err)
+	r, err = db.ReviewRiskDecision(r.ID, ReviewApproved, "ops", "known customer")
+	assert.Nil(t, err)
+	assert.Equal(t, ReviewApproved, r.ReviewStatus)
+	assert.Equal(t, "ops", r.Reviewer)
+	assert.NotNil(t, r.ReviewedAt)
+
+	//already reviewed
+	_, err = db.ReviewRiskDecision(r.ID, ReviewRejected, "ops", "")
+	assert.NotNil(t, err)
+
+	pending, err = db.RiskDecisions(ReviewPending)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pending))
+}
@@ -1,7 +1,6 @@
 CREATE TABLE IF NOT EXISTS "users" (
 	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
 	"name" CHAR(256) NOT NULL UNIQUE,
-	"balance" INTEGER NOT NULL,
 	PRIMARY KEY("id")
 );
 
@@ -10,6 +9,293 @@ CREATE TABLE IF NOT EXISTS "records" (
 	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
 	"from_user" INTEGER NOT NULL,
 	"to_user" INTEGER NOT NULL,
-	"amount" INTEGER NOT NULL,
+	"amount" BIGINT NOT NULL,
 	PRIMARY KEY("id")
 );
+
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "status" VARCHAR(16) NOT NULL DEFAULT 'active';
+
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "tier" VARCHAR(32) NOT NULL DEFAULT 'standard';
+
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "metadata" TEXT;
+
+ALTER TABLE "records" ADD COLUMN IF NOT EXISTS "created_at" TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS "records_from_user_created_at" ON "records" ("from_user", "created_at");
+
+
+CREATE TABLE IF NOT EXISTS "accounts" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"user_id" INTEGER NOT NULL,
+	"name" VARCHAR(64) NOT NULL,
+	"balance" BIGINT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL DEFAULT now(),
+	PRIMARY KEY("id"),
+	UNIQUE("user_id", "name")
+);
+
+ALTER TABLE "accounts" ADD COLUMN IF NOT EXISTS "opening_balance" BIGINT;
+ALTER TABLE "records" ADD COLUMN IF NOT EXISTS "from_account" INTEGER;
+ALTER TABLE "records" ADD COLUMN IF NOT EXISTS "to_account" INTEGER;
+
+-- users created before accounts existed kept their balance in users.balance,
+-- move it to their main account and point their records at it. Users have no creation
+-- time, their main account is opened at their first record.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='users' AND column_name='balance') THEN
+		INSERT INTO "accounts" ("user_id", "name", "balance", "created_at") SELECT u."id", 'main', u."balance",
+			COALESCE((SELECT MIN(r."created_at") FROM "records" r WHERE r."from_user"=u."id" OR r."to_user"=u."id"), now())
+			FROM "users" u;
+		UPDATE "records" r SET "from_account"=a."id" FROM "accounts" a WHERE a."user_id"=r."from_user" AND a."name"='main';
+		UPDATE "records" r SET "to_account"=a."id" FROM "accounts" a WHERE a."user_id"=r."to_user" AND a."name"='main';
+		ALTER TABLE "users" DROP COLUMN "balance";
+	END IF;
+END $$;
+
+-- accounts opened before opening balances were kept are assumed to be reconciled
+-- when the column is added.
+UPDATE "accounts" a SET "opening_balance" = a."balance" - COALESCE((SELECT SUM(CASE WHEN r."to_account"=a."id" THEN r."amount" ELSE -r."amount" END)
+	FROM "records" r WHERE r."from_account"=a."id" OR r."to_account"=a."id"), 0) WHERE a."opening_balance" IS NULL;
+
+
+CREATE TABLE IF NOT EXISTS "risk_decisions" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"from_user" INTEGER NOT NULL,
+	"to_user" INTEGER NOT NULL,
+	"amount" BIGINT NOT NULL,
+	"action" VARCHAR(16) NOT NULL,
+	"reasons" TEXT NOT NULL,
+	"review_status" VARCHAR(16) NOT NULL,
+	"reviewer" VARCHAR(256) NOT NULL DEFAULT '',
+	"review_note" TEXT NOT NULL DEFAULT '',
+	"created_at" TIMESTAMP NOT NULL,
+	"reviewed_at" TIMESTAMP,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "user_status_changes" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"user_id" INTEGER NOT NULL,
+	"from_status" VARCHAR(16) NOT NULL,
+	"to_status" VARCHAR(16) NOT NULL,
+	"operator" VARCHAR(256) NOT NULL,
+	"reason" TEXT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "batches" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"idempotency_key" VARCHAR(256) NOT NULL,
+	"request_hash" VARCHAR(64) NOT NULL,
+	"from_account" INTEGER NOT NULL,
+	"total" BIGINT NOT NULL,
+	"legs" TEXT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("from_account", "idempotency_key")
+);
+
+
+CREATE TABLE IF NOT EXISTS "balance_snapshots" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"account_id" INTEGER NOT NULL,
+	"record_id" INTEGER NOT NULL,
+	"balance" BIGINT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+CREATE INDEX IF NOT EXISTS "balance_snapshots_account_record" ON "balance_snapshots" ("account_id", "record_id");
+
+
+CREATE TABLE IF NOT EXISTS "reconciliations" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"accounts" INTEGER NOT NULL,
+	"mismatches" TEXT NOT NULL,
+	"total_balance" BIGINT NOT NULL,
+	"net_deposits" BIGINT NOT NULL,
+	"ok" BOOLEAN NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+
+-- every record carries its position in the audit chain, the hash of the record before it
+-- and its own hash. Records written before are chained when the server starts.
+ALTER TABLE "records" ADD COLUMN IF NOT EXISTS "seq" BIGINT UNIQUE;
+ALTER TABLE "records" ADD COLUMN IF NOT EXISTS "prev_hash" VARCHAR(64);
+ALTER TABLE "records" ADD COLUMN IF NOT EXISTS "hash" VARCHAR(64);
+
+
+CREATE TABLE IF NOT EXISTS "audit_head" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"seq" BIGINT NOT NULL,
+	"hash" VARCHAR(64) NOT NULL,
+	PRIMARY KEY("id")
+);
+
+INSERT INTO "audit_head" ("id", "seq", "hash") VALUES (1, 0, '') ON CONFLICT DO NOTHING;
+
+
+CREATE TABLE IF NOT EXISTS "outbox_events" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"type" VARCHAR(64) NOT NULL,
+	"payload" TEXT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	"sent_at" TIMESTAMP,
+	PRIMARY KEY("id")
+);
+
+CREATE INDEX IF NOT EXISTS "outbox_events_pending" ON "outbox_events" ("id") WHERE "sent_at" IS NULL;
+
+-- leases make one instance at a time run a job, eg. dispatch the outbox.
+CREATE TABLE IF NOT EXISTS "leases" (
+	"name" VARCHAR(64) NOT NULL,
+	"holder" VARCHAR(32) NOT NULL,
+	"expires_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("name")
+);
+
+
+CREATE TABLE IF NOT EXISTS "webhooks" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"url" TEXT NOT NULL,
+	"secret" VARCHAR(256) NOT NULL,
+	"event_types" TEXT NOT NULL,
+	"active" BOOLEAN NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"webhook_id" INTEGER NOT NULL,
+	"event_id" INTEGER NOT NULL,
+	"event_type" VARCHAR(64) NOT NULL,
+	"payload" TEXT NOT NULL,
+	"event_at" TIMESTAMP NOT NULL,
+	"status" VARCHAR(16) NOT NULL,
+	"attempts" INTEGER NOT NULL,
+	"next_attempt_at" TIMESTAMP NOT NULL,
+	"last_error" TEXT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("webhook_id", "event_id")
+);
+
+CREATE INDEX IF NOT EXISTS "webhook_deliveries_due" ON "webhook_deliveries" ("status", "next_attempt_at");
+
+
+CREATE TABLE IF NOT EXISTS "webhook_attempts" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"delivery_id" INTEGER NOT NULL,
+	"status_code" INTEGER NOT NULL,
+	"response" TEXT NOT NULL,
+	"error" TEXT NOT NULL,
+	"duration_ms" BIGINT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+CREATE INDEX IF NOT EXISTS "webhook_attempts_delivery" ON "webhook_attempts" ("delivery_id");
+
+
+CREATE TABLE IF NOT EXISTS "api_keys" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"user_id" INTEGER NOT NULL,
+	"key_hash" VARCHAR(64) NOT NULL UNIQUE,
+	"created_at" TIMESTAMP NOT NULL,
+	"revoked_at" TIMESTAMP,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "idempotency_keys" (
+	"key" VARCHAR(256) NOT NULL,
+	"route" VARCHAR(256) NOT NULL,
+	"request_hash" VARCHAR(64) NOT NULL,
+	"response" TEXT,
+	"created_at" TIMESTAMP NOT NULL,
+	"holder" VARCHAR(32),
+	PRIMARY KEY("route", "key")
+);
+
+CREATE INDEX IF NOT EXISTS "idempotency_keys_created_at" ON "idempotency_keys" ("created_at");
+
+ALTER TABLE "idempotency_keys" ADD COLUMN IF NOT EXISTS "holder" VARCHAR(32);
+
+-- idempotency keys used to be unique across routes, they are scoped to their route now.
+DO $$
+BEGIN
+	IF (SELECT COUNT(*) FROM information_schema.key_column_usage
+		WHERE table_name='idempotency_keys' AND constraint_name='idempotency_keys_pkey') = 1 THEN
+		ALTER TABLE "idempotency_keys" DROP CONSTRAINT "idempotency_keys_pkey";
+		ALTER TABLE "idempotency_keys" ADD PRIMARY KEY ("route", "key");
+	END IF;
+END $$;
+
+
+CREATE TABLE IF NOT EXISTS "rate_limits" (
+	"key" VARCHAR(512) NOT NULL,
+	"tokens" DOUBLE PRECISION NOT NULL,
+	"updated_at" BIGINT NOT NULL,
+	PRIMARY KEY("key")
+);
+
+
+CREATE TABLE IF NOT EXISTS "interest_rates" (
+	"account_id" INTEGER NOT NULL,
+	"rate" VARCHAR(64) NOT NULL,
+	"updated_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("account_id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "interest_accruals" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"account_id" INTEGER NOT NULL,
+	"day" VARCHAR(10) NOT NULL,
+	"balance" BIGINT NOT NULL,
+	"rate" VARCHAR(64) NOT NULL,
+	"amount" TEXT NOT NULL,
+	"posting_id" INTEGER,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("account_id", "day")
+);
+
+CREATE INDEX IF NOT EXISTS "interest_accruals_unposted" ON "interest_accruals" ("day") WHERE "posting_id" IS NULL;
+
+
+CREATE TABLE IF NOT EXISTS "interest_postings" (
+	"id" INTEGER NOT NULL UNIQUE GENERATED BY DEFAULT AS IDENTITY,
+	"account_id" INTEGER NOT NULL,
+	"month" VARCHAR(7) NOT NULL,
+	"accrued" TEXT NOT NULL,
+	"amount" BIGINT NOT NULL,
+	"carry" TEXT NOT NULL,
+	"record_id" INTEGER,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("account_id", "month")
+);
+
+
+-- amounts used to be 32-bit INTEGER cents, which overflow past 21 million. Widen the columns
+-- of existing databases to BIGINT, columns already widened are left alone.
+DO $$
+DECLARE
+	c RECORD;
+BEGIN
+	FOR c IN SELECT table_name, column_name FROM information_schema.columns WHERE data_type='integer' AND
+		(table_name, column_name) IN (('records', 'amount'), ('accounts', 'balance'), ('accounts', 'opening_balance'),
+			('risk_decisions', 'amount'), ('batches', 'total'), ('balance_snapshots', 'balance'))
+	LOOP
+		EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE BIGINT', c.table_name, c.column_name);
+	END LOOP;
+END $$;
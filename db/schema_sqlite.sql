@@ -0,0 +1,243 @@
+CREATE TABLE IF NOT EXISTS "users" (
+	"id" INTEGER NOT NULL UNIQUE ,
+	"name" CHAR(256) NOT NULL UNIQUE,
+	"status" VARCHAR(16) NOT NULL DEFAULT 'active',
+	"tier" VARCHAR(32) NOT NULL DEFAULT 'standard',
+	"metadata" TEXT,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "records" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"from_user" INTEGER NOT NULL,
+	"to_user" INTEGER NOT NULL,
+	"from_account" INTEGER NOT NULL,
+	"to_account" INTEGER NOT NULL,
+	"amount" BIGINT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	"seq" BIGINT UNIQUE,
+	"prev_hash" VARCHAR(64),
+	"hash" VARCHAR(64),
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "accounts" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"user_id" INTEGER NOT NULL,
+	"name" VARCHAR(64) NOT NULL,
+	"balance" BIGINT NOT NULL,
+	"opening_balance" BIGINT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("user_id", "name")
+);
+
+
+CREATE TABLE IF NOT EXISTS "risk_decisions" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"from_user" INTEGER NOT NULL,
+	"to_user" INTEGER NOT NULL,
+	"amount" BIGINT NOT NULL,
+	"action" VARCHAR(16) NOT NULL,
+	"reasons" TEXT NOT NULL,
+	"review_status" VARCHAR(16) NOT NULL,
+	"reviewer" VARCHAR(256) NOT NULL DEFAULT '',
+	"review_note" TEXT NOT NULL DEFAULT '',
+	"created_at" TIMESTAMP NOT NULL,
+	"reviewed_at" TIMESTAMP,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "user_status_changes" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"user_id" INTEGER NOT NULL,
+	"from_status" VARCHAR(16) NOT NULL,
+	"to_status" VARCHAR(16) NOT NULL,
+	"operator" VARCHAR(256) NOT NULL,
+	"reason" TEXT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "batches" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"idempotency_key" VARCHAR(256) NOT NULL,
+	"request_hash" VARCHAR(64) NOT NULL,
+	"from_account" INTEGER NOT NULL,
+	"total" BIGINT NOT NULL,
+	"legs" TEXT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("from_account", "idempotency_key")
+);
+
+
+CREATE TABLE IF NOT EXISTS "balance_snapshots" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"account_id" INTEGER NOT NULL,
+	"record_id" INTEGER NOT NULL,
+	"balance" BIGINT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+CREATE INDEX IF NOT EXISTS "balance_snapshots_account_record" ON "balance_snapshots" ("account_id", "record_id");
+
+
+CREATE TABLE IF NOT EXISTS "reconciliations" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"accounts" INTEGER NOT NULL,
+	"mismatches" TEXT NOT NULL,
+	"total_balance" BIGINT NOT NULL,
+	"net_deposits" BIGINT NOT NULL,
+	"ok" BOOLEAN NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "audit_head" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"seq" BIGINT NOT NULL,
+	"hash" VARCHAR(64) NOT NULL,
+	PRIMARY KEY("id")
+);
+
+INSERT INTO "audit_head" ("id", "seq", "hash") VALUES (1, 0, '') ON CONFLICT DO NOTHING;
+
+
+CREATE TABLE IF NOT EXISTS "outbox_events" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"type" VARCHAR(64) NOT NULL,
+	"payload" TEXT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	"sent_at" TIMESTAMP,
+	PRIMARY KEY("id")
+);
+
+CREATE INDEX IF NOT EXISTS "outbox_events_pending" ON "outbox_events" ("id") WHERE "sent_at" IS NULL;
+
+-- leases make one instance at a time run a job, eg. dispatch the outbox.
+CREATE TABLE IF NOT EXISTS "leases" (
+	"name" VARCHAR(64) NOT NULL,
+	"holder" VARCHAR(32) NOT NULL,
+	"expires_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("name")
+);
+
+
+CREATE TABLE IF NOT EXISTS "webhooks" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"url" TEXT NOT NULL,
+	"secret" VARCHAR(256) NOT NULL,
+	"event_types" TEXT NOT NULL,
+	"active" BOOLEAN NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"webhook_id" INTEGER NOT NULL,
+	"event_id" INTEGER NOT NULL,
+	"event_type" VARCHAR(64) NOT NULL,
+	"payload" TEXT NOT NULL,
+	"event_at" TIMESTAMP NOT NULL,
+	"status" VARCHAR(16) NOT NULL,
+	"attempts" INTEGER NOT NULL,
+	"next_attempt_at" TIMESTAMP NOT NULL,
+	"last_error" TEXT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("webhook_id", "event_id")
+);
+
+CREATE INDEX IF NOT EXISTS "webhook_deliveries_due" ON "webhook_deliveries" ("status", "next_attempt_at");
+
+
+CREATE TABLE IF NOT EXISTS "webhook_attempts" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"delivery_id" INTEGER NOT NULL,
+	"status_code" INTEGER NOT NULL,
+	"response" TEXT NOT NULL,
+	"error" TEXT NOT NULL,
+	"duration_ms" BIGINT NOT NULL,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id")
+);
+
+CREATE INDEX IF NOT EXISTS "webhook_attempts_delivery" ON "webhook_attempts" ("delivery_id");
+
+
+CREATE TABLE IF NOT EXISTS "api_keys" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"user_id" INTEGER NOT NULL,
+	"key_hash" VARCHAR(64) NOT NULL UNIQUE,
+	"created_at" TIMESTAMP NOT NULL,
+	"revoked_at" TIMESTAMP,
+	PRIMARY KEY("id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "idempotency_keys" (
+	"key" VARCHAR(256) NOT NULL,
+	"route" VARCHAR(256) NOT NULL,
+	"request_hash" VARCHAR(64) NOT NULL,
+	"response" TEXT,
+	"created_at" TIMESTAMP NOT NULL,
+	"holder" VARCHAR(32),
+	PRIMARY KEY("route", "key")
+);
+
+CREATE INDEX IF NOT EXISTS "idempotency_keys_created_at" ON "idempotency_keys" ("created_at");
+
+
+CREATE TABLE IF NOT EXISTS "rate_limits" (
+	"key" VARCHAR(512) NOT NULL,
+	"tokens" REAL NOT NULL,
+	"updated_at" BIGINT NOT NULL,
+	PRIMARY KEY("key")
+);
+
+
+CREATE TABLE IF NOT EXISTS "interest_rates" (
+	"account_id" INTEGER NOT NULL,
+	"rate" VARCHAR(64) NOT NULL,
+	"updated_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("account_id")
+);
+
+
+CREATE TABLE IF NOT EXISTS "interest_accruals" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"account_id" INTEGER NOT NULL,
+	"day" VARCHAR(10) NOT NULL,
+	"balance" BIGINT NOT NULL,
+	"rate" VARCHAR(64) NOT NULL,
+	"amount" TEXT NOT NULL,
+	"posting_id" INTEGER,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("account_id", "day")
+);
+
+CREATE INDEX IF NOT EXISTS "interest_accruals_unposted" ON "interest_accruals" ("day") WHERE "posting_id" IS NULL;
+
+
+CREATE TABLE IF NOT EXISTS "interest_postings" (
+	"id" INTEGER NOT NULL UNIQUE,
+	"account_id" INTEGER NOT NULL,
+	"month" VARCHAR(7) NOT NULL,
+	"accrued" TEXT NOT NULL,
+	"amount" BIGINT NOT NULL,
+	"carry" TEXT NOT NULL,
+	"record_id" INTEGER,
+	"created_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("account_id", "month")
+);
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// effectSum sums the balance changes of the account's records, see Record.Effect.
+const effectSum = "SELECT COALESCE(SUM(CASE WHEN to_account=$1 THEN amount ELSE -amount END), 0) FROM records"
+
+// SnapshotBalances saves the balance of every account that changed since its last snapshot,
+// together with the last record id at that time. Snapshots make balance history queries
+// replay only the records after them.
+func (d *DB) SnapshotBalances() (int, error) {
+	res, err := d.db.Exec(`INSERT INTO balance_snapshots (account_id, record_id, balance, created_at)
+		SELECT a.id, (SELECT COALESCE(MAX(id), 0) FROM records), a.balance, $1 FROM accounts a
+		WHERE EXISTS (SELECT 1 FROM records r WHERE (r.from_account=a.id OR r.to_account=a.id)
+			AND r.id > COALESCE((SELECT MAX(s.record_id) FROM balance_snapshots s WHERE s.account_id=a.id), 0))`, now())
+	if err != nil {
+		return 0, errors.Wrap(err, "insert snapshots")
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// BalanceAtRecord returns the balance of the account right after the record with the id,
+// records of other accounts count too, so any record id can be used as a point in time.
+func (d *DB) BalanceAtRecord(accountID, recordID int) (money.Money, error) {
+	tx, err := d.db.BeginTx(context.Background(), d.snapshot)
+	if err != nil {
+		return 0, errors.Wrap(err, "create tx")
+	}
+	//nothing was written, there is nothing to commit
+	defer func() { _ = tx.Rollback() }()
+	return balanceAtRecord(tx, accountID, recordID)
+}
+
+// balanceAtRecord reads the snapshot, the records and the current balance in the one
+// transaction, so that a transfer committed meanwhile is seen by all or none of them.
+func balanceAtRecord(tx *sql.Tx, accountID, recordID int) (money.Money, error) {
+	var snapRecord int
+	var snapBalance money.Money
+	err := tx.QueryRow(`SELECT record_id, balance FROM balance_snapshots WHERE account_id=$1 AND record_id<=$2
+		ORDER BY record_id DESC LIMIT 1`, accountID, recordID).Scan(&snapRecord, &snapBalance)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.Wrap(err, "query snapshot")
+	}
+
+	var sum money.Money
+	if err == nil {
+		//replay the records after the snapshot
+		err = tx.QueryRow(effectSum+" WHERE (from_account=$1 OR to_account=$1) AND id>$2 AND id<=$3",
+			accountID, snapRecord, recordID).Scan(&sum)
+		if err != nil {
+			return 0, errors.Wrap(err, "sum records")
+		}
+		return snapBalance.Add(sum)
+	}
+
+	//no snapshot that old, undo the records after it from the current balance
+	a, err := getAccount(tx, accountID)
+	if err != nil {
+		return 0, errors.Wrap(err, "get account")
+	}
+	err = tx.QueryRow(effectSum+" WHERE (from_account=$1 OR to_account=$1) AND id>$2", accountID, recordID).Scan(&sum)
+	if err != nil {
+		return 0, errors.Wrap(err, "sum records")
+	}
+	return a.Balance.Sub(sum)
+}
+
+// BalanceAt returns the balance of the account at the time, along with the id of the last
+// record at that time. Accounts opened later have a zero balance.
+func (d *DB) BalanceAt(accountID int, at time.Time) (money.Money, int, error) {
+	tx, err := d.db.BeginTx(context.Background(), d.snapshot)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "create tx")
+	}
+	defer func() { _ = tx.Rollback() }()
+	a, err := getAccount(tx, accountID)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "get account")
+	}
+	if a.CreatedAt.After(at) {
+		return 0, 0, nil
+	}
+	var recordID int
+	err = tx.QueryRow("SELECT COALESCE(MAX(id), 0) FROM records WHERE created_at<=$1", dbTime(at)).Scan(&recordID)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "query record")
+	}
+	b, err := balanceAtRecord(tx, accountID, recordID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return b, recordID, nil
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_BalanceAtRecord(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	u2, _ := db.AddUser("test2", money.MustParse("100"))
+
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("10")) //record 1: 110
+	_ = db.Transfer(u1.ID, u2.ID, money.MustParse("30"))      //record 2: 80
+	_, _ = db.WithdrawOrDeposit(u2.ID, money.MustParse("1"))  //record 3: 80
+
+	expected := []string{"100.00", "110.00", "80.00", "80.00"}
+	check := func() {
+		for i, e := range expected {
+			b, err := db.BalanceAtRecord(u1.MainAccount, i)
+			assert.Nil(t, err)
+			assert.Equal(t, e, b.String(), "record %d", i)
+		}
+	}
+	//no snapshot, undo records from the current balance
+	check()
+
+	n, err := db.SnapshotBalances()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	//nothing changed since
+	n, err = db.SnapshotBalances()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("-5")) //record 4: 75
+	_ = db.Transfer(u2.ID, u1.ID, money.MustParse("20"))      //record 5: 95
+	expected = append(expected, "75.00", "95.00")
+	//records after the snapshot are replayed on top of it
+	check()
+
+	n, err = db.SnapshotBalances()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	check()
+
+	_, err = db.BalanceAtRecord(9999, 1)
+	assert.NotNil(t, err)
+}
+
+func TestDB_BalanceAt(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	_, _ = db.WithdrawOrDeposit(u1.ID, money.MustParse("10"))
+
+	b, id, err := db.BalanceAt(u1.MainAccount, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "110.00", b.String())
+	assert.Equal(t, 1, id)
+
+	//before the account existed
+	b, id, err = db.BalanceAt(u1.MainAccount, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, b.Sign())
+	assert.Equal(t, 0, id)
+
+	_, _, err = db.BalanceAt(9999, time.Now())
+	assert.NotNil(t, err)
+}
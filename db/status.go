@@ -0,0 +1,178 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	StatusActive = "active"
+	StatusFrozen = "frozen"
+	StatusClosed = "closed"
+)
+
+// statusTransitions lists the allowed status changes, closed is final.
+var statusTransitions = map[string][]string{
+	StatusActive: {StatusFrozen, StatusClosed},
+	StatusFrozen: {StatusActive},
+}
+
+// ErrStatusConflict is returned when the status of the user changed while it was being set.
+var ErrStatusConflict = errors.New("user status changed concurrently")
+
+type StatusChange struct {
+	ID         int
+	UserID     int
+	FromStatus string
+	ToStatus   string
+	Operator   string
+	Reason     string
+	CreatedAt  time.Time
+}
+
+// canSend reports whether money can leave the user's balance, only active users can send.
+func (u *User) canSend() error {
+	if u.Status != StatusActive {
+		return errors.Errorf("user %d is %s, cannot send money", u.ID, u.Status)
+	}
+	return nil
+}
+
+// canReceive reports whether money can arrive in the user's balance, frozen users still can.
+func (u *User) canReceive() error {
+	if u.Status == StatusClosed {
+		return errors.Errorf("user %d is %s, cannot receive money", u.ID, u.Status)
+	}
+	return nil
+}
+
+// statusCheck reads the status of the user again inside the transaction moving money and
+// checks it, eg. with (*User).canSend. The user stays locked until the transaction ends, so
+// its status cannot change before the money moved is committed.
+func (d *DB) statusCheck(userID int, check func(*User) error) Statement {
+	return Statement{exec: func(tx *sql.Tx) error {
+		u, err := d.lockStatus(tx, userID)
+		if err != nil {
+			return err
+		}
+		return check(u)
+	}}
+}
+
+// lockStatus reads the status of the user in the transaction, locking the user until it ends.
+func (d *DB) lockStatus(tx *sql.Tx, userID int) (*User, error) {
+	u := User{ID: userID}
+	err := tx.QueryRow("SELECT status FROM users WHERE id=$1"+d.lock(" FOR SHARE"), userID).Scan(&u.Status)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get user %d", userID)
+	}
+	return &u, nil
+}
+
+func canTransit(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetUserStatus moves the user to a new status, recording who did it and why.
+// Closing requires a zero balance.
+func (d *DB) SetUserStatus(id int, status, operator, reason string) (*User, error) {
+	u, err := getUser(d.db, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "get user")
+	}
+	if !canTransit(u.Status, status) {
+		return nil, errors.Errorf("cannot change user status from %s to %s", u.Status, status)
+	}
+	if operator == "" || reason == "" {
+		return nil, errors.Errorf("operator and reason are required to change user status")
+	}
+
+	statements := []Statement{statusStatement(id, u.Status, status)}
+	if status == StatusClosed {
+		//checked once the user is locked by the update, money moving waits for it
+		statements = append(statements, d.zeroBalanceCheck(id))
+	}
+	statements = append(statements, Statement{
+		S: `INSERT INTO user_status_changes (user_id, from_status, to_status, operator, reason, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+		Args: []interface{}{id, u.Status, status, operator, reason, now()},
+	})
+	if err := d.transaction(statements); err != nil {
+		return nil, errors.Wrap(err, "transaction")
+	}
+	return d.GetUser(id)
+}
+
+// zeroBalanceCheck fails unless every account of the user is empty, the accounts are locked
+// until the transaction ends.
+func (d *DB) zeroBalanceCheck(id int) Statement {
+	return Statement{exec: func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT name, balance FROM accounts WHERE user_id=$1 ORDER BY id"+d.lock(" FOR UPDATE"), id)
+		if err != nil {
+			return errors.Wrap(err, "query accounts")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			var balance money.Money
+			if err := rows.Scan(&name, &balance); err != nil {
+				return errors.Wrap(err, "scan account")
+			}
+			if balance.Sign() != 0 {
+				return errors.Errorf("cannot close user with balance %s in account %s", balance, name)
+			}
+		}
+		return rows.Err()
+	}}
+}
+
+// statusStatement moves the user from one status to another, failing with ErrStatusConflict
+// when the user is no longer in the status the change was decided on.
+func statusStatement(id int, from, to string) Statement {
+	return Statement{
+		exec: func(tx *sql.Tx) error {
+			res, err := tx.Exec("UPDATE users SET status=$1 WHERE id=$2 AND status=$3", to, id, from)
+			if err != nil {
+				return errors.Wrap(err, "update status")
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return errors.Wrap(err, "update status")
+			}
+			if n != 1 {
+				return errors.Wrapf(ErrStatusConflict, "user %d is no longer %s", id, from)
+			}
+			return nil
+		},
+		users: []int{id},
+	}
+}
+
+// StatusChanges returns the status history of the user, oldest first.
+func (d *DB) StatusChanges(userID int) ([]StatusChange, error) {
+	rows, err := d.db.Query(`SELECT id, user_id, from_status, to_status, operator, reason, created_at
+		FROM user_status_changes WHERE user_id=$1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query status changes")
+	}
+	defer rows.Close()
+
+	var res []StatusChange
+	for rows.Next() {
+		var c StatusChange
+		err := rows.Scan(&c.ID, &c.UserID, &c.FromStatus, &c.ToStatus, &c.Operator, &c.Reason, &c.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan status change")
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
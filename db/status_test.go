@@ -0,0 +1,73 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_SetUserStatus(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	u1, _ := db.AddUser("test1", money.MustParse("100"))
+	u2, _ := db.AddUser("test2", money.MustParse("100"))
+	assert.Equal(t, StatusActive, u1.Status)
+
+	_, err = db.SetUserStatus(u1.ID, StatusFrozen, "", "")
+	assert.NotNil(t, err)
+	_, err = db.SetUserStatus(9999, StatusFrozen, "ops", "test")
+	assert.NotNil(t, err)
+
+	//a change decided on a status that changed since fails
+	err = db.transaction([]Statement{statusStatement(u1.ID, StatusFrozen, StatusActive)})
+	assert.True(t, errors.Is(err, ErrStatusConflict))
+
+	u, err := db.SetUserStatus(u1.ID, StatusFrozen, "ops", "suspicious activity")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusFrozen, u.Status)
+
+	//the status is read again in the transaction moving the money
+	err = db.transaction([]Statement{db.statusCheck(u1.ID, (*User).canSend)})
+	assert.NotNil(t, err)
+	assert.Nil(t, db.transaction([]Statement{db.statusCheck(u1.ID, (*User).canReceive)}))
+
+	//frozen users can receive but not send
+	assert.NotNil(t, db.Transfer(u1.ID, u2.ID, money.MustParse("1")))
+	assert.Nil(t, db.Transfer(u2.ID, u1.ID, money.MustParse("1")))
+	_, err = db.WithdrawOrDeposit(u1.ID, money.MustParse("-1"))
+	assert.NotNil(t, err)
+	_, err = db.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+	assert.Nil(t, err)
+
+	//frozen cannot be closed, active with balance neither
+	assert.NotNil(t, db.transaction([]Statement{db.zeroBalanceCheck(u1.ID)}))
+	_, err = db.SetUserStatus(u1.ID, StatusClosed, "ops", "customer request")
+	assert.NotNil(t, err)
+	_, err = db.SetUserStatus(u1.ID, StatusActive, "ops", "cleared")
+	assert.Nil(t, err)
+	_, err = db.SetUserStatus(u1.ID, StatusClosed, "ops", "customer request")
+	assert.NotNil(t, err)
+
+	_, err = db.WithdrawOrDeposit(u1.ID, money.MustParse("-102"))
+	assert.Nil(t, err)
+	u, err = db.SetUserStatus(u1.ID, StatusClosed, "ops", "customer request")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusClosed, u.Status)
+
+	//closed users can neither send nor receive, and stay closed
+	assert.NotNil(t, db.Transfer(u2.ID, u1.ID, money.MustParse("1")))
+	_, err = db.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+	assert.NotNil(t, err)
+	_, err = db.SetUserStatus(u1.ID, StatusActive, "ops", "reopen")
+	assert.NotNil(t, err)
+
+	changes, err := db.StatusChanges(u1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(changes))
+	assert.Equal(t, StatusFrozen, changes[0].ToStatus)
+	assert.Equal(t, "suspicious activity", changes[0].Reason)
+	assert.Equal(t, StatusClosed, changes[2].ToStatus)
+}
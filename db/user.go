@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Limits of user names and metadata.
+const (
+	MaxNameLength    = 256
+	MaxMetadataKeys  = 50
+	MaxMetadataKey   = 40
+	MaxMetadataValue = 500
+)
+
+const systemUserPrefix = "_"
+
+// userSelectColumns are the columns scanUser reads.
+const userSelectColumns = "u.id, u.name, u.status, u.tier, u.metadata, a.id, a.balance"
+
+// CheckUserName checks a name given to a user. Names starting with _ are kept for the
+// system users, eg. InterestUser and FeeUser.
+func CheckUserName(name string) error {
+	if strings.TrimSpace(name) != name {
+		return errors.Errorf("name should not start or end with spaces: %q", name)
+	}
+	if name == "" || len(name) > MaxNameLength {
+		return errors.Errorf("name should be 1 to %d characters", MaxNameLength)
+	}
+	if strings.HasPrefix(name, systemUserPrefix) {
+		return errors.Errorf("names starting with %s are reserved: %q", systemUserPrefix, name)
+	}
+	return nil
+}
+
+// scanUser scans the userSelectColumns of a user joined with its main account.
+func scanUser(row scanner) (*User, error) {
+	var u User
+	var metadata sql.NullString
+	err := row.Scan(&u.ID, &u.Name, &u.Status, &u.Tier, &metadata, &u.MainAccount, &u.Balance)
+	if err != nil {
+		return nil, err
+	}
+	u.Name = strings.TrimSpace(u.Name)
+	u.Metadata = map[string]string{}
+	if metadata.String != "" {
+		if err := json.Unmarshal([]byte(metadata.String), &u.Metadata); err != nil {
+			return nil, errors.Wrap(err, "parse metadata")
+		}
+	}
+	return &u, nil
+}
+
+// GetUserByName returns the user named name along with the balance of its main account.
+func (d *DB) GetUserByName(name string) (*User, error) {
+	row := d.db.QueryRow(`SELECT `+userSelectColumns+` FROM users u
+		JOIN accounts a ON a.user_id=u.id WHERE u.name=$1 AND a.name=$2`, strings.TrimSpace(name), DefaultAccount)
+	return scanUser(row)
+}
+
+// ListUsers returns up to limit users with an id above afterID whose name starts with the
+// prefix, by id. The id of the last one is the afterID of the next page.
+func (d *DB) ListUsers(prefix string, afterID, limit int) ([]User, error) {
+	//the prefix is matched literally, _ and % included
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.TrimSpace(prefix))
+	rows, err := d.db.Query(`SELECT `+userSelectColumns+` FROM users u
+		JOIN accounts a ON a.user_id=u.id WHERE u.id>$1 AND u.name LIKE $2 ESCAPE '\' AND a.name=$3
+		ORDER BY u.id LIMIT $4`, afterID, escaped+"%", DefaultAccount, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "query users")
+	}
+	defer rows.Close()
+	var res []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan user")
+		}
+		res = append(res, *u)
+	}
+	return res, rows.Err()
+}
+
+// RenameUser gives the user a new name, which no other user may have.
+func (d *DB) RenameUser(id int, name string) (*User, error) {
+	name = strings.TrimSpace(name)
+	if err := CheckUserName(name); err != nil {
+		return nil, err
+	}
+	u, err := d.GetUser(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "get user")
+	}
+	if strings.HasPrefix(u.Name, systemUserPrefix) {
+		return nil, errors.Errorf("system user %s cannot be renamed", u.Name)
+	}
+	if u.Name == name {
+		return u, nil
+	}
+	taken, err := d.ExistingUserNames([]string{name})
+	if err != nil {
+		return nil, err
+	}
+	if taken[name] {
+		return nil, errors.Errorf("name %s is taken", name)
+	}
+	//the unique constraint still catches a rename racing with this one
+	if _, err := d.db.Exec("UPDATE users SET name=$1 WHERE id=$2", name, id); err != nil {
+		return nil, errors.Wrap(err, "update user")
+	}
+	if err := d.usersChanged(id); err != nil {
+		return nil, err
+	}
+	return d.GetUser(id)
+}
+
+// UpdateUserMetadata merges the changes into the metadata of the user, an empty value
+// removes the key.
+func (d *DB) UpdateUserMetadata(id int, changes map[string]string) (*User, error) {
+	for k, v := range changes {
+		if k == "" || len(k) > MaxMetadataKey {
+			return nil, errors.Errorf("metadata keys should be 1 to %d characters: %q", MaxMetadataKey, k)
+		}
+		if len(v) > MaxMetadataValue {
+			return nil, errors.Errorf("metadata value of %s should be at most %d characters", k, MaxMetadataValue)
+		}
+	}
+	tx, err := d.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create tx")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	//a no-op update takes the row lock, so concurrent updates do not lose keys
+	res, err := tx.Exec("UPDATE users SET metadata=metadata WHERE id=$1", id)
+	if err != nil {
+		return nil, errors.Wrap(err, "lock user")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, errors.Errorf("user %d not found", id)
+	}
+	var data sql.NullString
+	if err := tx.QueryRow("SELECT metadata FROM users WHERE id=$1", id).Scan(&data); err != nil {
+		return nil, errors.Wrap(err, "query metadata")
+	}
+	metadata := map[string]string{}
+	if data.String != "" {
+		if err := json.Unmarshal([]byte(data.String), &metadata); err != nil {
+			return nil, errors.Wrap(err, "parse metadata")
+		}
+	}
+	for k, v := range changes {
+		if v == "" {
+			delete(metadata, k)
+		} else {
+			metadata[k] = v
+		}
+	}
+	if len(metadata) > MaxMetadataKeys {
+		return nil, errors.Errorf("users have at most %d metadata keys", MaxMetadataKeys)
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode metadata")
+	}
+	if _, err := tx.Exec("UPDATE users SET metadata=$1 WHERE id=$2", string(encoded), id); err != nil {
+		return nil, errors.Wrap(err, "update user")
+	}
+	if err := d.notifyUsers(tx, []int{id}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "commit tx")
+	}
+	d.cache.invalidate(id)
+	return d.GetUser(id)
+}
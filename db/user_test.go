@@ -0,0 +1,139 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckUserName(t *testing.T) {
+	assert.Nil(t, CheckUserName("alice"))
+	assert.Nil(t, CheckUserName("alice_b"))
+	for _, name := range []string{"", " alice", "_fees", strings.Repeat("a", MaxNameLength+1)} {
+		assert.NotNil(t, CheckUserName(name), name)
+	}
+}
+
+func TestDB_AddUserChecks(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	for _, name := range []string{FeeUser, InterestUser, " alice"} {
+		_, err = d.AddUser(name, 0)
+		assert.NotNil(t, err, name)
+	}
+	assert.NotNil(t, d.AddUsers([]NewUser{{Name: "alice"}, {Name: FeeUser}}))
+	_, err = d.AddUser("alice", money.MustParse("-500"))
+	assert.NotNil(t, err)
+	assert.NotNil(t, d.AddUsers([]NewUser{{Name: "alice"}, {Name: "bob", Balance: money.MustParse("-0.01")}}))
+	exist, err := d.ExistingUserNames([]string{"alice", FeeUser})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(exist))
+
+	//the system users are still created on first use
+	fees, err := d.FeeAccount()
+	assert.Nil(t, err)
+	u, err := d.GetUser(fees.UserID)
+	assert.Nil(t, err)
+	assert.Equal(t, FeeUser, u.Name)
+}
+
+func TestDB_ListUsers(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	for _, name := range []string{"alice", "albert", "bob", "al_x", "alpha%"} {
+		_, err := d.AddUser(name, money.MustParse("1"))
+		assert.Nil(t, err)
+	}
+
+	users, err := d.ListUsers("", 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, "alice", users[0].Name)
+	assert.Equal(t, "1.00", users[0].Balance.String())
+	users, err = d.ListUsers("", users[1].ID, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(users))
+	assert.Equal(t, "bob", users[0].Name)
+
+	users, err = d.ListUsers("al", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(users))
+	//wildcards in the prefix are taken literally
+	users, err = d.ListUsers("al_", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, "al_x", users[0].Name)
+	users, err = d.ListUsers("alpha%", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(users))
+	users, err = d.ListUsers("c", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users))
+
+	u, err := d.GetUserByName(" bob ")
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", u.Name)
+	_, err = d.GetUserByName("carol")
+	assert.NotNil(t, err)
+}
+
+func TestDB_RenameUser(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("alice", money.MustParse("1"))
+	_, _ = d.AddUser("bob", money.MustParse("1"))
+
+	u, err = d.RenameUser(u.ID, " carol ")
+	assert.Nil(t, err)
+	assert.Equal(t, "carol", u.Name)
+	_, err = d.RenameUser(u.ID, "carol")
+	assert.Nil(t, err)
+	_, err = d.RenameUser(u.ID, "bob")
+	assert.NotNil(t, err)
+	_, err = d.RenameUser(u.ID, "_fees")
+	assert.NotNil(t, err)
+	_, err = d.RenameUser(9999, "dave")
+	assert.NotNil(t, err)
+
+	fees, _ := d.FeeAccount()
+	_, err = d.RenameUser(fees.UserID, "dave")
+	assert.NotNil(t, err)
+	_, err = d.GetUserByName("alice")
+	assert.NotNil(t, err)
+}
+
+func TestDB_UpdateUserMetadata(t *testing.T) {
+	setupDbTest()
+	d, err := Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("alice", money.MustParse("1"))
+	assert.Equal(t, map[string]string{}, u.Metadata)
+
+	u, err = d.UpdateUserMetadata(u.ID, map[string]string{"country": "NZ", "segment": "retail"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"country": "NZ", "segment": "retail"}, u.Metadata)
+	u, err = d.UpdateUserMetadata(u.ID, map[string]string{"segment": "", "kyc": "done"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"country": "NZ", "kyc": "done"}, u.Metadata)
+
+	_, err = d.UpdateUserMetadata(u.ID, map[string]string{"": "x"})
+	assert.NotNil(t, err)
+	_, err = d.UpdateUserMetadata(u.ID, map[string]string{"note": strings.Repeat("x", MaxMetadataValue+1)})
+	assert.NotNil(t, err)
+	many := map[string]string{}
+	for i := 0; i < MaxMetadataKeys; i++ {
+		many[strings.Repeat("k", i+1)] = "v"
+	}
+	_, err = d.UpdateUserMetadata(u.ID, many)
+	assert.NotNil(t, err)
+	_, err = d.UpdateUserMetadata(9999, map[string]string{"a": "b"})
+	assert.NotNil(t, err)
+
+	u, _ = d.GetUser(u.ID)
+	assert.Equal(t, map[string]string{"country": "NZ", "kyc": "done"}, u.Metadata)
+}
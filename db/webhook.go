@@ -0,0 +1,307 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead is set once a delivery ran out of attempts.
+	DeliveryDead = "dead"
+)
+
+// eventTypes are the events webhooks can subscribe to.
+var eventTypes = map[string]bool{
+	EventUserCreated:       true,
+	EventFundsDeposited:    true,
+	EventFundsWithdrawn:    true,
+	EventTransferCompleted: true,
+}
+
+type Webhook struct {
+	ID         int
+	URL        string
+	Secret     string
+	EventTypes []string
+	Active     bool
+	CreatedAt  time.Time
+}
+
+// Wants tells whether the webhook subscribed to the event type.
+func (w *Webhook) Wants(eventType string) bool {
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func checkWebhook(rawURL string, types []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("webhook url should be an absolute http or https url: %q", rawURL)
+	}
+	if len(types) == 0 {
+		return errors.Errorf("webhook should subscribe to at least one event type")
+	}
+	for _, t := range types {
+		if !eventTypes[t] {
+			return errors.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+func (d *DB) AddWebhook(rawURL, secret string, types []string) (*Webhook, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if err := checkWebhook(rawURL, types); err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, errors.Errorf("webhook secret should not be empty")
+	}
+	w := Webhook{URL: rawURL, Secret: secret, EventTypes: types, Active: true, CreatedAt: now()}
+	err := d.db.QueryRow(`INSERT INTO webhooks (url, secret, event_types, active, created_at) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, w.URL, w.Secret, strings.Join(types, ","), w.Active, w.CreatedAt).Scan(&w.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "add webhook")
+	}
+	return &w, nil
+}
+
+// UpdateWebhook changes the url, event types and whether the webhook is active.
+func (d *DB) UpdateWebhook(id int, rawURL string, types []string, active bool) (*Webhook, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if err := checkWebhook(rawURL, types); err != nil {
+		return nil, err
+	}
+	res, err := d.db.Exec("UPDATE webhooks SET url=$1, event_types=$2, active=$3 WHERE id=$4",
+		rawURL, strings.Join(types, ","), active, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "update webhook")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, errors.Errorf("webhook %d not found", id)
+	}
+	return d.GetWebhook(id)
+}
+
+// DeleteWebhook removes the webhook together with its deliveries.
+func (d *DB) DeleteWebhook(id int) error {
+	if _, err := d.GetWebhook(id); err != nil {
+		return err
+	}
+	return d.transaction([]Statement{
+		{
+			S:    "DELETE FROM webhook_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id=$1)",
+			Args: []interface{}{id},
+		},
+		{S: "DELETE FROM webhook_deliveries WHERE webhook_id=$1", Args: []interface{}{id}},
+		{S: "DELETE FROM webhooks WHERE id=$1", Args: []interface{}{id}},
+	})
+}
+
+func (d *DB) GetWebhook(id int) (*Webhook, error) {
+	w, err := scanWebhook(d.db.QueryRow("SELECT id, url, secret, event_types, active, created_at FROM webhooks WHERE id=$1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Errorf("webhook %d not found", id)
+	}
+	return w, err
+}
+
+// Webhooks lists the webhooks, only the active ones if active is set.
+func (d *DB) Webhooks(active bool) ([]Webhook, error) {
+	q := "SELECT id, url, secret, event_types, active, created_at FROM webhooks"
+	if active {
+		q += " WHERE active"
+	}
+	rows, err := d.db.Query(q + " ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "query webhooks")
+	}
+	defer rows.Close()
+
+	var res []Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *w)
+	}
+	return res, rows.Err()
+}
+
+func scanWebhook(row scanner) (*Webhook, error) {
+	var w Webhook
+	var types string
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &types, &w.Active, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	w.EventTypes = strings.Split(types, ",")
+	return &w, nil
+}
+
+type Delivery struct {
+	ID            int
+	WebhookID     int
+	EventID       int
+	EventType     string
+	Payload       json.RawMessage
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	EventAt       time.Time
+}
+
+type DeliveryAttempt struct {
+	ID         int
+	DeliveryID int
+	// StatusCode is 0 when no response was received.
+	StatusCode int
+	Response   string
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+// AddDelivery queues the event for the webhook. Adding the same event again does nothing,
+// events are published at least once.
+func (d *DB) AddDelivery(webhookID int, e Event) error {
+	t := now()
+	_, err := d.db.Exec(`INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, event_at, status, attempts,
+		next_attempt_at, last_error, created_at) VALUES ($1, $2, $3, $4, $5, $6, 0, $7, '', $7)
+		ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+		webhookID, e.ID, e.Type, string(e.Payload), dbTime(e.CreatedAt), DeliveryPending, t)
+	return errors.Wrap(err, "add delivery")
+}
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, payload, event_at, status, attempts, next_attempt_at,
+	last_error, created_at`
+
+func scanDelivery(row scanner) (*Delivery, error) {
+	var dl Delivery
+	var payload string
+	err := row.Scan(&dl.ID, &dl.WebhookID, &dl.EventID, &dl.EventType, &payload, &dl.EventAt, &dl.Status, &dl.Attempts,
+		&dl.NextAttemptAt, &dl.LastError, &dl.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	dl.Payload = json.RawMessage(payload)
+	return &dl, nil
+}
+
+func (d *DB) queryDeliveries(q string, args ...interface{}) ([]Delivery, error) {
+	rows, err := d.db.Query(q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query deliveries")
+	}
+	defer rows.Close()
+
+	var res []Delivery
+	for rows.Next() {
+		dl, err := scanDelivery(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan delivery")
+		}
+		res = append(res, *dl)
+	}
+	return res, rows.Err()
+}
+
+// ClaimDeliveries returns up to limit pending deliveries of active webhooks whose next attempt
+// is due, oldest first. Their next attempt is put off by the lease in the same statement, so
+// that other instances do not send them too, RecordAttempt sets it once they are attempted.
+func (d *DB) ClaimDeliveries(limit int, lease time.Duration) ([]Delivery, error) {
+	at := now()
+	//the due condition is checked again on the rows updated, a delivery claimed concurrently
+	//is no longer due
+	res, err := d.queryDeliveries(`UPDATE webhook_deliveries SET next_attempt_at=$1 WHERE id IN (
+			SELECT id FROM webhook_deliveries WHERE status=$2 AND next_attempt_at<=$3
+			AND webhook_id IN (SELECT id FROM webhooks WHERE active) ORDER BY id LIMIT $4)
+		AND status=$2 AND next_attempt_at<=$3 RETURNING `+deliveryColumns, at.Add(lease), DeliveryPending, at, limit)
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, err
+}
+
+// Deliveries lists the deliveries of the webhook, newest first, only those in the status if set.
+func (d *DB) Deliveries(webhookID int, status string, limit int) ([]Delivery, error) {
+	if status == "" {
+		return d.queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id=$1
+			ORDER BY id DESC LIMIT $2`, webhookID, limit)
+	}
+	return d.queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id=$1 AND status=$2
+		ORDER BY id DESC LIMIT $3`, webhookID, status, limit)
+}
+
+func (d *DB) GetDelivery(id int) (*Delivery, error) {
+	dl, err := scanDelivery(d.db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id=$1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Errorf("delivery %d not found", id)
+	}
+	return dl, err
+}
+
+// RecordAttempt saves the attempt and moves the delivery to its new status, next is when to
+// try again if it is still pending.
+func (d *DB) RecordAttempt(a DeliveryAttempt, status string, next time.Time) error {
+	return d.transaction([]Statement{
+		{
+			S: `INSERT INTO webhook_attempts (delivery_id, status_code, response, error, duration_ms, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+			Args: []interface{}{a.DeliveryID, a.StatusCode, a.Response, a.Error, a.Duration.Milliseconds(), now()},
+		},
+		{
+			S: `UPDATE webhook_deliveries SET status=$1, attempts=attempts+1, next_attempt_at=$2, last_error=$3
+				WHERE id=$4`,
+			Args: []interface{}{status, dbTime(next), a.Error, a.DeliveryID},
+		},
+	})
+}
+
+// DeliveryAttempts lists the attempts of the delivery, oldest first.
+func (d *DB) DeliveryAttempts(deliveryID int) ([]DeliveryAttempt, error) {
+	rows, err := d.db.Query(`SELECT id, delivery_id, status_code, response, error, duration_ms, created_at
+		FROM webhook_attempts WHERE delivery_id=$1 ORDER BY id`, deliveryID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query attempts")
+	}
+	defer rows.Close()
+
+	var res []DeliveryAttempt
+	for rows.Next() {
+		var a DeliveryAttempt
+		var ms int64
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.StatusCode, &a.Response, &a.Error, &ms, &a.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "scan attempt")
+		}
+		a.Duration = time.Duration(ms) * time.Millisecond
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+// RetryDelivery puts a dead delivery back in the queue with a fresh set of attempts.
+func (d *DB) RetryDelivery(id int) error {
+	dl, err := d.GetDelivery(id)
+	if err != nil {
+		return err
+	}
+	if dl.Status != DeliveryDead {
+		return errors.Errorf("only %s deliveries can be retried, delivery %d is %s", DeliveryDead, id, dl.Status)
+	}
+	_, err = d.db.Exec("UPDATE webhook_deliveries SET status=$1, attempts=0, next_attempt_at=$2 WHERE id=$3",
+		DeliveryPending, now(), id)
+	return errors.Wrap(err, "retry delivery")
+}
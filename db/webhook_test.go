@@ -0,0 +1,131 @@
+package db
+
+import (
+	"code_challenge1/money"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Webhooks(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+
+	for _, c := range []struct {
+		url   string
+		types []string
+	}{
+		{"ftp://example.com", []string{EventFundsDeposited}},
+		{"/hook", []string{EventFundsDeposited}},
+		{"https://example.com/hook", nil},
+		{"https://example.com/hook", []string{"MoneyPrinted"}},
+	} {
+		_, err = db.AddWebhook(c.url, "secret", c.types)
+		assert.NotNil(t, err, c.url)
+	}
+	_, err = db.AddWebhook("https://example.com/hook", "", []string{EventFundsDeposited})
+	assert.NotNil(t, err)
+
+	w1, err := db.AddWebhook(" https://example.com/hook ", "secret", []string{EventFundsDeposited, EventTransferCompleted})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/hook", w1.URL)
+	assert.True(t, w1.Wants(EventTransferCompleted))
+	assert.False(t, w1.Wants(EventUserCreated))
+	w2, err := db.AddWebhook("http://localhost/other", "secret2", []string{EventUserCreated})
+	assert.Nil(t, err)
+
+	w2, err = db.UpdateWebhook(w2.ID, "http://localhost/other", []string{EventUserCreated}, false)
+	assert.Nil(t, err)
+	assert.False(t, w2.Active)
+	assert.Equal(t, "secret2", w2.Secret)
+	_, err = db.UpdateWebhook(9999, "http://localhost/other", []string{EventUserCreated}, false)
+	assert.NotNil(t, err)
+
+	hooks, err := db.Webhooks(true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hooks))
+	assert.Equal(t, *w1, hooks[0])
+	hooks, err = db.Webhooks(false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(hooks))
+
+	assert.Nil(t, db.DeleteWebhook(w2.ID))
+	assert.NotNil(t, db.DeleteWebhook(w2.ID))
+	_, err = db.GetWebhook(w2.ID)
+	assert.NotNil(t, err)
+}
+
+func TestDB_Deliveries(t *testing.T) {
+	setupDbTest()
+	db, err := Open()
+	assert.Nil(t, err)
+	w, _ := db.AddWebhook("https://example.com/hook", "secret", []string{EventFundsDeposited})
+	u, _ := db.AddUser("test1", money.MustParse("100"))
+	_, _ = db.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	events, _ := db.PendingEvents(10)
+	e := events[1]
+
+	assert.Nil(t, db.AddDelivery(w.ID, e))
+	//published again
+	assert.Nil(t, db.AddDelivery(w.ID, e))
+	due, err := db.ClaimDeliveries(10, time.Minute)
+	assert.Nil(t, err)
+	if !assert.Equal(t, 1, len(due)) {
+		return
+	}
+	dl := due[0]
+	//claimed deliveries are not due for another sender
+	due, _ = db.ClaimDeliveries(10, time.Minute)
+	assert.Equal(t, 0, len(due))
+	assert.Equal(t, e.ID, dl.EventID)
+	assert.Equal(t, EventFundsDeposited, dl.EventType)
+	assert.JSONEq(t, string(e.Payload), string(dl.Payload))
+	assert.Equal(t, DeliveryPending, dl.Status)
+
+	assert.NotNil(t, db.RetryDelivery(dl.ID))
+	err = db.RecordAttempt(DeliveryAttempt{DeliveryID: dl.ID, StatusCode: 500, Response: "oops", Error: "unexpected status 500",
+		Duration: 20 * time.Millisecond}, DeliveryPending, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	due, _ = db.ClaimDeliveries(10, -time.Minute)
+	assert.Equal(t, 0, len(due))
+
+	err = db.RecordAttempt(DeliveryAttempt{DeliveryID: dl.ID, Error: "timeout"}, DeliveryDead, time.Now())
+	assert.Nil(t, err)
+	got, err := db.GetDelivery(dl.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, DeliveryDead, got.Status)
+	assert.Equal(t, 2, got.Attempts)
+	assert.Equal(t, "timeout", got.LastError)
+
+	attempts, err := db.DeliveryAttempts(dl.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(attempts))
+	assert.Equal(t, 500, attempts[0].StatusCode)
+	assert.Equal(t, "oops", attempts[0].Response)
+	assert.Equal(t, 20*time.Millisecond, attempts[0].Duration)
+
+	list, err := db.Deliveries(w.ID, DeliveryDead, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	list, err = db.Deliveries(w.ID, DeliveryPending, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(list))
+
+	assert.Nil(t, db.RetryDelivery(dl.ID))
+	got, _ = db.GetDelivery(dl.ID)
+	assert.Equal(t, DeliveryPending, got.Status)
+	assert.Equal(t, 0, got.Attempts)
+
+	//deliveries of inactive webhooks wait
+	_, _ = db.UpdateWebhook(w.ID, w.URL, w.EventTypes, false)
+	due, _ = db.ClaimDeliveries(10, time.Minute)
+	assert.Equal(t, 0, len(due))
+
+	assert.Nil(t, db.DeleteWebhook(w.ID))
+	_, err = db.GetDelivery(dl.ID)
+	assert.NotNil(t, err)
+	attempts, _ = db.DeliveryAttempts(dl.ID)
+	assert.Equal(t, 0, len(attempts))
+}
@@ -0,0 +1,123 @@
+// Package events publishes the domain events written to the outbox by the db package.
+// Events are published at least once and in the order they were written.
+package events
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/log"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Publisher delivers an event somewhere, an error leaves the event pending to be retried.
+type Publisher interface {
+	Publish(e db.Event) error
+}
+
+// NewPublisher returns the publisher by name, log or memory.
+func NewPublisher(name string) (Publisher, error) {
+	switch name {
+	case "", "log":
+		return Log{}, nil
+	case "memory":
+		return &Memory{}, nil
+	default:
+		return nil, errors.Errorf("unknown event publisher %q, should be log or memory", name)
+	}
+}
+
+// Multi publishes every event to each publisher in turn. A failure means the event is
+// published again to those before it, which is fine as delivery is at least once.
+type Multi []Publisher
+
+func (m Multi) Publish(e db.Event) error {
+	for _, p := range m {
+		if err := p.Publish(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Log writes the events to the server log.
+type Log struct{}
+
+func (Log) Publish(e db.Event) error {
+	log.Infof("event %d %s: %s", e.ID, e.Type, e.Payload)
+	return nil
+}
+
+// Memory keeps the events published, for tests and local runs.
+type Memory struct {
+	mu     sync.Mutex
+	events []db.Event
+}
+
+func (m *Memory) Publish(e db.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+	return nil
+}
+
+// Events returns the events published so far.
+func (m *Memory) Events() []db.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]db.Event(nil), m.events...)
+}
+
+// dispatchBatch is how many pending events are read at once.
+const dispatchBatch = 100
+
+// DispatchLease is how long a dispatcher keeps the outbox to itself without dispatching. The
+// lease is renewed before every batch, another instance takes over once it runs out.
+const DispatchLease = 30 * time.Second
+
+type Dispatcher struct {
+	db  *db.DB
+	pub Publisher
+	// holder tells this dispatcher's lease on the outbox from the other instances'.
+	holder string
+	lease  time.Duration
+}
+
+func NewDispatcher(d *db.DB, pub Publisher) *Dispatcher {
+	b := make([]byte, 16)
+	//crypto/rand only fails without a randomness source in the system
+	_, _ = rand.Read(b)
+	return &Dispatcher{db: d, pub: pub, holder: hex.EncodeToString(b), lease: DispatchLease}
+}
+
+// Dispatch publishes the pending events oldest first and marks them sent, returning how many
+// were published. It stops at the first failure so that events are not published out of order.
+// Only the instance holding the outbox lease dispatches, the others publish nothing.
+func (x *Dispatcher) Dispatch() (int, error) {
+	var n int
+	for {
+		ok, err := x.db.ClaimOutbox(x.holder, x.lease)
+		if err != nil || !ok {
+			return n, err
+		}
+		pending, err := x.db.PendingEvents(dispatchBatch)
+		if err != nil {
+			return n, err
+		}
+		for _, e := range pending {
+			if err := x.pub.Publish(e); err != nil {
+				return n, errors.Wrapf(err, "publish event %d", e.ID)
+			}
+			if err := x.db.MarkEventSent(e.ID); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(pending) < dispatchBatch {
+			return n, nil
+		}
+	}
+}
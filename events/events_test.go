@@ -0,0 +1,105 @@
+package events
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDbTest() {
+	os.Setenv("TEST_ENV", "true")
+	db.Schema = db.SqliteSchema
+}
+
+// failing fails after n events.
+type failing struct {
+	Memory
+	n int
+}
+
+func (f *failing) Publish(e db.Event) error {
+	if len(f.Events()) >= f.n {
+		return errors.Errorf("unavailable")
+	}
+	return f.Memory.Publish(e)
+}
+
+func TestDispatcher(t *testing.T) {
+	setupDbTest()
+	d, err := db.Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("-1"))
+
+	pub := &failing{n: 1}
+	x := NewDispatcher(d, pub)
+	n, err := x.Dispatch()
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, n)
+
+	pub.n = 100
+	n, err = x.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	events := pub.Events()
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, db.EventUserCreated, events[0].Type)
+	assert.Equal(t, db.EventFundsDeposited, events[1].Type)
+	assert.Equal(t, db.EventFundsWithdrawn, events[2].Type)
+
+	n, err = x.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestDispatcher_Instances(t *testing.T) {
+	setupDbTest()
+	d, err := db.Open()
+	assert.Nil(t, err)
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+
+	pub1, pub2 := &Memory{}, &Memory{}
+	x1, x2 := NewDispatcher(d, pub1), NewDispatcher(d, pub2)
+	n, err := x1.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	//the outbox is x1's while its lease runs
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	n, err = x2.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	n, err = x1.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	//and x2's once it ran out
+	x1.lease = -time.Second
+	_, _ = x1.Dispatch()
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	n, err = x2.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = x1.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 2, len(pub1.Events()))
+	assert.Equal(t, 1, len(pub2.Events()))
+}
+
+func TestNewPublisher(t *testing.T) {
+	p, err := NewPublisher("")
+	assert.Nil(t, err)
+	assert.Nil(t, p.Publish(db.Event{ID: 1, Type: db.EventUserCreated, Payload: []byte(`{}`)}))
+	p, err = NewPublisher("memory")
+	assert.Nil(t, err)
+	assert.IsType(t, &Memory{}, p)
+	_, err = NewPublisher("kafka")
+	assert.NotNil(t, err)
+}
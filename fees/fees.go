@@ -0,0 +1,253 @@
+// Package fees computes the fees charged on transfers and withdrawals.
+//
+// A schedule holds one rule per transaction type and user tier, a rule without a tier
+// applies to the tiers without one of their own, eg. a flat fee of 0 makes a tier free.
+// Fees are flat, a percentage of the amount or tiered by amount, then raised to the
+// minimum and capped at the maximum of the rule, and rounded half up to the cent.
+package fees
+
+import (
+	"code_challenge1/money"
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The transaction types fees are charged on.
+const (
+	Transfer = "transfer"
+	Withdraw = "withdraw"
+)
+
+// The kinds of fee.
+const (
+	Flat       = "flat"
+	Percentage = "percentage"
+	Tiered     = "tiered"
+)
+
+// Config is the declarative form of a rule. Only the fields used by the kind need to be
+// set, Min and Max apply to every kind.
+type Config struct {
+	Transaction string `json:"transaction"`
+	// Tier is the user tier the rule is for, every tier when empty.
+	Tier string `json:"tier,omitempty"`
+	Kind string `json:"kind"`
+
+	Amount string       `json:"amount,omitempty"` // flat: the fee
+	Rate   string       `json:"rate,omitempty"`   // percentage: fraction of the amount, eg. 0.01
+	Bands  []BandConfig `json:"bands,omitempty"`  // tiered: by amount, ascending
+	Min    string       `json:"min,omitempty"`
+	Max    string       `json:"max,omitempty"`
+}
+
+// BandConfig is a band of a tiered fee, for amounts up to UpTo, the last band has none. Its
+// fee is Amount plus Rate of the transaction amount.
+type BandConfig struct {
+	UpTo   string `json:"up_to,omitempty"`
+	Amount string `json:"amount,omitempty"`
+	Rate   string `json:"rate,omitempty"`
+}
+
+type band struct {
+	upTo   *big.Rat
+	amount *big.Rat
+	rate   *big.Rat
+}
+
+func (b band) fee(amount *big.Rat) *big.Rat {
+	f := new(big.Rat).Mul(amount, b.rate)
+	return f.Add(f, b.amount)
+}
+
+// Rule computes the fee of a transaction type for a tier.
+type Rule struct {
+	bands []band
+	min   *big.Rat
+	max   *big.Rat
+}
+
+// Fee is the fee of the amount in cents.
+func (r *Rule) Fee(amount *big.Rat) *big.Rat {
+	f := new(big.Rat)
+	for _, b := range r.bands {
+		if b.upTo == nil || amount.Cmp(b.upTo) <= 0 {
+			f = b.fee(amount)
+			break
+		}
+	}
+	if r.min != nil && f.Cmp(r.min) < 0 {
+		f.Set(r.min)
+	}
+	if r.max != nil && f.Cmp(r.max) > 0 {
+		f.Set(r.max)
+	}
+	return round(f)
+}
+
+// round rounds half up to the cent.
+func round(f *big.Rat) *big.Rat {
+	cents := new(big.Rat).Mul(f, big.NewRat(100, 1))
+	cents.Add(cents, big.NewRat(1, 2))
+	n := new(big.Int).Quo(cents.Num(), cents.Denom())
+	return new(big.Rat).SetFrac(n, big.NewInt(100))
+}
+
+func (c Config) Rule() (*Rule, error) {
+	if c.Transaction != Transfer && c.Transaction != Withdraw {
+		return nil, errors.Errorf("transaction should be %s or %s: %q", Transfer, Withdraw, c.Transaction)
+	}
+	r := &Rule{}
+	var err error
+	if r.min, err = optional("min", c.Min, amount); err != nil {
+		return nil, err
+	}
+	if r.max, err = optional("max", c.Max, amount); err != nil {
+		return nil, err
+	}
+	if r.min != nil && r.max != nil && r.min.Cmp(r.max) > 0 {
+		return nil, errors.Errorf("min should not be above max: %s > %s", c.Min, c.Max)
+	}
+
+	switch c.Kind {
+	case Flat:
+		b, err := BandConfig{Amount: c.Amount}.band()
+		if err != nil || strings.TrimSpace(c.Amount) == "" {
+			return nil, errors.Errorf("amount not valid: %q", c.Amount)
+		}
+		r.bands = []band{b}
+	case Percentage:
+		b, err := BandConfig{Rate: c.Rate}.band()
+		if err != nil || strings.TrimSpace(c.Rate) == "" {
+			return nil, errors.Errorf("rate not valid: %q", c.Rate)
+		}
+		r.bands = []band{b}
+	case Tiered:
+		if len(c.Bands) == 0 {
+			return nil, errors.Errorf("tiered fee should have bands")
+		}
+		for i, bc := range c.Bands {
+			b, err := bc.band()
+			if err != nil {
+				return nil, errors.Wrapf(err, "band %d", i+1)
+			}
+			last := i == len(c.Bands)-1
+			if (b.upTo == nil) != last {
+				return nil, errors.Errorf("band %d: only the last band has no up_to", i+1)
+			}
+			if i > 0 && !last && b.upTo.Cmp(r.bands[i-1].upTo) <= 0 {
+				return nil, errors.Errorf("band %d: up_to should be ascending", i+1)
+			}
+			r.bands = append(r.bands, b)
+		}
+	default:
+		return nil, errors.Errorf("unknown fee kind: %q", c.Kind)
+	}
+	return r, nil
+}
+
+func (c BandConfig) band() (band, error) {
+	var b band
+	var err error
+	if b.upTo, err = optional("up_to", c.UpTo, amount); err != nil {
+		return b, err
+	}
+	if b.amount, err = optional("amount", c.Amount, amount); err != nil {
+		return b, err
+	}
+	if b.rate, err = optional("rate", c.Rate, money.ParseDecimal); err != nil {
+		return b, err
+	}
+	if b.amount == nil {
+		b.amount = new(big.Rat)
+	}
+	if b.rate == nil {
+		b.rate = new(big.Rat)
+	}
+	if b.rate.Cmp(big.NewRat(1, 1)) > 0 {
+		return b, errors.Errorf("rate should not be above 1: %q", c.Rate)
+	}
+	return b, nil
+}
+
+// optional parses a non negative amount or rate, nil when empty.
+func optional(name, s string, parse func(string) (*big.Rat, error)) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	r, err := parse(s)
+	if err != nil || r.Sign() < 0 {
+		return nil, errors.Errorf("%s should be a positive decimal: %q", name, s)
+	}
+	return r, nil
+}
+
+// amount parses an amount of money, with at most money.Decimals decimals.
+func amount(s string) (*big.Rat, error) {
+	m, err := money.Parse(s)
+	return m.Rat(), err
+}
+
+// Schedule holds the rules by transaction type and tier.
+type Schedule struct {
+	rules map[string]map[string]*Rule
+}
+
+func NewSchedule(configs []Config) (*Schedule, error) {
+	s := &Schedule{rules: map[string]map[string]*Rule{}}
+	for i, c := range configs {
+		r, err := c.Rule()
+		if err != nil {
+			return nil, errors.Wrapf(err, "fee %d", i+1)
+		}
+		if s.rules[c.Transaction] == nil {
+			s.rules[c.Transaction] = map[string]*Rule{}
+		}
+		if _, ok := s.rules[c.Transaction][c.Tier]; ok {
+			return nil, errors.Errorf("fee %d: %s fee of tier %q is set twice", i+1, c.Transaction, c.Tier)
+		}
+		s.rules[c.Transaction][c.Tier] = r
+	}
+	return s, nil
+}
+
+// Quote returns the fee of a transaction of the amount for a user of the tier, zero when no
+// rule applies.
+func (s *Schedule) Quote(transaction, tier string, amount *big.Rat) *big.Rat {
+	rules := s.rules[transaction]
+	r, ok := rules[tier]
+	if !ok {
+		r, ok = rules[""]
+	}
+	if !ok {
+		return new(big.Rat)
+	}
+	return r.Fee(new(big.Rat).Abs(amount))
+}
+
+// LoadConfigs reads the fee rules as a json array from the FEES environment variable.
+// Without it nothing is charged.
+func LoadConfigs() ([]Config, error) {
+	s := strings.TrimSpace(os.Getenv("FEES"))
+	if s == "" {
+		return nil, nil
+	}
+	var configs []Config
+	if err := json.Unmarshal([]byte(s), &configs); err != nil {
+		return nil, errors.Wrap(err, "parse FEES")
+	}
+	return configs, nil
+}
+
+// Load builds the schedule of the FEES environment variable, see LoadConfigs.
+func Load() (*Schedule, error) {
+	configs, err := LoadConfigs()
+	if err != nil {
+		return nil, err
+	}
+	return NewSchedule(configs)
+}
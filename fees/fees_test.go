@@ -0,0 +1,86 @@
+package fees
+
+import (
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rat(s string) *big.Rat {
+	r, _ := new(big.Rat).SetString(s)
+	return r
+}
+
+func TestSchedule_Quote(t *testing.T) {
+	s, err := NewSchedule([]Config{
+		{Transaction: Transfer, Kind: Percentage, Rate: "0.01", Min: "0.5", Max: "5"},
+		{Transaction: Transfer, Tier: "premium", Kind: Flat, Amount: "0"},
+		{Transaction: Withdraw, Kind: Tiered, Bands: []BandConfig{
+			{UpTo: "100", Amount: "1"},
+			{UpTo: "1000", Amount: "1", Rate: "0.005"},
+			{Rate: "0.002"},
+		}},
+	})
+	assert.Nil(t, err)
+	for _, c := range []struct {
+		transaction, tier, amount, fee string
+	}{
+		{Transfer, "standard", "10", "0.50"},     //raised to min
+		{Transfer, "standard", "123.45", "1.23"}, //1.2345 rounds down
+		{Transfer, "standard", "124.50", "1.25"}, //1.245 rounds half up
+		{Transfer, "standard", "10000", "5.00"},  //capped
+		{Transfer, "premium", "10000", "0.00"},
+		{Withdraw, "standard", "-100", "1.00"},
+		{Withdraw, "standard", "100.01", "1.50"},
+		{Withdraw, "premium", "5000", "10.00"},
+		{"deposit", "standard", "10", "0.00"},
+	} {
+		assert.Equal(t, c.fee, s.Quote(c.transaction, c.tier, rat(c.amount)).FloatString(2), c)
+	}
+}
+
+func TestNewSchedule_Errors(t *testing.T) {
+	for _, c := range []Config{
+		{Transaction: "deposit", Kind: Flat, Amount: "1"},
+		{Transaction: Transfer, Kind: "free"},
+		{Transaction: Transfer, Kind: Flat},
+		{Transaction: Transfer, Kind: Flat, Amount: "-1"},
+		{Transaction: Transfer, Kind: Flat, Amount: "1e2"},
+		{Transaction: Transfer, Kind: Flat, Amount: "0.001"},
+		{Transaction: Transfer, Kind: Percentage, Rate: "2"},
+		{Transaction: Transfer, Kind: Percentage, Rate: "1/3"},
+		{Transaction: Transfer, Kind: Flat, Amount: "1", Max: "1e3"},
+		{Transaction: Transfer, Kind: Percentage, Rate: "0.01", Min: "2", Max: "1"},
+		{Transaction: Transfer, Kind: Tiered},
+		{Transaction: Transfer, Kind: Tiered, Bands: []BandConfig{{UpTo: "100", Amount: "1"}}},
+		{Transaction: Transfer, Kind: Tiered, Bands: []BandConfig{{Amount: "1"}, {Amount: "2"}}},
+		{Transaction: Transfer, Kind: Tiered, Bands: []BandConfig{{UpTo: "100"}, {UpTo: "50"}, {}}},
+	} {
+		_, err := NewSchedule([]Config{c})
+		assert.NotNil(t, err, c)
+	}
+	_, err := NewSchedule([]Config{
+		{Transaction: Transfer, Kind: Flat, Amount: "1"},
+		{Transaction: Transfer, Kind: Flat, Amount: "2"},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	os.Unsetenv("FEES")
+	s, err := Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, s.Quote(Transfer, "", rat("100")).Sign())
+
+	os.Setenv("FEES", `[{"transaction":"transfer","kind":"flat","amount":"0.25"}]`)
+	defer os.Unsetenv("FEES")
+	s, err = Load()
+	assert.Nil(t, err)
+	assert.Equal(t, "0.25", s.Quote(Transfer, "", rat("100")).FloatString(2))
+
+	os.Setenv("FEES", `{}`)
+	_, err = Load()
+	assert.NotNil(t, err)
+}
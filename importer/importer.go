@@ -0,0 +1,137 @@
+// Package importer loads users with their opening balances from csv files.
+package importer
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Row is a validated line of the csv file.
+type Row struct {
+	Line    int
+	Name    string
+	Balance money.Money
+}
+
+type LineError struct {
+	Line int
+	Err  string
+}
+
+// Errors collects every problem found in the file, so they can all be fixed at once.
+type Errors []LineError
+
+func (e Errors) Error() string {
+	s := make([]string, 0, len(e))
+	for _, l := range e {
+		s = append(s, fmt.Sprintf("line %d: %s", l.Line, l.Err))
+	}
+	return "csv not valid: " + strings.Join(s, "; ")
+}
+
+// ParseUsers reads a csv file with a name,balance header. Every row is validated up front,
+// the returned error is Errors when some rows are not valid.
+func ParseUsers(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.Errorf("csv is empty")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+	if len(header) != 2 || strings.TrimSpace(header[0]) != "name" || strings.TrimSpace(header[1]) != "balance" {
+		return nil, errors.Errorf("csv header should be name,balance, got %s", strings.Join(header, ","))
+	}
+
+	var rows []Row
+	var errs Errors
+	seen := map[string]int{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read line %d", line)
+		}
+		if len(rec) != 2 {
+			errs = append(errs, LineError{Line: line, Err: fmt.Sprintf("expected 2 fields, got %d", len(rec))})
+			continue
+		}
+		name := strings.TrimSpace(rec[0])
+		if name == "" {
+			errs = append(errs, LineError{Line: line, Err: "name is empty"})
+			continue
+		}
+		if err := db.CheckUserName(name); err != nil {
+			errs = append(errs, LineError{Line: line, Err: err.Error()})
+			continue
+		}
+		if l, ok := seen[name]; ok {
+			errs = append(errs, LineError{Line: line, Err: fmt.Sprintf("duplicate name %s, already on line %d", name, l)})
+			continue
+		}
+		seen[name] = line
+		balance, err := money.Parse(rec[1])
+		if err != nil {
+			errs = append(errs, LineError{Line: line, Err: fmt.Sprintf("balance not valid: %s", err)})
+			continue
+		}
+		if balance.Sign() < 0 {
+			errs = append(errs, LineError{Line: line, Err: fmt.Sprintf("balance should not be negative: %s", rec[1])})
+			continue
+		}
+		rows = append(rows, Row{Line: line, Name: name, Balance: balance})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(rows) == 0 {
+		return nil, errors.Errorf("csv has no users")
+	}
+	return rows, nil
+}
+
+// ImportUsers parses the csv file and creates all its users in one transaction, or none of
+// them when any row is not valid or the name is already taken.
+func ImportUsers(d *db.DB, r io.Reader) (int, error) {
+	rows, err := ParseUsers(r)
+	if err != nil {
+		return 0, err
+	}
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		names = append(names, row.Name)
+	}
+	existing, err := d.ExistingUserNames(names)
+	if err != nil {
+		return 0, errors.Wrap(err, "check names")
+	}
+	var errs Errors
+	users := make([]db.NewUser, 0, len(rows))
+	for _, row := range rows {
+		if existing[row.Name] {
+			errs = append(errs, LineError{Line: row.Line, Err: fmt.Sprintf("user %s already exists", row.Name)})
+			continue
+		}
+		users = append(users, db.NewUser{Name: row.Name, Balance: row.Balance})
+	}
+	if len(errs) > 0 {
+		return 0, errs
+	}
+	if err := d.AddUsers(users); err != nil {
+		return 0, errors.Wrap(err, "add users")
+	}
+	return len(users), nil
+}
@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"code_challenge1/db"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDbTest() {
+	os.Setenv("TEST_ENV", "true")
+	db.Schema = db.SqliteSchema
+}
+
+func TestParseUsers(t *testing.T) {
+	rows, err := ParseUsers(strings.NewReader("name,balance\nalice,10.5\n bob , 0\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, "bob", rows[1].Name)
+	assert.Equal(t, 3, rows[1].Line)
+	assert.Equal(t, "10.50", rows[0].Balance.String())
+
+	_, err = ParseUsers(strings.NewReader(""))
+	assert.NotNil(t, err)
+	_, err = ParseUsers(strings.NewReader("id,amount\n"))
+	assert.NotNil(t, err)
+	_, err = ParseUsers(strings.NewReader("name,balance\n"))
+	assert.NotNil(t, err)
+	_, err = ParseUsers(strings.NewReader("name,balance\n_fees,1\n"))
+	assert.NotNil(t, err)
+
+	_, err = ParseUsers(strings.NewReader("name,balance\nalice,10\nalice,5\n,1\nbob,1.005\ncarl,-1\ndan,abc\neve\n"))
+	errs, ok := err.(Errors)
+	assert.True(t, ok)
+	assert.Equal(t, 6, len(errs))
+	assert.Equal(t, 3, errs[0].Line)
+	assert.Contains(t, errs[0].Err, "line 2")
+	assert.Equal(t, 8, errs[5].Line)
+	assert.Contains(t, err.Error(), "line 4:")
+}
+
+func TestImportUsers(t *testing.T) {
+	setupDbTest()
+	d, err := db.Open()
+	assert.Nil(t, err)
+	_, _ = d.AddUser("carl", 0)
+
+	n, err := ImportUsers(d, strings.NewReader("name,balance\nalice,10.5\nbob,20\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	accounts, err := d.UserAccounts(2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(accounts))
+
+	//one taken name rejects the whole file
+	_, err = ImportUsers(d, strings.NewReader("name,balance\ndan,1\nalice,1\n"))
+	errs, ok := err.(Errors)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, 3, errs[0].Line)
+	existing, err := d.ExistingUserNames([]string{"dan"})
+	assert.Nil(t, err)
+	assert.False(t, existing["dan"])
+}
@@ -0,0 +1,250 @@
+// Package interest accrues interest on account balances daily and posts it monthly.
+//
+// Interest accrues on the balance at the end of each day at the annual rate divided by
+// 365, whatever the year, and is kept exact. Each month is posted as one record from the
+// interest account, rounded down to the cent; what is left over is carried to the next
+// posting. Accruals and postings are unique per account and day or month, so runs can be
+// repeated and never pay twice.
+package interest
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DaysInYear is the day count convention of the daily rate.
+const DaysInYear = 365
+
+// Rates are the annual rates of the products, by account name, eg. savings.
+type Rates map[string]*big.Rat
+
+// ParseRate reads an annual rate as a plain decimal fraction, eg. 0.035 for 3.5%.
+func ParseRate(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	r, err := money.ParseDecimal(s)
+	if err != nil {
+		return nil, errors.Errorf("rate should be a decimal fraction, eg. 0.035: %q", s)
+	}
+	if r.Sign() < 0 || r.Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, errors.Errorf("rate should be between 0 and 1: %q", s)
+	}
+	return r, nil
+}
+
+// LoadRates reads the product rates as a json object from the INTEREST_RATES environment
+// variable, eg. {"savings":"0.035"}. Without it no product earns interest.
+func LoadRates() (Rates, error) {
+	s := strings.TrimSpace(os.Getenv("INTEREST_RATES"))
+	rates := Rates{}
+	if s == "" {
+		return rates, nil
+	}
+	var configs map[string]string
+	if err := json.Unmarshal([]byte(s), &configs); err != nil {
+		return nil, errors.Wrap(err, "parse INTEREST_RATES")
+	}
+	for product, v := range configs {
+		r, err := ParseRate(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "product %s", product)
+		}
+		rates[product] = r
+	}
+	return rates, nil
+}
+
+// Daily returns the interest of a day on the balance, nothing for balances not positive.
+func Daily(balance, annual *big.Rat) *big.Rat {
+	if balance.Sign() <= 0 {
+		return new(big.Rat)
+	}
+	r := new(big.Rat).Mul(balance, annual)
+	return r.Quo(r, big.NewRat(DaysInYear, 1))
+}
+
+// Split rounds the accrued interest down to the cent, it returns the amount paid and the
+// carry left.
+func Split(accrued *big.Rat) (*big.Rat, *big.Rat) {
+	cents := new(big.Rat).Mul(accrued, big.NewRat(100, 1))
+	paid := new(big.Int).Quo(cents.Num(), cents.Denom())
+	amount := new(big.Rat).SetFrac(paid, big.NewInt(100))
+	return amount, new(big.Rat).Sub(accrued, amount)
+}
+
+// Result tells what a run did.
+type Result struct {
+	Accruals int
+	Postings int
+}
+
+// Run accrues the interest of every day before now and posts every month before now's.
+func Run(d *db.DB, rates Rates, now time.Time) (*Result, error) {
+	accruals, err := Accrue(d, rates, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "accrue")
+	}
+	postings, err := Post(d, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "post")
+	}
+	return &Result{Accruals: accruals, Postings: postings}, nil
+}
+
+// Accrue accrues the interest of the accounts for the days since their last accrual, up
+// to the day before until. Accounts start on the day before they first earn interest, or
+// the day they are opened if later. The system accounts and the accounts of closed users
+// earn nothing.
+func Accrue(d *db.DB, rates Rates, until time.Time) (int, error) {
+	accounts, err := d.Accounts()
+	if err != nil {
+		return 0, err
+	}
+	overrides, err := d.InterestRates()
+	if err != nil {
+		return 0, err
+	}
+	system, err := d.InterestAccount()
+	if err != nil {
+		return 0, err
+	}
+	fees, err := d.FeeAccount()
+	if err != nil {
+		return 0, err
+	}
+	end := day(until)
+	n := 0
+	for _, a := range accounts {
+		if a.ID == system.ID || a.ID == fees.ID {
+			continue
+		}
+		owner, err := d.GetUser(a.UserID)
+		if err != nil {
+			return n, errors.Wrapf(err, "owner of account %d", a.ID)
+		}
+		if owner.Status == db.StatusClosed {
+			continue
+		}
+		rate, ok := overrides[a.ID]
+		if !ok {
+			rate, ok = rates[a.Name]
+		}
+		if !ok {
+			rate = new(big.Rat)
+		}
+		added, err := accrueAccount(d, a, rate, end)
+		n += added
+		if err != nil {
+			return n, errors.Wrapf(err, "account %d", a.ID)
+		}
+	}
+	return n, nil
+}
+
+func accrueAccount(d *db.DB, a db.Account, rate *big.Rat, end time.Time) (int, error) {
+	last, err := d.LastAccrualDay(a.ID)
+	if err != nil {
+		return 0, err
+	}
+	if last == "" && rate.Sign() == 0 {
+		return 0, nil
+	}
+	//a new rate does not apply to the past, accounts earning interest keep accruing, at a zero
+	//rate when it is removed, so that adding it back does not either
+	next := day(a.CreatedAt)
+	if yesterday := end.AddDate(0, 0, -1); next.Before(yesterday) {
+		next = yesterday
+	}
+	if last != "" {
+		t, err := time.Parse(db.DayFormat, last)
+		if err != nil {
+			return 0, errors.Wrap(err, "last accrual day")
+		}
+		next = t.AddDate(0, 0, 1)
+	}
+	n := 0
+	for ; next.Before(end); next = next.AddDate(0, 0, 1) {
+		//the balance once every record of the day is in
+		balance, _, err := d.BalanceAt(a.ID, next.AddDate(0, 0, 1).Add(-time.Second))
+		if err != nil {
+			return n, err
+		}
+		added, err := d.AddAccrual(db.Accrual{AccountID: a.ID, Day: next.Format(db.DayFormat), Balance: balance,
+			Rate: rate, Amount: Daily(balance.Rat(), rate)})
+		if err != nil {
+			return n, err
+		}
+		if added {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Post pays the interest accrued by the accounts in every month before the month of until.
+// A month is only posted once the account has accrued its last day.
+func Post(d *db.DB, until time.Time) (int, error) {
+	monthStart := day(until).AddDate(0, 0, 1-day(until).Day())
+	accruals, err := d.UnpostedAccruals(monthStart.Format(db.DayFormat))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for len(accruals) > 0 {
+		//accruals are sorted by account and day, take those of the first month
+		first := accruals[0]
+		month := first.Day[:7]
+		sum := new(big.Rat)
+		i := 0
+		for ; i < len(accruals) && accruals[i].AccountID == first.AccountID && accruals[i].Day[:7] == month; i++ {
+			sum.Add(sum, accruals[i].Amount)
+		}
+		accruals = accruals[i:]
+
+		t, err := time.Parse("2006-01", month)
+		if err != nil {
+			return n, errors.Wrap(err, "month")
+		}
+		lastAccrued, err := d.LastAccrualDay(first.AccountID)
+		if err != nil {
+			return n, err
+		}
+		if lastAccrued < t.AddDate(0, 1, -1).Format(db.DayFormat) {
+			continue
+		}
+		posted, err := postMonth(d, first.AccountID, month, sum)
+		if err != nil {
+			return n, errors.Wrapf(err, "account %d month %s", first.AccountID, month)
+		}
+		if posted {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func postMonth(d *db.DB, accountID int, month string, sum *big.Rat) (bool, error) {
+	carry, err := d.InterestCarry(accountID)
+	if err != nil {
+		return false, err
+	}
+	accrued := new(big.Rat).Add(sum, carry)
+	amount, rest := Split(accrued)
+	paid, err := money.FromRat(amount)
+	if err != nil {
+		return false, err
+	}
+	return d.PostInterest(&db.InterestPosting{AccountID: accountID, Month: month, Accrued: accrued, Amount: paid, Carry: rest})
+}
+
+// day is the start of the UTC day of t.
+func day(t time.Time) time.Time {
+	y, m, dd := t.UTC().Date()
+	return time.Date(y, m, dd, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,192 @@
+package interest
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDbTest() *db.DB {
+	os.Setenv("TEST_ENV", "true")
+	db.Schema = db.SqliteSchema
+	d, err := db.Open()
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func rat(s string) *big.Rat {
+	r, _ := new(big.Rat).SetString(s)
+	return r
+}
+
+func TestParseRate(t *testing.T) {
+	r, err := ParseRate(" 0.035 ")
+	assert.Nil(t, err)
+	assert.Equal(t, "7/200", r.RatString())
+	for _, s := range []string{"", "abc", "-0.01", "1.5", "1/2", "1e-2"} {
+		_, err := ParseRate(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestLoadRates(t *testing.T) {
+	os.Unsetenv("INTEREST_RATES")
+	rates, err := LoadRates()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rates))
+
+	os.Setenv("INTEREST_RATES", `{"savings":"0.035"}`)
+	defer os.Unsetenv("INTEREST_RATES")
+	rates, err = LoadRates()
+	assert.Nil(t, err)
+	assert.Equal(t, "7/200", rates["savings"].RatString())
+
+	os.Setenv("INTEREST_RATES", `{"savings":"2"}`)
+	_, err = LoadRates()
+	assert.NotNil(t, err)
+	os.Setenv("INTEREST_RATES", `[]`)
+	_, err = LoadRates()
+	assert.NotNil(t, err)
+}
+
+func TestDailyAndSplit(t *testing.T) {
+	assert.Equal(t, "1/10", Daily(rat("1000"), rat("0.0365")).RatString())
+	assert.Equal(t, "1/73", Daily(rat("100"), rat("0.05")).RatString())
+	assert.Equal(t, 0, Daily(rat("-100"), rat("0.05")).Sign())
+	assert.Equal(t, 0, Daily(rat("0"), rat("0.05")).Sign())
+
+	amount, carry := Split(rat("31/73"))
+	assert.Equal(t, "0.42", amount.FloatString(2))
+	assert.Equal(t, "31/73", new(big.Rat).Add(amount, carry).RatString())
+	amount, carry = Split(rat("0.009"))
+	assert.Equal(t, 0, amount.Sign())
+	assert.Equal(t, "9/1000", carry.RatString())
+}
+
+func TestRun(t *testing.T) {
+	d := setupDbTest()
+	u, err := d.AddUser("alice", money.MustParse("100"))
+	assert.Nil(t, err)
+	other, err := d.AddUser("bob", money.MustParse("100"))
+	assert.Nil(t, err)
+	rates := Rates{db.DefaultAccount: rat("0.05")}
+	//bob's account earns nothing
+	assert.Nil(t, d.SetInterestRate(other.MainAccount, new(big.Rat)))
+
+	today := day(time.Now())
+	first := today.AddDate(0, 0, 1-today.Day())
+	next := first.AddDate(0, 1, 0)
+	end := first.AddDate(0, 2, 0)
+
+	//one run a day, like the job, a month is not posted before its last day is accrued
+	accruals, postings := 0, 0
+	for until := today.AddDate(0, 0, 1); !until.After(end); until = until.AddDate(0, 0, 1) {
+		r, err := Run(d, rates, until)
+		assert.Nil(t, err)
+		accruals += r.Accruals
+		postings += r.Postings
+		if until.Before(next) {
+			assert.Equal(t, 0, postings)
+		}
+	}
+	days1 := int64(next.Sub(today).Hours() / 24)
+	days2 := int64(end.Sub(next).Hours() / 24)
+	assert.Equal(t, int(days1+days2), accruals)
+	assert.Equal(t, 2, postings)
+
+	ps, err := d.InterestPostings(u.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ps))
+	assert.Equal(t, first.Format("2006-01"), ps[0].Month)
+	accrued1 := new(big.Rat).Mul(Daily(rat("100"), rat("0.05")), big.NewRat(days1, 1))
+	assert.Equal(t, accrued1.RatString(), ps[0].Accrued.RatString())
+	amount1, carry1 := Split(accrued1)
+	assert.Equal(t, amount1.FloatString(2), ps[0].Amount.String())
+	assert.Equal(t, carry1.RatString(), ps[0].Carry.RatString())
+	assert.NotZero(t, ps[0].RecordID)
+
+	//the second month earns on the interest paid and the carry
+	balance := new(big.Rat).Add(rat("100"), amount1)
+	accrued2 := new(big.Rat).Mul(Daily(balance, rat("0.05")), big.NewRat(days2, 1))
+	accrued2.Add(accrued2, carry1)
+	assert.Equal(t, accrued2.RatString(), ps[1].Accrued.RatString())
+	amount2, _ := Split(accrued2)
+
+	a, err := d.GetAccount(u.MainAccount)
+	assert.Nil(t, err)
+	paid := new(big.Rat).Add(amount1, amount2)
+	assert.Equal(t, new(big.Rat).Add(rat("100"), paid).FloatString(2), a.Balance.String())
+	system, err := d.InterestAccount()
+	assert.Nil(t, err)
+	assert.Equal(t, new(big.Rat).Neg(paid).FloatString(2), system.Balance.String())
+
+	ps, err = d.InterestPostings(other.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ps))
+
+	//a rerun does nothing
+	r, err := Run(d, rates, end)
+	assert.Nil(t, err)
+	assert.Equal(t, &Result{}, r)
+	a, err = d.GetAccount(u.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, new(big.Rat).Add(rat("100"), paid).FloatString(2), a.Balance.String())
+
+	rec, err := d.Reconcile()
+	assert.Nil(t, err)
+	assert.True(t, rec.OK)
+}
+
+func TestAccrueNewRate(t *testing.T) {
+	d := setupDbTest()
+	u, err := d.AddUser("alice", money.MustParse("100"))
+	assert.Nil(t, err)
+	today := day(time.Now())
+
+	//no rate, nothing accrues
+	n, err := Accrue(d, Rates{}, today.AddDate(0, 0, 5))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	//a rate set later only applies from the day before the run
+	assert.Nil(t, d.SetInterestRate(u.MainAccount, rat("0.05")))
+	n, err = Accrue(d, Rates{}, today.AddDate(0, 0, 10))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	//once removed the account keeps accruing, at zero
+	assert.Nil(t, d.SetInterestRate(u.MainAccount, nil))
+	n, err = Accrue(d, Rates{}, today.AddDate(0, 0, 12))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	last, err := d.LastAccrualDay(u.MainAccount)
+	assert.Nil(t, err)
+	assert.Equal(t, today.AddDate(0, 0, 11).Format(db.DayFormat), last)
+}
+
+func TestAccrueSkipsAccounts(t *testing.T) {
+	d := setupDbTest()
+	u, err := d.AddUser("alice", 0)
+	assert.Nil(t, err)
+	_, err = d.SetUserStatus(u.ID, db.StatusClosed, "ops", "customer request")
+	assert.Nil(t, err)
+	fees, err := d.FeeAccount()
+	assert.Nil(t, err)
+
+	//the fee account and closed accounts earn nothing, whatever the rate of their product
+	n, err := Accrue(d, Rates{db.DefaultAccount: rat("0.05")}, day(time.Now()).AddDate(0, 0, 3))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	for _, id := range []int{u.MainAccount, fees.ID} {
+		last, err := d.LastAccrualDay(id)
+		assert.Nil(t, err)
+		assert.Equal(t, "", last)
+	}
+}
@@ -1,17 +1,18 @@
 package main
 
 import (
+	"code_challenge1/cmd"
 	"code_challenge1/log"
-	"code_challenge1/server"
+	"os"
 )
 
 func main() {
-
-	s, err := server.NewServer()
-	if err != nil {
-		panic(err)
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"serve"}
 	}
-	if err := s.Serve(":8080"); err != nil {
-		log.Errorf("serve server error: %v", err)
+	if err := cmd.Run(args); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
 	}
 }
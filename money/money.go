@@ -0,0 +1,221 @@
+// Package money holds amounts of the currency as a whole number of cents.
+//
+// Amounts are read only from plain decimal strings, eg. 10, -3.5 or 0.25, never fractions
+// or exponents, and with at most Decimals digits after the point besides trailing zeros.
+// ParseDecimal reads the rates applied to amounts the same way, with any number of decimals.
+// Parsing and arithmetic fail instead of wrapping around when an amount does not fit.
+package money
+
+import (
+	"database/sql/driver"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Decimals is the number of digits after the decimal point of the currency.
+const Decimals = 2
+
+// scale is the number of cents in a unit.
+const scale = 100
+
+var (
+	ErrSyntax    = errors.New("amount should be a plain decimal, eg. 10.02")
+	ErrPrecision = errors.Errorf("amount should only have at most %d decimals, eg. 10.02", Decimals)
+	ErrOverflow  = errors.New("amount is out of range")
+)
+
+// Max is the largest amount, Min is -Max so every amount can be negated.
+const (
+	Max Money = math.MaxInt64
+	Min Money = -Max
+)
+
+// Money is an amount in cents.
+type Money int64
+
+// Parse reads a plain decimal string, surrounding spaces ignored.
+func Parse(s string) (Money, error) {
+	neg, units, frac, ok := split(s)
+	if !ok {
+		return 0, errors.Wrapf(ErrSyntax, "%q", s)
+	}
+	if len(frac) > Decimals {
+		if strings.Trim(frac[Decimals:], "0") != "" {
+			return 0, errors.Wrapf(ErrPrecision, "%q", s)
+		}
+		frac = frac[:Decimals]
+	}
+	frac += strings.Repeat("0", Decimals-len(frac))
+	n, err := strconv.ParseInt(units+frac, 10, 64)
+	if err != nil {
+		//only digits got here, so the number is too large
+		return 0, errors.Wrapf(ErrOverflow, "%q", s)
+	}
+	if neg {
+		n = -n
+	}
+	return Money(n), nil
+}
+
+// MustParse is Parse panicking on error, for amounts written in code.
+func MustParse(s string) Money {
+	m, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// ParseDecimal reads a plain decimal string like Parse, exactly and with any number of
+// decimals, for the rates and factors applied to amounts.
+func ParseDecimal(s string) (*big.Rat, error) {
+	neg, units, frac, ok := split(s)
+	if !ok {
+		return nil, errors.Wrapf(ErrSyntax, "%q", s)
+	}
+	//only digits are left, big.Rat reads them exactly, the zero appended changes nothing but
+	//makes a number without decimals end with a digit too
+	r, _ := new(big.Rat).SetString(units + "." + frac + "0")
+	if neg {
+		r.Neg(r)
+	}
+	return r, nil
+}
+
+// split reads the sign, the digits before the point and those after it of a plain decimal.
+func split(s string) (neg bool, units, frac string, ok bool) {
+	t := strings.TrimSpace(s)
+	if t != "" && (t[0] == '-' || t[0] == '+') {
+		neg = t[0] == '-'
+		t = t[1:]
+	}
+	units, frac, hasPoint := strings.Cut(t, ".")
+	if !digits(units) || (hasPoint && !digits(frac)) {
+		return false, "", "", false
+	}
+	return neg, units, frac, true
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromRat converts an exact amount, eg. a fee worked out as a fraction and rounded.
+func FromRat(r *big.Rat) (Money, error) {
+	cents := new(big.Rat).Mul(r, big.NewRat(scale, 1))
+	if !cents.IsInt() {
+		return 0, errors.Wrapf(ErrPrecision, "%s", r.RatString())
+	}
+	n := cents.Num()
+	if !n.IsInt64() || Money(n.Int64()) < Min {
+		return 0, errors.Wrapf(ErrOverflow, "%s", r.RatString())
+	}
+	return Money(n.Int64()), nil
+}
+
+// Rat returns the amount in units.
+func (m Money) Rat() *big.Rat {
+	return big.NewRat(int64(m), scale)
+}
+
+// String formats the amount with Decimals digits, eg. -10.50.
+func (m Money) String() string {
+	sign := ""
+	n := uint64(m)
+	if m < 0 {
+		sign = "-"
+		n = uint64(-m)
+	}
+	return sign + strconv.FormatUint(n/scale, 10) + "." + strconv.FormatUint(n%scale+scale, 10)[1:]
+}
+
+func (m Money) Sign() int {
+	switch {
+	case m < 0:
+		return -1
+	case m > 0:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) Neg() Money {
+	return -m
+}
+
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Add returns m+o, failing when it is out of range.
+func (m Money) Add(o Money) (Money, error) {
+	s := m + o
+	if (o > 0 && s < m) || (o < 0 && s > m) || s < Min {
+		return 0, errors.Wrapf(ErrOverflow, "%s + %s", m, o)
+	}
+	return s, nil
+}
+
+// Sub returns m-o, failing when it is out of range.
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(-o)
+}
+
+// MarshalText encodes the amount as String does, in json too.
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText reads the amount as Parse does.
+func (m *Money) UnmarshalText(b []byte) error {
+	v, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Value stores the amount as its cents.
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// Scan reads the cents stored by Value.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		*m = Money(v)
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return errors.Errorf("cannot scan %T into money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return errors.Wrapf(ErrOverflow, "stored amount %q", s)
+	}
+	*m = Money(n)
+	return nil
+}
@@ -0,0 +1,130 @@
+package money
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for s, want := range map[string]Money{
+		"10":                    1000,
+		" 10.5 ":                1050,
+		"-3.25":                 -325,
+		"+0.01":                 1,
+		"007.10":                710,
+		"1.500":                 150,
+		"0":                     0,
+		"92233720368547758.07":  Max,
+		"-92233720368547758.07": Min,
+	} {
+		m, err := Parse(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, m, s)
+	}
+
+	for s, want := range map[string]error{
+		"":                       ErrSyntax,
+		"1/3":                    ErrSyntax,
+		"1e3":                    ErrSyntax,
+		".5":                     ErrSyntax,
+		"5.":                     ErrSyntax,
+		"--1":                    ErrSyntax,
+		"1,000":                  ErrSyntax,
+		"0x10":                   ErrSyntax,
+		"10.005":                 ErrPrecision,
+		"0.001":                  ErrPrecision,
+		"92233720368547758.08":   ErrOverflow,
+		"-92233720368547758.08":  ErrOverflow,
+		"1000000000000000000000": ErrOverflow,
+	} {
+		_, err := Parse(s)
+		assert.True(t, errors.Is(err, want), s)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for s, want := range map[string]string{
+		"0.035":   "7/200",
+		" 2 ":     "2",
+		"-1.5":    "-3/2",
+		"+0.0001": "1/10000",
+		"010.50":  "21/2",
+	} {
+		r, err := ParseDecimal(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, r.RatString(), s)
+	}
+	for _, s := range []string{"", "1/3", "1e3", ".5", "5.", "--1", "1,5", "Inf"} {
+		_, err := ParseDecimal(s)
+		assert.True(t, errors.Is(err, ErrSyntax), s)
+	}
+}
+
+func TestMustParse(t *testing.T) {
+	assert.Equal(t, Money(-1050), MustParse("-10.50"))
+	assert.Panics(t, func() { MustParse("1/2") })
+}
+
+func TestFromRat(t *testing.T) {
+	m, err := FromRat(big.NewRat(21, 2))
+	assert.Nil(t, err)
+	assert.Equal(t, Money(1050), m)
+	_, err = FromRat(big.NewRat(1, 3))
+	assert.True(t, errors.Is(err, ErrPrecision))
+	big1, _ := new(big.Rat).SetString("1e20")
+	_, err = FromRat(big1)
+	assert.True(t, errors.Is(err, ErrOverflow))
+	assert.Equal(t, "-21/2", Money(-1050).Rat().RatString())
+}
+
+func TestMoney_String(t *testing.T) {
+	assert.Equal(t, "10.50", Money(1050).String())
+	assert.Equal(t, "-0.05", Money(-5).String())
+	assert.Equal(t, "0.00", Money(0).String())
+	assert.Equal(t, "92233720368547758.07", Max.String())
+	assert.Equal(t, "-92233720368547758.07", Min.String())
+}
+
+func TestMoney_Add(t *testing.T) {
+	s, err := Money(150).Add(-200)
+	assert.Nil(t, err)
+	assert.Equal(t, Money(-50), s)
+	s, err = Money(150).Sub(200)
+	assert.Nil(t, err)
+	assert.Equal(t, Money(-50), s)
+	_, err = Max.Add(1)
+	assert.True(t, errors.Is(err, ErrOverflow))
+	_, err = Min.Sub(1)
+	assert.True(t, errors.Is(err, ErrOverflow))
+	assert.Equal(t, Max, Min.Abs())
+	assert.Equal(t, -1, Money(-3).Sign())
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var v struct {
+		Amount Money `json:"amount"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(`{"amount":"10.5"}`), &v))
+	assert.Equal(t, Money(1050), v.Amount)
+	b, err := json.Marshal(v)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"amount":"10.50"}`, string(b))
+	assert.NotNil(t, json.Unmarshal([]byte(`{"amount":"1/2"}`), &v))
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var m Money
+	assert.Nil(t, m.Scan(int64(1050)))
+	assert.Equal(t, Money(1050), m)
+	assert.Nil(t, m.Scan([]byte("-25")))
+	assert.Equal(t, Money(-25), m)
+	assert.NotNil(t, m.Scan("99999999999999999999"))
+	assert.NotNil(t, m.Scan(1.5))
+	v, err := m.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-25), v)
+}
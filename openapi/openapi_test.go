@@ -0,0 +1,106 @@
+package openapi
+
+import (
+	"code_challenge1/money"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type legIn struct {
+	To     int    `json:"to" binding:"required"`
+	Amount string `json:"amount" binding:"required"`
+}
+
+type payIn struct {
+	Key    string          `json:"key" binding:"required"`
+	Legs   []legIn         `json:"legs" binding:"required,dive"`
+	Active *bool           `json:"active"`
+	Note   string          `json:"note,omitempty"`
+	Meta   json.RawMessage `json:"meta"`
+	Skip   string          `json:"-"`
+	hidden string
+}
+
+type out struct {
+	Total     *big.Rat
+	Fee       money.Money
+	CreatedAt time.Time `json:"created_at"`
+	Tags      map[string]int
+}
+
+func TestDocument_SchemaOf(t *testing.T) {
+	d := NewDocument("test", "1")
+	s := d.SchemaOf(payIn{})
+	assert.Equal(t, "#/components/schemas/payIn", s.Ref)
+
+	pay := d.Resolve(s)
+	assert.Equal(t, "object", pay.Type)
+	assert.Equal(t, []string{"key", "legs"}, pay.Required)
+	assert.Equal(t, 5, len(pay.Properties))
+	assert.True(t, pay.Properties["active"].Nullable)
+	assert.Equal(t, "", pay.Properties["meta"].Type)
+	assert.Equal(t, "array", pay.Properties["legs"].Type)
+	assert.Equal(t, "#/components/schemas/legIn", pay.Properties["legs"].Items.Ref)
+	assert.Equal(t, []string{"to", "amount"}, d.Components.Schemas["legIn"].Required)
+
+	o := d.Resolve(d.SchemaOf(&out{}))
+	assert.Equal(t, "decimal", o.Properties["Total"].Format)
+	assert.Equal(t, "string", o.Properties["Fee"].Type)
+	assert.Equal(t, "date-time", o.Properties["created_at"].Format)
+	assert.Equal(t, "integer", o.Properties["Tags"].AdditionalProperties.Type)
+
+	assert.Equal(t, "array", d.SchemaOf([]out{}).Type)
+	assert.Equal(t, "string", d.SchemaOf("").Type)
+	assert.Equal(t, &Schema{}, d.SchemaOf(nil))
+}
+
+func TestDocument_Operation(t *testing.T) {
+	d := NewDocument("test", "1")
+	op := &Operation{Summary: "pay"}
+	d.Add("POST", "/pay", op)
+	assert.Equal(t, op, d.Operation("post", "/pay"))
+	assert.Nil(t, d.Operation("GET", "/pay"))
+	assert.Nil(t, d.Operation("POST", "/other"))
+
+	data, err := json.Marshal(d)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"openapi":"3.0.3"`)
+	assert.Contains(t, string(data), `"post":{"summary":"pay"`)
+}
+
+func TestDocument_Validate(t *testing.T) {
+	d := NewDocument("test", "1")
+	s := d.SchemaOf(payIn{})
+
+	assert.Nil(t, d.Validate(s, []byte(`{"key":"k","legs":[{"to":1,"amount":"1.5"}],"active":null,"meta":{"a":[1]},"extra":1}`)))
+	assert.Nil(t, d.Validate(s, []byte(`{"key":"k","legs":[],"active":true,"note":"n"}`)))
+
+	for body, want := range map[string]string{
+		``:                        "request body is not valid json: EOF",
+		`[]`:                      "request body should be an object",
+		`{"key":"k"} {}`:          "request body has data after the json value",
+		`{"legs":[]}`:             "field key is required",
+		`{"key":1,"legs":[]}`:     "field key should be a string",
+		`{"key":null,"legs":[]}`:  "field key should not be null",
+		`{"key":"k","legs":{}}`:   "field legs should be an array",
+		`{"key":"k","legs":[{}]}`: "field legs[0].to is required",
+		`{"key":"k","legs":[1]}`:  "field legs[0] should be an object",
+		`{"key":"k","legs":[{"to":1.5,"amount":"1"}]}`: "field legs[0].to should be an integer",
+		`{"key":"k","legs":[{"to":"1","amount":"1"}]}`: "field legs[0].to should be an integer",
+		`{"key":"k","legs":[],"active":"yes"}`:         "field active should be a boolean",
+	} {
+		err := d.Validate(s, []byte(body))
+		var verr *ValidationError
+		assert.True(t, errors.As(err, &verr), body)
+		assert.EqualError(t, err, want, body)
+	}
+
+	assert.Nil(t, d.Validate(&Schema{Type: "number"}, []byte(`1.5`)))
+	assert.NotNil(t, d.Validate(&Schema{Type: "number"}, []byte(`"1.5"`)))
+	assert.NotNil(t, d.Validate(&Schema{Type: "file"}, []byte(`1`)))
+}
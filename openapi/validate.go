@@ -0,0 +1,125 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ValidationError tells which field of the body does not match the schema, Field is empty
+// for the body itself.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return "request body " + e.Reason
+	}
+	return fmt.Sprintf("field %s %s", e.Field, e.Reason)
+}
+
+// Validate checks the json data against the schema: types, required and nullable fields.
+// Fields the schema does not know are let through, as the json binding of the handlers does.
+func (d *Document) Validate(s *Schema, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return &ValidationError{Reason: "is not valid json: " + err.Error()}
+	}
+	if dec.More() {
+		return &ValidationError{Reason: "has data after the json value"}
+	}
+	return d.validate(s, v, "")
+}
+
+func (d *Document) validate(s *Schema, v interface{}, field string) error {
+	s = d.Resolve(s)
+	if s == nil || s.Type == "" {
+		return nil
+	}
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return &ValidationError{Field: field, Reason: "should not be null"}
+	}
+	switch s.Type {
+	case "string":
+		if _, ok := v.(string); !ok {
+			return mismatch(field, "a string")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return mismatch(field, "a boolean")
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch(field, "an integer")
+		}
+		if _, err := n.Int64(); err != nil {
+			return mismatch(field, "an integer")
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return mismatch(field, "a number")
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return mismatch(field, "an array")
+		}
+		for i, item := range items {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		return d.validateObject(s, v, field)
+	default:
+		return errors.Errorf("schema type %q is not supported", s.Type)
+	}
+	return nil
+}
+
+func (d *Document) validateObject(s *Schema, v interface{}, field string) error {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return mismatch(field, "an object")
+	}
+	prefix := ""
+	if field != "" {
+		prefix = field + "."
+	}
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			return &ValidationError{Field: prefix + name, Reason: "is required"}
+		}
+	}
+	//sorted, so the same body always reports the same error
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fs, ok := s.Properties[name]
+		if !ok {
+			fs = s.AdditionalProperties
+		}
+		if err := d.validate(fs, obj[name], prefix+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mismatch(field, want string) error {
+	return &ValidationError{Field: field, Reason: "should be " + want}
+}
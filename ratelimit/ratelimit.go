@@ -0,0 +1,118 @@
+// Package ratelimit limits how often callers hit the api, with a token bucket per caller
+// and route.
+package ratelimit
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AnyRoute is the route of the rule for the routes without a rule of their own.
+const AnyRoute = "*"
+
+// Rule lets a caller make Rate requests to the route every Per, and up to Burst at once.
+type Rule struct {
+	Route string `json:"route"`
+	Rate  int    `json:"rate"`
+	Per   string `json:"per"`
+	Burst int    `json:"burst"`
+}
+
+// Limit is a token bucket refilled with Rate tokens a second up to Burst.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (r Rule) Limit() (Limit, error) {
+	per, err := time.ParseDuration(r.Per)
+	if err != nil {
+		return Limit{}, errors.Wrap(err, "per")
+	}
+	if per <= 0 || r.Rate <= 0 {
+		return Limit{}, errors.Errorf("rate and per should be positive")
+	}
+	burst := r.Burst
+	if burst <= 0 {
+		burst = r.Rate
+	}
+	return Limit{Rate: float64(r.Rate) / per.Seconds(), Burst: burst}, nil
+}
+
+// Rules are the limits by route.
+type Rules map[string]Limit
+
+func NewRules(configs []Rule) (Rules, error) {
+	rules := Rules{}
+	for _, c := range configs {
+		route := strings.TrimSpace(c.Route)
+		if route == "" {
+			return nil, errors.Errorf("rule route should not be empty")
+		}
+		l, err := c.Limit()
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %s", route)
+		}
+		rules[route] = l
+	}
+	return rules, nil
+}
+
+// For returns the limit of the route and the bucket it takes from, the route itself or
+// AnyRoute, shared by all the routes without a rule. ok is false when nothing limits the route.
+func (rs Rules) For(route string) (bucket string, l Limit, ok bool) {
+	if l, ok := rs[route]; ok {
+		return route, l, true
+	}
+	l, ok = rs[AnyRoute]
+	return AnyRoute, l, ok
+}
+
+// DefaultRules is used when RATE_LIMITS is not set: routes moving money are limited
+// tighter than the rest.
+func DefaultRules() []Rule {
+	rules := []Rule{{Route: AnyRoute, Rate: 100, Per: "1s", Burst: 200}}
+	for _, route := range []string{"/deposit", "/transfer", "/transfer/batch", "/account/transfer"} {
+		rules = append(rules, Rule{Route: route, Rate: 10, Per: "1s", Burst: 20})
+	}
+	return rules
+}
+
+// LoadRules reads the rules as a json array from the RATE_LIMITS environment variable,
+// falling back to DefaultRules. An empty array turns rate limiting off.
+func LoadRules() ([]Rule, error) {
+	s := strings.TrimSpace(os.Getenv("RATE_LIMITS"))
+	if s == "" {
+		return DefaultRules(), nil
+	}
+	var configs []Rule
+	if err := json.Unmarshal([]byte(s), &configs); err != nil {
+		return nil, errors.Wrap(err, "parse RATE_LIMITS")
+	}
+	return configs, nil
+}
+
+// Limiter hands out the tokens of the buckets.
+type Limiter interface {
+	// Take takes a token from the bucket of key. Without one left it returns false and how
+	// long until the next one.
+	Take(key string, l Limit) (bool, time.Duration, error)
+}
+
+// take refills a bucket holding tokens since updated and takes a token from it, it returns
+// the tokens left.
+func take(tokens float64, updated, now time.Time, l Limit) (float64, bool, time.Duration) {
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(float64(l.Burst), tokens+elapsed*l.Rate)
+	}
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	wait := time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	return tokens, false, wait
+}
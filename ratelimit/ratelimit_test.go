@@ -0,0 +1,166 @@
+package ratelimit
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRule_Limit(t *testing.T) {
+	l, err := Rule{Rate: 10, Per: "1m", Burst: 5}.Limit()
+	assert.Nil(t, err)
+	assert.InDelta(t, 10.0/60, l.Rate, 1e-9)
+	assert.Equal(t, 5, l.Burst)
+
+	l, err = Rule{Rate: 3, Per: "1s"}.Limit()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, l.Burst)
+
+	_, err = Rule{Rate: 3, Per: "abc"}.Limit()
+	assert.NotNil(t, err)
+	_, err = Rule{Rate: 0, Per: "1s"}.Limit()
+	assert.NotNil(t, err)
+}
+
+func TestRules(t *testing.T) {
+	rules, err := NewRules(DefaultRules())
+	assert.Nil(t, err)
+	bucket, l, ok := rules.For("/transfer")
+	assert.True(t, ok)
+	assert.Equal(t, "/transfer", bucket)
+	assert.Equal(t, 20, l.Burst)
+	bucket, l, ok = rules.For("/user/balance")
+	assert.True(t, ok)
+	assert.Equal(t, AnyRoute, bucket)
+	assert.Equal(t, 200, l.Burst)
+
+	rules, err = NewRules([]Rule{{Route: "/transfer", Rate: 1, Per: "1s"}})
+	assert.Nil(t, err)
+	_, _, ok = rules.For("/user/balance")
+	assert.False(t, ok)
+
+	_, err = NewRules([]Rule{{Route: " ", Rate: 1, Per: "1s"}})
+	assert.NotNil(t, err)
+	_, err = NewRules([]Rule{{Route: "*", Rate: 1}})
+	assert.NotNil(t, err)
+}
+
+func TestLoadRules(t *testing.T) {
+	os.Unsetenv("RATE_LIMITS")
+	rules, err := LoadRules()
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultRules(), rules)
+
+	os.Setenv("RATE_LIMITS", `[{"route":"*","rate":5,"per":"1s","burst":10}]`)
+	rules, err = LoadRules()
+	assert.Nil(t, err)
+	assert.Equal(t, []Rule{{Route: "*", Rate: 5, Per: "1s", Burst: 10}}, rules)
+
+	os.Setenv("RATE_LIMITS", `[]`)
+	rules, err = LoadRules()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rules))
+
+	os.Setenv("RATE_LIMITS", `{`)
+	_, err = LoadRules()
+	assert.NotNil(t, err)
+	os.Unsetenv("RATE_LIMITS")
+}
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func TestMemory_Take(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	m := NewMemory()
+	m.now = c.now
+	l := Limit{Rate: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		ok, _, err := m.Take("a", l)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	ok, wait, _ := m.Take("a", l)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	//other keys have their own bucket
+	ok, _, _ = m.Take("b", l)
+	assert.True(t, ok)
+
+	c.t = c.t.Add(250 * time.Millisecond)
+	ok, wait, _ = m.Take("a", l)
+	assert.False(t, ok)
+	assert.Equal(t, 250*time.Millisecond, wait)
+	c.t = c.t.Add(250 * time.Millisecond)
+	ok, _, _ = m.Take("a", l)
+	assert.True(t, ok)
+
+	//refills up to the burst only
+	c.t = c.t.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _, _ = m.Take("a", l)
+		assert.True(t, ok)
+	}
+	ok, _, _ = m.Take("a", l)
+	assert.False(t, ok)
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	m := NewMemory()
+	m.now = c.now
+	_, _, _ = m.Take("slow", Limit{Rate: 0.001, Burst: 1})
+	_, _, _ = m.Take("fast", Limit{Rate: 1, Burst: 1})
+	assert.Equal(t, 2, m.Len())
+
+	c.t = c.t.Add(time.Minute)
+	m.sweep(c.now())
+	assert.Equal(t, 1, m.Len())
+	ok, _, _ := m.Take("slow", Limit{Rate: 0.001, Burst: 1})
+	assert.False(t, ok)
+}
+
+// mapStore is a Store in memory.
+type mapStore map[string]struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (s mapStore) UpdateRateBucket(key string, update func(float64, time.Time, bool) (float64, time.Time)) error {
+	b, found := s[key]
+	b.tokens, b.updated = update(b.tokens, b.updated, found)
+	s[key] = b
+	return nil
+}
+
+func TestShared_Take(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	store := mapStore{}
+	s := NewShared(store)
+	s.now = c.now
+	l := Limit{Rate: 1, Burst: 2}
+
+	ok, _, err := s.Take("a", l)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, _, _ = s.Take("a", l)
+	assert.True(t, ok)
+	ok, wait, _ := s.Take("a", l)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	assert.Equal(t, 0.0, store["a"].tokens)
+
+	//another instance on the same store shares the budget
+	other := NewShared(store)
+	other.now = c.now
+	ok, _, _ = other.Take("a", l)
+	assert.False(t, ok)
+	c.t = c.t.Add(time.Second)
+	ok, _, _ = other.Take("a", l)
+	assert.True(t, ok)
+}
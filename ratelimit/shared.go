@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Store keeps buckets for several instances, implemented by db.DB.
+type Store interface {
+	UpdateRateBucket(key string, update func(tokens float64, updated time.Time, found bool) (float64, time.Time)) error
+}
+
+// Shared keeps the buckets in the database, so that all instances of the server enforce
+// one budget per caller.
+type Shared struct {
+	store Store
+	now   func() time.Time
+}
+
+func NewShared(s Store) *Shared {
+	return &Shared{store: s, now: time.Now}
+}
+
+func (s *Shared) Take(key string, l Limit) (bool, time.Duration, error) {
+	var allowed bool
+	var wait time.Duration
+	err := s.store.UpdateRateBucket(key, func(tokens float64, updated time.Time, found bool) (float64, time.Time) {
+		now := s.now()
+		if !found {
+			tokens, updated = float64(l.Burst), now
+		}
+		tokens, allowed, wait = take(tokens, updated, now, l)
+		return tokens, now
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, wait, nil
+}
@@ -0,0 +1,111 @@
+// Package risk screens transfers against a set of declarative rules before any money moves.
+package risk
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Action string
+
+const (
+	Allow Action = "allow"
+	Flag  Action = "flag"
+	Block Action = "block"
+)
+
+// severity orders actions so the strictest outcome of all rules wins.
+func (a Action) severity() int {
+	switch a {
+	case Block:
+		return 2
+	case Flag:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type Transfer struct {
+	FromUser int
+	ToUser   int
+	Amount   *big.Rat
+}
+
+// History is the view of past transfers the rules need, implemented by db.DB.
+type History interface {
+	HasTransferred(fromUser, toUser int) (bool, error)
+	AverageTransfer(fromUser int) (avg *big.Rat, count int, err error)
+	TransfersSince(fromUser int, since time.Time) (int, error)
+}
+
+type Decision struct {
+	Action  Action
+	Reasons []string
+}
+
+type Engine struct {
+	history History
+	rules   []Rule
+}
+
+func NewEngine(h History, configs []RuleConfig) (*Engine, error) {
+	e := &Engine{history: h}
+	for _, c := range configs {
+		r, err := c.Rule()
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %s", c.Type)
+		}
+		e.rules = append(e.rules, r)
+	}
+	return e, nil
+}
+
+// Evaluate runs every rule against the transfer, the decision is the strictest action
+// returned, with the reasons of every rule that triggered.
+func (e *Engine) Evaluate(t Transfer) (*Decision, error) {
+	d := &Decision{Action: Allow}
+	for _, r := range e.rules {
+		a, reason, err := r.Evaluate(e.history, t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "evaluate rule %s", r.Name())
+		}
+		if a == Allow {
+			continue
+		}
+		d.Reasons = append(d.Reasons, reason)
+		if a.severity() > d.Action.severity() {
+			d.Action = a
+		}
+	}
+	return d, nil
+}
+
+// DefaultRules is used when RISK_RULES is not set.
+func DefaultRules() []RuleConfig {
+	return []RuleConfig{
+		{Type: RuleNewRecipient, Action: Flag, MinAmount: "1000"},
+		{Type: RuleAboveAverage, Action: Flag, Factor: "5", MinHistory: 3},
+		{Type: RuleBurst, Action: Block, Window: "1m", Max: 10},
+		{Type: RuleRoundAmount, Action: Flag, Multiple: "1000", MinAmount: "5000"},
+	}
+}
+
+// LoadRules reads the rule set as a json array from the RISK_RULES environment variable,
+// falling back to DefaultRules.
+func LoadRules() ([]RuleConfig, error) {
+	s := strings.TrimSpace(os.Getenv("RISK_RULES"))
+	if s == "" {
+		return DefaultRules(), nil
+	}
+	var configs []RuleConfig
+	if err := json.Unmarshal([]byte(s), &configs); err != nil {
+		return nil, errors.Wrap(err, "parse RISK_RULES")
+	}
+	return configs, nil
+}
@@ -0,0 +1,105 @@
+package risk
+
+import (
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeHistory struct {
+	transferred bool
+	avg         *big.Rat
+	count       int
+	recent      int
+}
+
+func (f *fakeHistory) HasTransferred(int, int) (bool, error) {
+	return f.transferred, nil
+}
+
+func (f *fakeHistory) AverageTransfer(int) (*big.Rat, int, error) {
+	return f.avg, f.count, nil
+}
+
+func (f *fakeHistory) TransfersSince(int, time.Time) (int, error) {
+	return f.recent, nil
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	h := &fakeHistory{transferred: true, avg: big.NewRat(10, 1), count: 5}
+	e, err := NewEngine(h, DefaultRules())
+	assert.Nil(t, err)
+
+	d, err := e.Evaluate(Transfer{FromUser: 1, ToUser: 2, Amount: big.NewRat(12, 1)})
+	assert.Nil(t, err)
+	assert.Equal(t, Allow, d.Action)
+	assert.Empty(t, d.Reasons)
+
+	//5 times above average
+	d, err = e.Evaluate(Transfer{FromUser: 1, ToUser: 2, Amount: big.NewRat(51, 1)})
+	assert.Nil(t, err)
+	assert.Equal(t, Flag, d.Action)
+	assert.Equal(t, 1, len(d.Reasons))
+
+	//new recipient and round amount
+	h.transferred = false
+	h.avg = big.NewRat(10000, 1)
+	d, err = e.Evaluate(Transfer{FromUser: 1, ToUser: 2, Amount: big.NewRat(6000, 1)})
+	assert.Nil(t, err)
+	assert.Equal(t, Flag, d.Action)
+	assert.Equal(t, 2, len(d.Reasons))
+
+	//burst blocks, block wins over flag
+	h.recent = 10
+	d, err = e.Evaluate(Transfer{FromUser: 1, ToUser: 2, Amount: big.NewRat(6000, 1)})
+	assert.Nil(t, err)
+	assert.Equal(t, Block, d.Action)
+	assert.Equal(t, 3, len(d.Reasons))
+}
+
+func TestRuleConfig_Rule(t *testing.T) {
+	for _, c := range DefaultRules() {
+		_, err := c.Rule()
+		assert.Nil(t, err)
+	}
+	bad := []RuleConfig{
+		{Type: RuleNewRecipient, Action: Allow},
+		{Type: "unknown", Action: Flag},
+		{Type: RuleNewRecipient, Action: Flag, MinAmount: "abc"},
+		{Type: RuleNewRecipient, Action: Flag, MinAmount: "1e3"},
+		{Type: RuleNewRecipient, Action: Flag, MinAmount: "0.001"},
+		{Type: RuleAboveAverage, Action: Flag, Factor: "-1"},
+		{Type: RuleAboveAverage, Action: Flag, Factor: "1/3"},
+		{Type: RuleBurst, Action: Flag, Window: "abc", Max: 1},
+		{Type: RuleBurst, Action: Flag, Window: "1m"},
+		{Type: RuleRoundAmount, Action: Flag, Multiple: "0"},
+		{Type: RuleRoundAmount, Action: Flag, Multiple: "1e3"},
+	}
+	for _, c := range bad {
+		_, err := c.Rule()
+		assert.NotNil(t, err, c.Type)
+	}
+	_, err := NewEngine(&fakeHistory{}, bad)
+	assert.NotNil(t, err)
+}
+
+func TestLoadRules(t *testing.T) {
+	os.Setenv("RISK_RULES", "")
+	r, err := LoadRules()
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultRules(), r)
+
+	os.Setenv("RISK_RULES", `[{"type":"burst","action":"block","window":"10s","max":2}]`)
+	defer os.Unsetenv("RISK_RULES")
+	r, err = LoadRules()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(r))
+	assert.Equal(t, 2, r[0].Max)
+
+	os.Setenv("RISK_RULES", `[{`)
+	_, err = LoadRules()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,175 @@
+package risk
+
+import (
+	"code_challenge1/money"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RuleNewRecipient = "new_recipient"
+	RuleAboveAverage = "above_average"
+	RuleBurst        = "burst"
+	RuleRoundAmount  = "round_amount"
+)
+
+// RuleConfig is the declarative form of a rule. Only the fields used by the rule type
+// need to be set. MinAmount applies to every rule type: transfers below it never trigger.
+type RuleConfig struct {
+	Type      string `json:"type"`
+	Action    Action `json:"action"`
+	MinAmount string `json:"min_amount,omitempty"`
+
+	Factor     string `json:"factor,omitempty"`      // above_average: multiple of the average
+	MinHistory int    `json:"min_history,omitempty"` // above_average: transfers needed before it applies
+	Window     string `json:"window,omitempty"`      // burst: duration, eg. 1m
+	Max        int    `json:"max,omitempty"`         // burst: transfers allowed within window
+	Multiple   string `json:"multiple,omitempty"`    // round_amount: eg. 100
+}
+
+type Rule interface {
+	Name() string
+	// Evaluate returns Allow when the rule does not trigger, otherwise the configured
+	// action and a human readable reason.
+	Evaluate(h History, t Transfer) (Action, string, error)
+}
+
+func (c RuleConfig) Rule() (Rule, error) {
+	if c.Action != Flag && c.Action != Block {
+		return nil, errors.Errorf("action should be %s or %s: %q", Flag, Block, c.Action)
+	}
+	b := base{action: c.Action}
+	if c.MinAmount != "" {
+		m, err := money.Parse(c.MinAmount)
+		if err != nil {
+			return nil, errors.Wrap(err, "min_amount")
+		}
+		b.minAmount = m.Rat()
+	}
+
+	switch c.Type {
+	case RuleNewRecipient:
+		return &newRecipient{base: b}, nil
+	case RuleAboveAverage:
+		f, err := money.ParseDecimal(c.Factor)
+		if err != nil || f.Sign() <= 0 {
+			return nil, errors.Errorf("factor not valid: %s", c.Factor)
+		}
+		return &aboveAverage{base: b, factor: f, minHistory: c.MinHistory}, nil
+	case RuleBurst:
+		w, err := time.ParseDuration(c.Window)
+		if err != nil || w <= 0 {
+			return nil, errors.Errorf("window not valid: %s", c.Window)
+		}
+		if c.Max <= 0 {
+			return nil, errors.Errorf("max should be positive: %d", c.Max)
+		}
+		return &burst{base: b, window: w, max: c.Max}, nil
+	case RuleRoundAmount:
+		m, err := money.Parse(c.Multiple)
+		if err != nil || m.Sign() <= 0 {
+			return nil, errors.Errorf("multiple not valid: %s", c.Multiple)
+		}
+		return &roundAmount{base: b, multiple: m.Rat()}, nil
+	default:
+		return nil, errors.Errorf("unknown rule type: %q", c.Type)
+	}
+}
+
+type base struct {
+	action    Action
+	minAmount *big.Rat
+}
+
+func (b base) applies(t Transfer) bool {
+	return b.minAmount == nil || t.Amount.Cmp(b.minAmount) >= 0
+}
+
+type newRecipient struct {
+	base
+}
+
+func (r *newRecipient) Name() string { return RuleNewRecipient }
+
+func (r *newRecipient) Evaluate(h History, t Transfer) (Action, string, error) {
+	if !r.applies(t) {
+		return Allow, "", nil
+	}
+	ok, err := h.HasTransferred(t.FromUser, t.ToUser)
+	if err != nil {
+		return "", "", err
+	}
+	if ok {
+		return Allow, "", nil
+	}
+	return r.action, fmt.Sprintf("first transfer to user %d", t.ToUser), nil
+}
+
+type aboveAverage struct {
+	base
+	factor     *big.Rat
+	minHistory int
+}
+
+func (r *aboveAverage) Name() string { return RuleAboveAverage }
+
+func (r *aboveAverage) Evaluate(h History, t Transfer) (Action, string, error) {
+	if !r.applies(t) {
+		return Allow, "", nil
+	}
+	avg, count, err := h.AverageTransfer(t.FromUser)
+	if err != nil {
+		return "", "", err
+	}
+	if count == 0 || count < r.minHistory {
+		return Allow, "", nil
+	}
+	limit := new(big.Rat).Mul(avg, r.factor)
+	if t.Amount.Cmp(limit) <= 0 {
+		return Allow, "", nil
+	}
+	return r.action, fmt.Sprintf("amount is more than %s times the average transfer %s",
+		r.factor.RatString(), avg.FloatString(2)), nil
+}
+
+type burst struct {
+	base
+	window time.Duration
+	max    int
+}
+
+func (r *burst) Name() string { return RuleBurst }
+
+func (r *burst) Evaluate(h History, t Transfer) (Action, string, error) {
+	if !r.applies(t) {
+		return Allow, "", nil
+	}
+	n, err := h.TransfersSince(t.FromUser, time.Now().Add(-r.window))
+	if err != nil {
+		return "", "", err
+	}
+	if n < r.max {
+		return Allow, "", nil
+	}
+	return r.action, fmt.Sprintf("%d transfers within %v", n, r.window), nil
+}
+
+type roundAmount struct {
+	base
+	multiple *big.Rat
+}
+
+func (r *roundAmount) Name() string { return RuleRoundAmount }
+
+func (r *roundAmount) Evaluate(_ History, t Transfer) (Action, string, error) {
+	if !r.applies(t) || t.Amount.Sign() == 0 {
+		return Allow, "", nil
+	}
+	if !new(big.Rat).Quo(t.Amount, r.multiple).IsInt() {
+		return Allow, "", nil
+	}
+	return r.action, fmt.Sprintf("round amount, multiple of %s", r.multiple.RatString()), nil
+}
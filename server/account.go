@@ -0,0 +1,77 @@
+package server
+
+import (
+	"code_challenge1/fees"
+	"code_challenge1/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type AccountOut struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Balance string `json:"balance"`
+}
+
+type AddAccountIn struct {
+	UserID int    `json:"user_id" binding:"required"`
+	Name   string `json:"name" binding:"required"`
+}
+
+func (s *Server) AddAccount(c *gin.Context) (interface{}, error) {
+	var in AddAccountIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	a, err := s.db.AddAccount(in.UserID, in.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "add account")
+	}
+	return AccountOut{
+		ID:      a.ID,
+		Name:    a.Name,
+		Balance: a.Balance.String(),
+	}, nil
+}
+
+type AccountTransferIn struct {
+	FromAccountID int    `json:"from_account_id" binding:"required"`
+	ToAccountID   int    `json:"to_account_id" binding:"required"`
+	Amount        string `json:"amount" binding:"required"`
+}
+
+func (s *Server) AccountTransfer(c *gin.Context) (interface{}, error) {
+	var in AccountTransferIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	b, err := money.Parse(in.Amount)
+	if err != nil {
+		return nil, err
+	}
+	from, err := s.db.GetAccount(in.FromAccountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get from account")
+	}
+	to, err := s.db.GetAccount(in.ToAccountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get to account")
+	}
+	//moving money between accounts of the same user needs no screening
+	flagged := func() {}
+	if from.UserID != to.UserID {
+		if flagged, err = s.screenTransfer(from.UserID, to.UserID, b); err != nil {
+			return nil, err
+		}
+	}
+	fee, err := s.quoteFee(fees.Transfer, from.UserID, b)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.TransferAccountsWithFee(in.FromAccountID, in.ToAccountID, b, fee); err != nil {
+		return nil, errors.Wrap(err, "transfer")
+	}
+	flagged()
+	return toTransferOut(b, fee), nil
+}
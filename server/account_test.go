@@ -0,0 +1,73 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Accounts(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	u2, _ := ss.db.AddUser("name2", money.MustParse("100"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/account/add", strings.NewReader(fmt.Sprintf(`{"user_id":%d, "name":"savings"}`, u1.ID)))
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	savings := int(res.Data.(map[string]interface{})["id"].(float64))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/account/add", strings.NewReader(``))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/account/transfer",
+		strings.NewReader(fmt.Sprintf(`{"from_account_id":%d, "to_account_id":%d, "amount":"40"}`, u1.MainAccount, savings)))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/account/transfer",
+		strings.NewReader(fmt.Sprintf(`{"from_account_id":%d, "to_account_id":%d, "amount":"5"}`, savings, u2.MainAccount)))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+
+	for _, body := range []string{``,
+		fmt.Sprintf(`{"from_account_id":%d, "to_account_id":%d, "amount":"qwe"}`, savings, u2.MainAccount),
+		fmt.Sprintf(`{"from_account_id":%d, "to_account_id":%d, "amount":"1"}`, 9999, u2.MainAccount),
+		fmt.Sprintf(`{"from_account_id":%d, "to_account_id":%d, "amount":"1"}`, savings, 9999),
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/account/transfer", strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		res = toResponse(w.Body.Bytes())
+		assert.NotEqual(t, 0, res.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/user/balance", strings.NewReader(fmt.Sprintf(`{"user_id":%d}`, u1.ID)))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	assert.Equal(t, "60.00", data["balance"])
+	accounts := data["accounts"].([]interface{})
+	assert.Equal(t, 2, len(accounts))
+	assert.Equal(t, "35.00", accounts[1].(map[string]interface{})["balance"])
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/fees"
+	"code_challenge1/money"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type BatchLegIn struct {
+	ToAccountID int    `json:"to_account_id" binding:"required"`
+	Amount      string `json:"amount" binding:"required"`
+}
+
+type BatchTransferIn struct {
+	IdempotencyKey string       `json:"idempotency_key" binding:"required"`
+	FromAccountID  int          `json:"from_account_id" binding:"required"`
+	Legs           []BatchLegIn `json:"legs" binding:"required,dive"`
+}
+
+type BatchLegOut struct {
+	Leg         int    `json:"leg"`
+	ToAccountID int    `json:"to_account_id"`
+	Amount      string `json:"amount"`
+	Fee         string `json:"fee"`
+	Status      string `json:"status"`
+}
+
+type BatchTransferOut struct {
+	BatchID        int           `json:"batch_id"`
+	IdempotencyKey string        `json:"idempotency_key"`
+	FromAccountID  int           `json:"from_account_id"`
+	Total          string        `json:"total"`
+	Fee            string        `json:"fee"`
+	Replayed       bool          `json:"replayed"`
+	CreatedAt      time.Time     `json:"created_at"`
+	Legs           []BatchLegOut `json:"legs"`
+}
+
+// BatchTransfer pays many accounts from one account, all or nothing. Every leg is screened
+// by the risk engine, one blocked leg rejects the whole batch, and charged the fee of a
+// transfer.
+func (s *Server) BatchTransfer(c *gin.Context) (interface{}, error) {
+	var in BatchTransferIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if len(in.Legs) > db.MaxBatchLegs {
+		return nil, errors.Errorf("batch should have at most %d legs, got %d", db.MaxBatchLegs, len(in.Legs))
+	}
+	legs := make([]db.BatchLeg, 0, len(in.Legs))
+	for i, l := range in.Legs {
+		b, err := money.Parse(l.Amount)
+		if err != nil {
+			return nil, errors.Wrapf(err, "leg %d", i)
+		}
+		legs = append(legs, db.BatchLeg{ToAccount: l.ToAccountID, Amount: b})
+	}
+
+	existing, err := s.db.BatchByKey(in.FromAccountID, strings.TrimSpace(in.IdempotencyKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "query batch")
+	}
+	//quoted for replays too, a batch charged other fees is a different batch
+	if err := s.quoteBatch(in.FromAccountID, legs); err != nil {
+		return nil, err
+	}
+	flagged := func() {}
+	if existing == nil {
+		if flagged, err = s.screenBatch(in.FromAccountID, legs); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := s.db.BatchTransfer(in.IdempotencyKey, in.FromAccountID, legs)
+	if err != nil {
+		return nil, errors.Wrap(err, "batch transfer")
+	}
+	flagged()
+	out := BatchTransferOut{
+		BatchID:        b.ID,
+		IdempotencyKey: b.IdempotencyKey,
+		FromAccountID:  b.FromAccount,
+		Total:          b.Total.String(),
+		Fee:            b.Fee.String(),
+		Replayed:       b.Replayed,
+		CreatedAt:      b.CreatedAt,
+		Legs:           make([]BatchLegOut, 0, len(b.Legs)),
+	}
+	for i, l := range b.Legs {
+		out.Legs = append(out.Legs, BatchLegOut{
+			Leg:         i,
+			ToAccountID: l.ToAccount,
+			Amount:      l.Amount.String(),
+			Fee:         l.Fee.String(),
+			Status:      "completed",
+		})
+	}
+	return out, nil
+}
+
+// quoteBatch sets the fee of every leg, quoted as a transfer of its own.
+func (s *Server) quoteBatch(fromAccount int, legs []db.BatchLeg) error {
+	from, err := s.db.GetAccount(fromAccount)
+	if err != nil {
+		return errors.Wrap(err, "get from account")
+	}
+	for i := range legs {
+		if legs[i].Fee, err = s.quoteFee(fees.Transfer, from.UserID, legs[i].Amount); err != nil {
+			return errors.Wrapf(err, "leg %d", i)
+		}
+	}
+	return nil
+}
+
+// screenBatch screens every leg, the returned func saves the flagged ones for review.
+func (s *Server) screenBatch(fromAccount int, legs []db.BatchLeg) (func(), error) {
+	from, err := s.db.GetAccount(fromAccount)
+	if err != nil {
+		return nil, errors.Wrap(err, "get from account")
+	}
+	var flags []func()
+	for i, l := range legs {
+		to, err := s.db.GetAccount(l.ToAccount)
+		if err != nil {
+			//reported per leg by the db validation
+			continue
+		}
+		if to.UserID == from.UserID {
+			continue
+		}
+		flagged, err := s.screenTransfer(from.UserID, to.UserID, l.Amount)
+		if err != nil {
+			return nil, errors.Wrapf(err, "leg %d", i)
+		}
+		flags = append(flags, flagged)
+	}
+	return func() {
+		for _, flagged := range flags {
+			flagged()
+		}
+	}, nil
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_BatchTransfer(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	payer, _ := ss.db.AddUser("payer", money.MustParse("100"))
+	u1, _ := ss.db.AddUser("name1", money.MustParse("0"))
+	u2, _ := ss.db.AddUser("name2", money.MustParse("0"))
+
+	body := fmt.Sprintf(`{"idempotency_key":"k1", "from_account_id":%d, "legs":[{"to_account_id":%d, "amount":"10"},{"to_account_id":%d, "amount":"2.5"}]}`,
+		payer.MainAccount, u1.MainAccount, u2.MainAccount)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/transfer/batch", strings.NewReader(body))
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	assert.Equal(t, "12.50", data["total"])
+	assert.Equal(t, false, data["replayed"])
+	assert.Equal(t, 2, len(data["legs"].([]interface{})))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/transfer/batch", strings.NewReader(body))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, true, res.Data.(map[string]interface{})["replayed"])
+	u, _ := ss.db.GetUser(payer.ID)
+	assert.Equal(t, "87.50", u.Balance.String())
+
+	for _, body := range []string{``,
+		fmt.Sprintf(`{"idempotency_key":"k2", "from_account_id":%d, "legs":[{"to_account_id":%d, "amount":"qwe"}]}`,
+			payer.MainAccount, u1.MainAccount),
+		fmt.Sprintf(`{"idempotency_key":"k2", "from_account_id":%d, "legs":[{"to_account_id":%d, "amount":"1000"}]}`,
+			payer.MainAccount, u1.MainAccount),
+		fmt.Sprintf(`{"idempotency_key":"k2", "from_account_id":%d, "legs":[{"to_account_id":%d}]}`,
+			payer.MainAccount, u1.MainAccount),
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/transfer/batch", strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		res = toResponse(w.Body.Bytes())
+		assert.NotEqual(t, 0, res.Code)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+type CacheStatsOut struct {
+	Enabled       bool    `json:"enabled"`
+	Active        bool    `json:"active"`
+	Size          int     `json:"size"`
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	Invalidations int64   `json:"invalidations"`
+}
+
+// CacheStats returns the counters of the user cache since the server started.
+func (s *Server) CacheStats(_ *gin.Context) (interface{}, error) {
+	stats := s.db.CacheStats()
+	out := CacheStatsOut{
+		Enabled:       stats.Enabled,
+		Active:        stats.Active,
+		Size:          stats.Size,
+		Hits:          stats.Hits,
+		Misses:        stats.Misses,
+		Invalidations: stats.Invalidations,
+	}
+	if n := stats.Hits + stats.Misses; n > 0 {
+		out.HitRatio = float64(stats.Hits) / float64(n)
+	}
+	return out, nil
+}
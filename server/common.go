@@ -1,12 +1,41 @@
 package server
 
 import (
+	"code_challenge1/db"
 	"code_challenge1/log"
+	"crypto/subtle"
+	"database/sql"
 	"fmt"
+	"net/http"
+	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 )
 
+// Codes of failed responses. Failures callers are expected to handle have a code of their
+// own, the message of the others may change.
+const (
+	CodeError             = 1
+	CodeNotFound          = 2
+	CodeBlocked           = 3
+	CodeInsufficientFunds = 4
+)
+
+// errorCode returns the code of the response failing with err.
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return CodeNotFound
+	case errors.Is(err, ErrBlocked):
+		return CodeBlocked
+	case errors.Is(err, db.ErrInsufficientFunds):
+		return CodeInsufficientFunds
+	}
+	return CodeError
+}
+
 func HttpHandler(f func(*gin.Context) (interface{}, error)) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 
@@ -14,7 +43,7 @@ func HttpHandler(f func(*gin.Context) (interface{}, error)) gin.HandlerFunc {
 		if err != nil {
 			log.Errorf("url %v return error: %v", ctx.Request.URL, err)
 			ctx.JSON(200, Response{
-				Code:    1,
+				Code:    errorCode(err),
 				Message: fmt.Sprintf("%v", err),
 			})
 			return
@@ -35,3 +64,45 @@ type Response struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
 }
+
+// AdminAuth guards the ops endpoints with the token in the ADMIN_TOKEN environment variable,
+// sent by callers in the X-Admin-Token header. Without ADMIN_TOKEN the endpoints are closed.
+func AdminAuth() gin.HandlerFunc {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		log.Warnf("ADMIN_TOKEN is not set, admin endpoints are disabled")
+	}
+	return func(ctx *gin.Context) {
+		if token == "" {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, Response{
+				Code:    1,
+				Message: "admin endpoints are disabled, ADMIN_TOKEN is not set",
+			})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(ctx.GetHeader("X-Admin-Token")), []byte(token)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, Response{
+				Code:    1,
+				Message: "admin token not valid",
+			})
+		}
+	}
+}
+
+// UserAuth authenticates users by the api key in the Authorization header, as
+// "Bearer <key>", and keeps the user id in the context under "user_id".
+func UserAuth(d *db.DB) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !ok || key == "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, Response{Code: 1, Message: "api key required"})
+			return
+		}
+		userID, err := d.APIKeyUser(key)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, Response{Code: 1, Message: err.Error()})
+			return
+		}
+		ctx.Set("user_id", userID)
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/statement"
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+// ReadConsistencyHeader lets callers of the query endpoints accept eventual consistency
+// with the value "eventual", so the reads may go to the replica. In gRPC it is metadata.
+const ReadConsistencyHeader = "X-Read-Consistency"
+
+// reader is what the query endpoints read from, the primary or an eventual view.
+type reader interface {
+	statement.Source
+	UserAccounts(userID int) ([]db.Account, error)
+	UserRecords(userID int) ([]db.Record, error)
+}
+
+// reader returns where the request reads from, the primary unless it accepts eventual
+// consistency.
+func (s *Server) reader(c *gin.Context) reader {
+	return s.readerFor(c.GetHeader(ReadConsistencyHeader))
+}
+
+// grpcReader is reader for gRPC calls.
+func (s *Server) grpcReader(ctx context.Context) reader {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return s.readerFor(strings.Join(md.Get(ReadConsistencyHeader), ""))
+}
+
+func (s *Server) readerFor(consistency string) reader {
+	if strings.EqualFold(strings.TrimSpace(consistency), "eventual") {
+		return s.db.Eventual()
+	}
+	return s.db
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/fees"
+	"code_challenge1/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// quoteFee returns the fee the user pays on the transaction, see QuoteFee.
+func (s *Server) quoteFee(transaction string, userID int, amount money.Money) (money.Money, error) {
+	return QuoteFee(s.db, s.fees, transaction, userID, amount)
+}
+
+// QuoteFee returns the fee the user pays on a transaction of the type, by the user's tier.
+func QuoteFee(d *db.DB, schedule *fees.Schedule, transaction string, userID int, amount money.Money) (money.Money, error) {
+	u, err := d.GetUser(userID)
+	if err != nil {
+		return 0, errors.Wrap(err, "get user")
+	}
+	fee, err := money.FromRat(schedule.Quote(transaction, u.Tier, amount.Rat()))
+	return fee, errors.Wrap(err, "fee")
+}
+
+// WithdrawOrDeposit changes the balance of the user's main account and charges the
+// withdraw fee, it returns the user and the fee.
+func WithdrawOrDeposit(d *db.DB, schedule *fees.Schedule, userID int, amount money.Money) (*db.User, money.Money, error) {
+	var fee money.Money
+	if amount.Sign() < 0 {
+		var err error
+		if fee, err = QuoteFee(d, schedule, fees.Withdraw, userID, amount); err != nil {
+			return nil, 0, err
+		}
+	}
+	u, err := d.WithdrawOrDepositWithFee(userID, amount, fee)
+	if err != nil {
+		return nil, 0, err
+	}
+	return u, fee, nil
+}
+
+// TransferOut shows what a transfer cost the sender, the amount and the fee on top.
+type TransferOut struct {
+	Amount string `json:"amount"`
+	Fee    string `json:"fee"`
+	Total  string `json:"total"`
+}
+
+// toTransferOut shows a transfer done, the sender had the total so it does not overflow.
+func toTransferOut(amount, fee money.Money) TransferOut {
+	return TransferOut{
+		Amount: amount.String(),
+		Fee:    fee.String(),
+		Total:  (amount.Abs() + fee).String(),
+	}
+}
+
+type FeeQuoteIn struct {
+	// Transaction is transfer or withdraw.
+	Transaction string `json:"transaction" binding:"required"`
+	UserID      int    `json:"user_id" binding:"required"`
+	Amount      string `json:"amount" binding:"required"`
+}
+
+type FeeQuoteOut struct {
+	Transaction string `json:"transaction"`
+	TransferOut
+}
+
+// QuoteFee previews the fee the user would pay, nothing moves.
+func (s *Server) QuoteFee(c *gin.Context) (interface{}, error) {
+	var in FeeQuoteIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if in.Transaction != fees.Transfer && in.Transaction != fees.Withdraw {
+		return nil, errors.Errorf("transaction should be %s or %s: %q", fees.Transfer, fees.Withdraw, in.Transaction)
+	}
+	b, err := money.Parse(in.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if b.Sign() <= 0 {
+		return nil, errors.Errorf("amount should be positive: %s", in.Amount)
+	}
+	fee, err := s.quoteFee(in.Transaction, in.UserID, b)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.Add(fee); err != nil {
+		return nil, errors.Wrap(err, "total")
+	}
+	return FeeQuoteOut{Transaction: in.Transaction, TransferOut: toTransferOut(b, fee)}, nil
+}
+
+type SetUserTierIn struct {
+	UserID int    `json:"user_id" binding:"required"`
+	Tier   string `json:"tier" binding:"required"`
+}
+
+// SetUserTier puts the user in a fee tier.
+func (s *Server) SetUserTier(c *gin.Context) (interface{}, error) {
+	var in SetUserTierIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	u, err := s.db.SetUserTier(in.UserID, in.Tier)
+	if err != nil {
+		return nil, errors.Wrap(err, "set user tier")
+	}
+	return SetUserTierIn{UserID: u.ID, Tier: u.Tier}, nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Fees(t *testing.T) {
+	setupDbTest()
+	os.Setenv("FEES", `[{"transaction":"transfer","kind":"percentage","rate":"0.01","max":"2"},
+		{"transaction":"withdraw","kind":"flat","amount":"1"},
+		{"transaction":"transfer","tier":"premium","kind":"flat","amount":"0"}]`)
+	defer os.Unsetenv("FEES")
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+	_, _ = ss.db.AddUser("name1", money.MustParse("100"))
+	_, _ = ss.db.AddUser("name2", money.MustParse("0"))
+
+	post := func(path, body string) Response {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", testAdminToken)
+		router.ServeHTTP(w, req)
+		return toResponse(w.Body.Bytes())
+	}
+	res := post("/fee/quote", `{"transaction":"transfer","user_id":1,"amount":"50"}`)
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, map[string]interface{}{"transaction": "transfer", "amount": "50.00", "fee": "0.50", "total": "50.50"}, res.Data)
+	res = post("/fee/quote", `{"transaction":"withdraw","user_id":1,"amount":"50"}`)
+	assert.Equal(t, "1.00", res.Data.(map[string]interface{})["fee"])
+	for _, body := range []string{
+		`{"transaction":"deposit","user_id":1,"amount":"50"}`,
+		`{"transaction":"transfer","user_id":1,"amount":"-50"}`,
+		`{"transaction":"transfer","user_id":1,"amount":"0.001"}`,
+		`{"transaction":"transfer","user_id":9999,"amount":"50"}`,
+	} {
+		res = post("/fee/quote", body)
+		assert.NotEqual(t, 0, res.Code, body)
+	}
+
+	res = post("/transfer", `{"from_user_id":1,"to_user_id":2,"amount":"50"}`)
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, map[string]interface{}{"amount": "50.00", "fee": "0.50", "total": "50.50"}, res.Data)
+	res = post("/account/transfer", `{"from_account_id":1,"to_account_id":2,"amount":"49.50"}`)
+	assert.NotEqual(t, 0, res.Code)
+	res = post("/deposit", `{"id":1,"amount":"-10"}`)
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, map[string]interface{}{"name": "name1", "balance": "38.50", "fee": "1.00"}, res.Data)
+
+	res = post("/admin/user/tier", `{"user_id":1,"tier":"premium"}`)
+	assert.Equal(t, 0, res.Code)
+	res = post("/admin/user/tier", `{"user_id":9999,"tier":"premium"}`)
+	assert.NotEqual(t, 0, res.Code)
+	res = post("/account/transfer", `{"from_account_id":1,"to_account_id":2,"amount":"38.50"}`)
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, "0.00", res.Data.(map[string]interface{})["fee"])
+
+	fees, _ := ss.db.FeeAccount()
+	assert.Equal(t, "1.50", fees.Balance.String())
+}
+
+func TestNewServer_Fees(t *testing.T) {
+	setupDbTest()
+	os.Setenv("FEES", `[{"transaction":"transfer","kind":"flat"}]`)
+	defer os.Unsetenv("FEES")
+	_, err := NewServer()
+	assert.NotNil(t, err)
+}
+
+func TestServer_BatchFees(t *testing.T) {
+	setupDbTest()
+	os.Setenv("FEES", `[{"transaction":"transfer","kind":"percentage","rate":"0.01","max":"2"}]`)
+	defer os.Unsetenv("FEES")
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+	payer, _ := ss.db.AddUser("payer", money.MustParse("100"))
+	u1, _ := ss.db.AddUser("name1", money.MustParse("0"))
+
+	body := fmt.Sprintf(`{"idempotency_key":"k1", "from_account_id":%d, "legs":[{"to_account_id":%d, "amount":"50"},{"to_account_id":%d, "amount":"10"}]}`,
+		payer.MainAccount, u1.MainAccount, u1.MainAccount)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/transfer/batch", strings.NewReader(body))
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	assert.Equal(t, "60.00", data["total"])
+	assert.Equal(t, "0.60", data["fee"])
+	assert.Equal(t, "0.50", data["legs"].([]interface{})[0].(map[string]interface{})["fee"])
+
+	u, _ := ss.db.GetUser(payer.ID)
+	assert.Equal(t, "39.40", u.Balance.String())
+	fees, _ := ss.db.FeeAccount()
+	assert.Equal(t, "0.60", fees.Balance.String())
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"code_challenge1/bankpb"
+	"code_challenge1/db"
+	"code_challenge1/fees"
+	"code_challenge1/log"
+	"code_challenge1/money"
+	"context"
+	"database/sql"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// bankService serves the gRPC bank API on the same db and risk engine as the HTTP API.
+type bankService struct {
+	bankpb.UnimplementedBankServer
+	s *Server
+}
+
+// GRPCServer returns the gRPC server of the bank API.
+func (s *Server) GRPCServer() *grpc.Server {
+	g := grpc.NewServer()
+	bankpb.RegisterBankServer(g, &bankService{s: s})
+	return g
+}
+
+// ServeGRPC serves the gRPC bank API on addr until the server is closed.
+func (s *Server) ServeGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "listen")
+	}
+	g := s.GRPCServer()
+	go func() {
+		<-s.stop
+		g.GracefulStop()
+	}()
+	log.Infof("------- starting grpc server on %s ---------", addr)
+	if err := g.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// grpcError turns the error into a status, InvalidArgument and NotFound when they apply.
+// Anything else is a rule of the bank not met, eg. a balance not sufficient.
+func grpcError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+func parseAmount(s string) (money.Money, error) {
+	b, err := money.Parse(s)
+	if err != nil {
+		return 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return b, nil
+}
+
+func toUserPB(u *db.User) *bankpb.User {
+	return &bankpb.User{
+		Id:            int64(u.ID),
+		Name:          u.Name,
+		Status:        u.Status,
+		MainAccountId: int64(u.MainAccount),
+		Balance:       u.Balance.String(),
+	}
+}
+
+func (b *bankService) AddUser(_ context.Context, in *bankpb.AddUserRequest) (*bankpb.User, error) {
+	balance, err := parseAmount(in.Balance)
+	if err != nil {
+		return nil, err
+	}
+	u, err := b.s.db.AddUser(strings.TrimSpace(in.Name), balance)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toUserPB(u), nil
+}
+
+func (b *bankService) UserBalance(ctx context.Context, in *bankpb.UserBalanceRequest) (*bankpb.User, error) {
+	u, err := b.s.grpcReader(ctx).GetUser(int(in.UserId))
+	if err != nil {
+		return nil, grpcError(errors.Wrap(err, "get user"))
+	}
+	return toUserPB(u), nil
+}
+
+func (b *bankService) UserRecords(in *bankpb.UserRecordsRequest, stream grpc.ServerStreamingServer[bankpb.Record]) error {
+	r := b.s.grpcReader(stream.Context())
+	if _, err := r.GetUser(int(in.UserId)); err != nil {
+		return grpcError(errors.Wrap(err, "get user"))
+	}
+	records, err := r.UserRecords(int(in.UserId))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, r := range records {
+		err := stream.Send(&bankpb.Record{
+			Id:          int64(r.ID),
+			FromUser:    int64(r.FromUser),
+			ToUser:      int64(r.ToUser),
+			FromAccount: int64(r.FromAccount),
+			ToAccount:   int64(r.ToAccount),
+			Amount:      r.Amount.String(),
+			CreatedAt:   timestamppb.New(r.CreatedAt),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bankService) WithdrawOrDeposit(_ context.Context, in *bankpb.WithdrawOrDepositRequest) (*bankpb.User, error) {
+	amount, err := parseAmount(in.Amount)
+	if err != nil {
+		return nil, err
+	}
+	u, _, err := WithdrawOrDeposit(b.s.db, b.s.fees, int(in.UserId), amount)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toUserPB(u), nil
+}
+
+func (b *bankService) Transfer(_ context.Context, in *bankpb.TransferRequest) (*bankpb.TransferResponse, error) {
+	amount, err := parseAmount(in.Amount)
+	if err != nil {
+		return nil, err
+	}
+	flagged, err := b.s.screenTransfer(int(in.FromUserId), int(in.ToUserId), amount)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	fee, err := b.s.quoteFee(fees.Transfer, int(in.FromUserId), amount)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := b.s.db.TransferWithFee(int(in.FromUserId), int(in.ToUserId), amount, fee); err != nil {
+		return nil, grpcError(err)
+	}
+	flagged()
+	return &bankpb.TransferResponse{}, nil
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"code_challenge1/bankpb"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServer_GRPC(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	lis := bufconn.Listen(1 << 20)
+	g := ss.GRPCServer()
+	go func() {
+		_ = g.Serve(lis)
+	}()
+	defer g.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	c := bankpb.NewBankClient(conn)
+	ctx := context.Background()
+	code := func(err error) codes.Code {
+		return status.Code(err)
+	}
+
+	u1, err := c.AddUser(ctx, &bankpb.AddUserRequest{Name: " name1 ", Balance: "100"})
+	assert.Nil(t, err)
+	assert.Equal(t, "name1", u1.Name)
+	assert.Equal(t, "100.00", u1.Balance)
+	u2, _ := c.AddUser(ctx, &bankpb.AddUserRequest{Name: "name2", Balance: "10.5"})
+	_, err = c.AddUser(ctx, &bankpb.AddUserRequest{Name: "_fees", Balance: "0"})
+	assert.NotNil(t, err)
+	_, err = c.AddUser(ctx, &bankpb.AddUserRequest{Name: "name3", Balance: "ten"})
+	assert.Equal(t, codes.InvalidArgument, code(err))
+
+	u, err := c.WithdrawOrDeposit(ctx, &bankpb.WithdrawOrDepositRequest{UserId: u1.Id, Amount: "-0.5"})
+	assert.Nil(t, err)
+	assert.Equal(t, "99.50", u.Balance)
+	_, err = c.WithdrawOrDeposit(ctx, &bankpb.WithdrawOrDepositRequest{UserId: u1.Id, Amount: "-1000"})
+	assert.Equal(t, codes.FailedPrecondition, code(err))
+	_, err = c.WithdrawOrDeposit(ctx, &bankpb.WithdrawOrDepositRequest{UserId: 9999, Amount: "1"})
+	assert.Equal(t, codes.NotFound, code(err))
+
+	_, err = c.Transfer(ctx, &bankpb.TransferRequest{FromUserId: u1.Id, ToUserId: u2.Id, Amount: "9.5"})
+	assert.Nil(t, err)
+	_, err = c.Transfer(ctx, &bankpb.TransferRequest{FromUserId: u1.Id, ToUserId: u2.Id, Amount: "1000"})
+	assert.Equal(t, codes.FailedPrecondition, code(err))
+	_, err = c.Transfer(ctx, &bankpb.TransferRequest{FromUserId: u1.Id, ToUserId: u2.Id, Amount: ""})
+	assert.Equal(t, codes.InvalidArgument, code(err))
+
+	u, err = c.UserBalance(ctx, &bankpb.UserBalanceRequest{UserId: u2.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, "20.00", u.Balance)
+	assert.Equal(t, "active", u.Status)
+	eventual := metadata.AppendToOutgoingContext(ctx, ReadConsistencyHeader, "eventual")
+	u, err = c.UserBalance(eventual, &bankpb.UserBalanceRequest{UserId: u2.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, "20.00", u.Balance)
+	_, err = c.UserBalance(ctx, &bankpb.UserBalanceRequest{UserId: 9999})
+	assert.Equal(t, codes.NotFound, code(err))
+
+	stream, err := c.UserRecords(ctx, &bankpb.UserRecordsRequest{UserId: u1.Id})
+	assert.Nil(t, err)
+	var amounts []string
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.Nil(t, err) {
+			break
+		}
+		assert.NotNil(t, r.CreatedAt)
+		amounts = append(amounts, r.Amount)
+	}
+	assert.Equal(t, []string{"-0.50", "9.50"}, amounts)
+
+	stream, _ = c.UserRecords(ctx, &bankpb.UserRecordsRequest{UserId: 9999})
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, code(err))
+}
+
+func TestServer_ServeGRPC(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	assert.NotNil(t, ss.ServeGRPC("bad address"))
+
+	done := make(chan error)
+	go func() {
+		done <- ss.ServeGRPC("127.0.0.1:0")
+	}()
+	ss.Close()
+	assert.Nil(t, <-done)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type BalanceAtIn struct {
+	UserID    int    `json:"user_id" binding:"required"`
+	AccountID int    `json:"account_id"`
+	At        string `json:"at"`
+	RecordID  int    `json:"record_id"`
+}
+
+type BalanceAtOut struct {
+	AccountID int        `json:"account_id"`
+	Balance   string     `json:"balance"`
+	At        *time.Time `json:"at,omitempty"`
+	RecordID  int        `json:"record_id"`
+}
+
+// BalanceAt returns the balance of the user's account, the main one unless another is
+// asked for, at a point in time given either as RFC3339 time or as record id.
+func (s *Server) BalanceAt(c *gin.Context) (interface{}, error) {
+	var in BalanceAtIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if (in.At == "") == (in.RecordID == 0) {
+		return nil, errors.Errorf("either at or record_id is required")
+	}
+	u, err := s.db.GetUser(in.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get user")
+	}
+	if in.AccountID == 0 {
+		in.AccountID = u.MainAccount
+	}
+	a, err := s.db.GetAccount(in.AccountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get account")
+	}
+	if a.UserID != u.ID {
+		return nil, errors.Errorf("account %d does not belong to user %d", a.ID, u.ID)
+	}
+
+	out := BalanceAtOut{AccountID: a.ID, RecordID: in.RecordID}
+	if in.RecordID != 0 {
+		b, err := s.db.BalanceAtRecord(a.ID, in.RecordID)
+		if err != nil {
+			return nil, errors.Wrap(err, "balance at record")
+		}
+		out.Balance = b.String()
+		return out, nil
+	}
+	at, err := time.Parse(time.RFC3339, strings.TrimSpace(in.At))
+	if err != nil {
+		return nil, errors.Wrap(err, "at should be RFC3339 time")
+	}
+	b, recordID, err := s.db.BalanceAt(a.ID, at)
+	if err != nil {
+		return nil, errors.Wrap(err, "balance at")
+	}
+	out.Balance = b.String()
+	out.At = &at
+	out.RecordID = recordID
+	return out, nil
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_BalanceAt(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	u2, _ := ss.db.AddUser("name2", money.MustParse("100"))
+	_, _ = ss.db.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+	_, _ = ss.db.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/user/balance/at", strings.NewReader(fmt.Sprintf(`{"user_id":%d, "record_id":1}`, u1.ID)))
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, "101.00", res.Data.(map[string]interface{})["balance"])
+
+	at := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/user/balance/at", strings.NewReader(fmt.Sprintf(`{"user_id":%d, "at":"%s"}`, u1.ID, at)))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	assert.Equal(t, "102.00", data["balance"])
+	assert.Equal(t, float64(2), data["record_id"])
+
+	for _, body := range []string{``,
+		fmt.Sprintf(`{"user_id":%d}`, u1.ID),
+		fmt.Sprintf(`{"user_id":%d, "at":"yesterday"}`, u1.ID),
+		fmt.Sprintf(`{"user_id":%d, "account_id":%d, "record_id":1}`, u1.ID, u2.MainAccount),
+		fmt.Sprintf(`{"user_id":%d, "account_id":9999, "record_id":1}`, u1.ID),
+		`{"user_id":9999, "record_id":1}`,
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/user/balance/at", strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		res = toResponse(w.Body.Bytes())
+		assert.NotEqual(t, 0, res.Code, body)
+	}
+}
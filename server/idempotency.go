@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"code_challenge1/log"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyHeader carries the key clients send to retry a request safely.
+const IdempotencyHeader = "Idempotency-Key"
+
+// maxIdempotencyKey is the longest key accepted, the size of the column.
+const maxIdempotencyKey = 256
+
+// Idempotent makes a route safe to retry: the first successful response for an
+// Idempotency-Key on the route is saved and replayed to later requests with the same key,
+// which then do not run again. Failed requests are not saved, so they can be retried with the key.
+// Requests without the header are not affected.
+func (s *Server) Idempotent() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := strings.TrimSpace(ctx.GetHeader(IdempotencyHeader))
+		if key == "" {
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			ctx.AbortWithStatusJSON(200, Response{Code: 1, Message: "idempotency key is too long"})
+			return
+		}
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(200, Response{Code: 1, Message: "read body: " + err.Error()})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		reservation, saved, err := s.db.ReserveIdempotencyKey(key, ctx.FullPath(), hex.EncodeToString(sum[:]))
+		if err != nil {
+			ctx.AbortWithStatusJSON(200, Response{Code: 1, Message: err.Error()})
+			return
+		}
+		if reservation == nil {
+			ctx.Header("Idempotent-Replayed", "true")
+			ctx.Data(200, "application/json; charset=utf-8", []byte(saved))
+			ctx.Abort()
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = w
+		ctx.Next()
+
+		var res Response
+		if w.Status() == http.StatusOK && json.Unmarshal(w.body.Bytes(), &res) == nil && res.Code == 0 {
+			err = s.db.SaveIdempotentResponse(reservation, w.body.String())
+		} else {
+			err = s.db.ReleaseIdempotencyKey(reservation)
+		}
+		if err != nil {
+			log.Errorf("idempotency key %s: %v", key, err)
+		}
+	}
+}
+
+// recordingWriter keeps a copy of the response body written through it.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// pruneIdempotencyKeys deletes the idempotency keys older than their ttl.
+func (s *Server) pruneIdempotencyKeys() error {
+	n, err := s.db.PruneIdempotencyKeys(time.Now().Add(-s.keyTTL))
+	if err == nil && n > 0 {
+		log.Infof("pruned %d idempotency keys", n)
+	}
+	return err
+}
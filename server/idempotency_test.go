@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Idempotent(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	router := ss.Handler()
+
+	post := func(path, key, body string) (*httptest.ResponseRecorder, Response) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w, toResponse(w.Body.Bytes())
+	}
+
+	_, res := post("/user/add", "", `{"name":"test1", "balance":"100"}`)
+	assert.Equal(t, 0, res.Code)
+
+	w1, res := post("/deposit", "k1", `{"id":1, "amount":"10"}`)
+	assert.Equal(t, 0, res.Code)
+	w2, res := post("/deposit", "k1", `{"id":1, "amount":"10"}`)
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+	assert.Equal(t, "true", w2.Header().Get("Idempotent-Replayed"))
+	u, err := ss.db.GetUser(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "110.00", u.Balance.String())
+
+	//the key belongs to the first request, on other routes it is free
+	_, res = post("/deposit", "k1", `{"id":1, "amount":"20"}`)
+	assert.NotEqual(t, 0, res.Code)
+	_, res = post("/user/add", "k1", `{"name":"test2", "balance":"0"}`)
+	assert.Equal(t, 0, res.Code)
+
+	//failures are not kept, the request can be retried with the key
+	_, res = post("/deposit", "k2", `{"id":1, "amount":"-1000"}`)
+	assert.NotEqual(t, 0, res.Code)
+	_, res = post("/deposit", "k2", `{"id":1, "amount":"-1000"}`)
+	assert.NotEqual(t, 0, res.Code)
+	assert.True(t, strings.Contains(res.Message, "cannot withdraw"))
+
+	_, res = post("/deposit", strings.Repeat("k", 300), `{"id":1, "amount":"1"}`)
+	assert.NotEqual(t, 0, res.Code)
+
+	//keys are kept for their ttl
+	assert.Nil(t, ss.pruneIdempotencyKeys())
+	_, res = post("/deposit", "k1", `{"id":1, "amount":"20"}`)
+	assert.NotEqual(t, 0, res.Code)
+	ss.keyTTL = -time.Minute
+	assert.Nil(t, ss.pruneIdempotencyKeys())
+	_, res = post("/deposit", "k1", `{"id":1, "amount":"20"}`)
+	assert.Equal(t, 0, res.Code)
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"code_challenge1/importer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type ImportUsersOut struct {
+	Imported int `json:"imported"`
+}
+
+// ImportUsers creates the users of the name,balance csv sent as request body, all or none.
+func (s *Server) ImportUsers(c *gin.Context) (interface{}, error) {
+	n, err := importer.ImportUsers(s.db, c.Request.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "import users")
+	}
+	return ImportUsersOut{Imported: n}, nil
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_ImportUsers(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/users/import", strings.NewReader("name,balance\nalice,10\nbob,20.01\n"))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	req.Header.Set("Content-Type", "text/csv")
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, float64(2), res.Data.(map[string]interface{})["imported"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/users/import", strings.NewReader("name,balance\ncarl,1\nalice,10\n"))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+	assert.Contains(t, res.Message, "line 3")
+}
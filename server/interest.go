@@ -0,0 +1,87 @@
+package server
+
+import (
+	"code_challenge1/interest"
+	"code_challenge1/log"
+	"math/big"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type SetInterestRateIn struct {
+	AccountID int `json:"account_id" binding:"required"`
+	// Rate is the annual rate as a decimal fraction, eg. 0.035, empty to use the product rate.
+	Rate string `json:"rate"`
+}
+
+// SetInterestRate sets the interest rate of a single account, overriding its product rate.
+func (s *Server) SetInterestRate(c *gin.Context) (interface{}, error) {
+	var in SetInterestRateIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	var rate *big.Rat
+	if in.Rate != "" {
+		r, err := interest.ParseRate(in.Rate)
+		if err != nil {
+			return nil, err
+		}
+		rate = r
+	}
+	if err := s.db.SetInterestRate(in.AccountID, rate); err != nil {
+		return nil, errors.Wrap(err, "set interest rate")
+	}
+	return in, nil
+}
+
+type InterestPostingsIn struct {
+	AccountID int `json:"account_id" binding:"required"`
+}
+
+type InterestPostingOut struct {
+	Month     string    `json:"month"`
+	Accrued   string    `json:"accrued"`
+	Amount    string    `json:"amount"`
+	Carry     string    `json:"carry"`
+	RecordID  int       `json:"record_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InterestPostings lists the monthly interest paid to an account, oldest first. Accrued
+// and carry are exact fractions.
+func (s *Server) InterestPostings(c *gin.Context) (interface{}, error) {
+	var in InterestPostingsIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if _, err := s.db.GetAccount(in.AccountID); err != nil {
+		return nil, err
+	}
+	postings, err := s.db.InterestPostings(in.AccountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query db")
+	}
+	outs := make([]InterestPostingOut, 0, len(postings))
+	for _, p := range postings {
+		outs = append(outs, InterestPostingOut{
+			Month:     p.Month,
+			Accrued:   p.Accrued.RatString(),
+			Amount:    p.Amount.String(),
+			Carry:     p.Carry.RatString(),
+			RecordID:  p.RecordID,
+			CreatedAt: p.CreatedAt,
+		})
+	}
+	return outs, nil
+}
+
+// accrueInterest is the interest job, it catches up on every day and month not done yet.
+func (s *Server) accrueInterest() error {
+	r, err := interest.Run(s.db, s.rates, time.Now())
+	if err == nil && r.Accruals+r.Postings > 0 {
+		log.Infof("interest: %d accruals, %d postings", r.Accruals, r.Postings)
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_SetInterestRate(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+	u, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	account := strconv.Itoa(u.MainAccount)
+
+	post := func(path, body string) Response {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", testAdminToken)
+		router.ServeHTTP(w, req)
+		return toResponse(w.Body.Bytes())
+	}
+	res := post("/admin/account/interest", `{"account_id":`+account+`,"rate":"0.035"}`)
+	assert.Equal(t, 0, res.Code)
+	rates, _ := ss.db.InterestRates()
+	assert.Equal(t, "7/200", rates[u.MainAccount].RatString())
+
+	res = post("/admin/account/interest", `{"account_id":`+account+`,"rate":"3.5%"}`)
+	assert.NotEqual(t, 0, res.Code)
+	res = post("/admin/account/interest", `{"account_id":9999,"rate":"0.01"}`)
+	assert.NotEqual(t, 0, res.Code)
+	res = post("/admin/account/interest", `{"account_id":`+account+`}`)
+	assert.Equal(t, 0, res.Code)
+	rates, _ = ss.db.InterestRates()
+	assert.Equal(t, 0, len(rates))
+
+	//nothing posted yet
+	assert.Nil(t, ss.accrueInterest())
+	res = post("/admin/account/interest/postings", `{"account_id":`+account+`}`)
+	assert.Equal(t, 0, res.Code)
+	assert.Empty(t, res.Data)
+	res = post("/admin/account/interest/postings", `{"account_id":9999}`)
+	assert.NotEqual(t, 0, res.Code)
+}
+
+func TestNewServer_InterestRates(t *testing.T) {
+	setupDbTest()
+	os.Setenv("INTEREST_RATES", `{"savings":"abc"}`)
+	defer os.Unsetenv("INTEREST_RATES")
+	_, err := NewServer()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"code_challenge1/audit"
+	"code_challenge1/log"
+	"code_challenge1/ratelimit"
+	"os"
+	"strconv"
+	"time"
+)
+
+// startJobs starts the background jobs of the server.
+func (s *Server) startJobs() {
+	runEvery("balance snapshot", envDuration("BALANCE_SNAPSHOT_INTERVAL", time.Hour), s.stop, func() error {
+		n, err := s.db.SnapshotBalances()
+		if err == nil {
+			log.Infof("snapshot balances of %d accounts", n)
+		}
+		return err
+	})
+	runEvery("outbox", envDuration("OUTBOX_INTERVAL", time.Second), s.stop, func() error {
+		_, err := s.events.Dispatch()
+		return err
+	})
+	runEvery("stream feed", envDuration("STREAM_INTERVAL", time.Second), s.stop, func() error {
+		_, err := s.feed.Poll()
+		return err
+	})
+	runEvery("webhook delivery", envDuration("WEBHOOK_INTERVAL", 5*time.Second), s.stop, func() error {
+		_, err := s.webhooks.Send()
+		return err
+	})
+	prune := envDuration("RATE_LIMIT_PRUNE_INTERVAL", time.Hour)
+	if _, ok := s.limiter.(*ratelimit.Shared); !ok {
+		prune = 0
+	}
+	runEvery("rate limit prune", prune, s.stop, s.pruneRateBuckets)
+	runEvery("idempotency key prune", envDuration("IDEMPOTENCY_PRUNE_INTERVAL", time.Hour), s.stop, s.pruneIdempotencyKeys)
+	runEvery("interest", envDuration("INTEREST_INTERVAL", time.Hour), s.stop, s.accrueInterest)
+	runEvery("reconcile", envDuration("RECONCILE_INTERVAL", 24*time.Hour), s.stop, s.reconcile)
+	checkpoints := envDuration("AUDIT_CHECKPOINT_INTERVAL", time.Hour)
+	if audit.Key() == nil {
+		checkpoints = 0
+	}
+	runEvery("audit checkpoint", checkpoints, s.stop, func() error {
+		c, err := audit.WriteCheckpoint(s.db, audit.Key(), audit.File())
+		if err == nil {
+			log.Infof("audit checkpoint at position %d", c.Seq)
+		}
+		return err
+	})
+}
+
+// runEvery runs the job in the background every interval until stop is closed, a zero
+// interval disables it. Errors are only logged, the job runs again on the next tick.
+func runEvery(name string, interval time.Duration, stop <-chan struct{}, job func() error) {
+	if interval <= 0 {
+		log.Infof("job %s is disabled", name)
+		return
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				if err := job(); err != nil {
+					log.Errorf("job %s error: %v", name, err)
+				}
+			}
+		}
+	}()
+}
+
+// envDuration reads a duration like 10m from the environment variable.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Warnf("%s is not a valid duration, use default %v: %v", key, def, err)
+		return def
+	}
+	return d
+}
+
+// envInt reads a number from the environment variable.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Warnf("%s is not a valid number, use default %v: %v", key, def, err)
+		return def
+	}
+	return n
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvDuration(t *testing.T) {
+	os.Setenv("TEST_DURATION", "")
+	assert.Equal(t, time.Minute, envDuration("TEST_DURATION", time.Minute))
+	os.Setenv("TEST_DURATION", "10s")
+	assert.Equal(t, 10*time.Second, envDuration("TEST_DURATION", time.Minute))
+	os.Setenv("TEST_DURATION", "abc")
+	assert.Equal(t, time.Minute, envDuration("TEST_DURATION", time.Minute))
+	os.Unsetenv("TEST_DURATION")
+}
+
+func TestRunEvery(t *testing.T) {
+	runs := make(chan struct{})
+	stop := make(chan struct{})
+	runEvery("test", time.Millisecond, stop, func() error {
+		runs <- struct{}{}
+		return errors.Errorf("test")
+	})
+	<-runs
+	<-runs
+	close(stop)
+
+	runEvery("disabled", 0, stop, func() error {
+		t.Fatal("disabled job should not run")
+		return nil
+	})
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bytes"
+	"code_challenge1/openapi"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiDoc documents a route with the types its handler binds and returns, the OpenAPI
+// document is built from them.
+type apiDoc struct {
+	method  string
+	path    string
+	summary string
+	in      interface{}
+	out     interface{}
+	// inType is the content type of bodies that are not json, eg. csv uploads.
+	inType string
+	// outTypes are the content types of responses that are not the json Response.
+	outTypes []string
+	query    []openapi.Parameter
+	// idempotent routes take an Idempotency-Key, see Idempotent.
+	idempotent bool
+}
+
+var streamQuery = []openapi.Parameter{
+	{Name: "account_id", In: "query", Description: "account to follow, the main account by default", Schema: &openapi.Schema{Type: "integer"}},
+	{Name: "last_event_id", In: "query", Description: "resume after this event, also read from the Last-Event-ID header", Schema: &openapi.Schema{Type: "integer"}},
+}
+
+// apiDocs lists every route of router, a test keeps both in step.
+var apiDocs = []apiDoc{
+	{method: "POST", path: "/user/add", summary: "Create a user with a main account", in: AddUserIn{}, out: AddUserOut{}, idempotent: true},
+	{method: "POST", path: "/user/balance", summary: "Balance of the user and all its accounts", in: UserBalanceIn{}, out: UserBalanceOut{}},
+	{method: "POST", path: "/users", summary: "Users by id a page at a time, searched by name prefix", in: UsersIn{}, out: UsersOut{}},
+	{method: "POST", path: "/user/by-name", summary: "User of the name", in: UserByNameIn{}, out: UserOut{}},
+	{method: "POST", path: "/user/rename", summary: "Give a user a name no other user has", in: RenameUserIn{}, out: UserOut{}},
+	{method: "POST", path: "/user/metadata", summary: "Merge into the metadata of a user, empty values remove keys", in: UserMetadataIn{}, out: UserOut{}},
+	{method: "POST", path: "/user/balance/at", summary: "Balance of an account at a time or after a record", in: BalanceAtIn{}, out: BalanceAtOut{}},
+	{method: "POST", path: "/records", summary: "Records of the user, oldest first", in: UserRecordsIn{}, out: []UserRecordsOut{}},
+	{method: "POST", path: "/statement", summary: "Account statement as json, csv or ofx file", in: StatementIn{},
+		outTypes: []string{"application/json", "text/csv", "application/x-ofx"}},
+	{method: "POST", path: "/deposit", summary: "Deposit to the user's main account, withdraw when negative", in: WithdrawOrDepositIn{}, out: WithdrawOrDepositOut{}, idempotent: true},
+	{method: "POST", path: "/transfer", summary: "Transfer between the main accounts of two users", in: TransferIn{}, out: TransferOut{}, idempotent: true},
+	{method: "POST", path: "/transfer/batch", summary: "Pay many accounts from one account, all or nothing", in: BatchTransferIn{}, out: BatchTransferOut{}},
+	{method: "POST", path: "/account/add", summary: "Open an account for the user", in: AddAccountIn{}, out: AccountOut{}, idempotent: true},
+	{method: "POST", path: "/account/transfer", summary: "Transfer between two accounts", in: AccountTransferIn{}, out: TransferOut{}, idempotent: true},
+	{method: "POST", path: "/fee/quote", summary: "Fee the user would pay on a transfer or withdraw", in: FeeQuoteIn{}, out: FeeQuoteOut{}},
+
+	{method: "GET", path: "/stream/sse", summary: "Balance and record updates as server sent events", query: streamQuery, outTypes: []string{"text/event-stream"}},
+	{method: "GET", path: "/stream/ws", summary: "Balance and record updates over a websocket", query: streamQuery},
+
+	{method: "POST", path: "/admin/risk/reviews", summary: "Risk review queue", in: RiskReviewsIn{}, out: []RiskDecisionOut{}},
+	{method: "POST", path: "/admin/risk/review", summary: "Resolve a risk review", in: ReviewRiskIn{}, out: RiskDecisionOut{}},
+	{method: "POST", path: "/admin/user/status", summary: "Change the status of a user", in: SetUserStatusIn{}, out: UserStatusOut{}},
+	{method: "POST", path: "/admin/user/status/history", summary: "Status changes of a user", in: UserStatusHistoryIn{}, out: []StatusChangeOut{}},
+	{method: "POST", path: "/admin/user/tier", summary: "Put a user in a fee tier", in: SetUserTierIn{}, out: SetUserTierIn{}},
+	{method: "POST", path: "/admin/users/import", summary: "Create the users of a name,balance csv, all or none", inType: "text/csv", out: ImportUsersOut{}},
+	{method: "POST", path: "/admin/user/key", summary: "Issue an api key for the user", in: APIKeyIn{}, out: APIKeyOut{}},
+	{method: "POST", path: "/admin/user/key/revoke", summary: "Revoke the api keys of the user", in: APIKeyIn{}, out: RevokeAPIKeysOut{}},
+	{method: "POST", path: "/admin/account/interest", summary: "Set the interest rate of an account", in: SetInterestRateIn{}, out: SetInterestRateIn{}},
+	{method: "POST", path: "/admin/account/interest/postings", summary: "Interest paid to an account by month", in: InterestPostingsIn{}, out: []InterestPostingOut{}},
+	{method: "POST", path: "/admin/reconciliation", summary: "Result of the last reconciliation", out: ReconciliationOut{}},
+	{method: "POST", path: "/admin/db/pool", summary: "Connection pool statistics of the database", out: PoolStatsOut{}},
+	{method: "POST", path: "/admin/db/cache", summary: "Hits and misses of the user cache", out: CacheStatsOut{}},
+	{method: "POST", path: "/admin/webhooks", summary: "List the webhooks", out: []WebhookOut{}},
+	{method: "POST", path: "/admin/webhook/add", summary: "Subscribe a url to events", in: AddWebhookIn{}, out: WebhookOut{}},
+	{method: "POST", path: "/admin/webhook/update", summary: "Change a webhook", in: UpdateWebhookIn{}, out: WebhookOut{}},
+	{method: "POST", path: "/admin/webhook/delete", summary: "Delete a webhook and its deliveries", in: WebhookIn{}, out: WebhookIn{}},
+	{method: "POST", path: "/admin/webhook/deliveries", summary: "Delivery log of a webhook", in: DeliveriesIn{}, out: []DeliveryOut{}},
+	{method: "POST", path: "/admin/webhook/delivery/retry", summary: "Put a dead delivery back in the queue", in: RetryDeliveryIn{}, out: RetryDeliveryIn{}},
+}
+
+// Spec builds the OpenAPI document of the api.
+func Spec() *openapi.Document {
+	doc := openapi.NewDocument("code_challenge1", "1.0.0")
+	doc.Components.SecuritySchemes["adminToken"] = openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-Admin-Token"}
+	doc.Components.SecuritySchemes["apiKey"] = openapi.SecurityScheme{Type: "http", Scheme: "bearer"}
+
+	for _, a := range apiDocs {
+		op := &openapi.Operation{
+			Summary:     a.summary,
+			OperationID: operationID(a.path),
+			Tags:        []string{strings.Split(strings.TrimPrefix(a.path, "/"), "/")[0]},
+			Parameters:  a.query,
+			Responses:   map[string]openapi.Response{},
+		}
+		switch {
+		case strings.HasPrefix(a.path, "/admin/"):
+			op.Security = []map[string][]string{{"adminToken": {}}}
+			op.Responses["401"] = openapi.Response{Description: "admin token not valid", Content: jsonContent(doc.SchemaOf(Response{}))}
+		case strings.HasPrefix(a.path, "/stream/"):
+			op.Security = []map[string][]string{{"apiKey": {}}}
+			op.Responses["401"] = openapi.Response{Description: "api key not valid", Content: jsonContent(doc.SchemaOf(Response{}))}
+		}
+		if a.idempotent {
+			op.Parameters = append(op.Parameters, openapi.Parameter{Name: IdempotencyHeader, In: "header",
+				Description: "the first successful response for the key is replayed to requests with the same key",
+				Schema:      &openapi.Schema{Type: "string"}})
+		}
+		switch {
+		case a.inType != "":
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{a.inType: {Schema: &openapi.Schema{Type: "string"}}}}
+		case a.in != nil:
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: jsonContent(doc.SchemaOf(a.in))}
+		}
+		op.Responses["200"] = response(doc, a)
+		op.Responses["429"] = openapi.Response{Description: "rate limit exceeded, retry after the Retry-After seconds",
+			Content: jsonContent(doc.SchemaOf(Response{}))}
+		doc.Add(a.method, a.path, op)
+	}
+	return doc
+}
+
+// response describes the 200 response, the Response envelope with the output as data for
+// the json handlers, which report errors in it with a non zero code.
+func response(doc *openapi.Document, a apiDoc) openapi.Response {
+	if a.outTypes == nil && a.out == nil {
+		return openapi.Response{Description: "switching protocols to the websocket"}
+	}
+	if a.outTypes != nil {
+		content := map[string]openapi.MediaType{}
+		for _, t := range a.outTypes {
+			content[t] = openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+		}
+		return openapi.Response{Description: "the file, or the error as Response with a non zero code", Content: content}
+	}
+	envelope := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+		"code":    {Type: "integer"},
+		"message": {Type: "string"},
+		"data":    doc.SchemaOf(a.out),
+	}, Required: []string{"code", "message"}}
+	return openapi.Response{Description: "code is 0 on success, else message tells the error", Content: jsonContent(envelope)}
+}
+
+func jsonContent(s *openapi.Schema) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{"application/json": {Schema: s}}
+}
+
+// operationID turns /admin/webhook/delivery/retry into adminWebhookDeliveryRetry.
+func operationID(path string) string {
+	var b strings.Builder
+	for i, p := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if i > 0 && p != "" {
+			p = strings.ToUpper(p[:1]) + p[1:]
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// ValidateRequest rejects json bodies not matching the OpenAPI document before they reach
+// the handler, with the field at fault in the message.
+func ValidateRequest(doc *openapi.Document) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := doc.Operation(ctx.Request.Method, ctx.FullPath())
+		if op == nil || op.RequestBody == nil {
+			return
+		}
+		media, ok := op.RequestBody.Content["application/json"]
+		if !ok {
+			return
+		}
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(200, Response{Code: 1, Message: "read body: " + err.Error()})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err := doc.Validate(media.Schema, body); err != nil {
+			ctx.AbortWithStatusJSON(200, Response{Code: 1, Message: "invalid request: " + err.Error()})
+		}
+	}
+}
+
+func (s *Server) OpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, s.spec)
+}
+
+// Docs is the Swagger UI page of the api, the UI itself is loaded from unpkg.
+func (s *Server) Docs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(docsPage))
+}
+
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>code_challenge1 api</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
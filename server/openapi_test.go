@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpec_Routes(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+
+	//every route is documented, and every documented route exists
+	routes := ss.r.Routes()
+	documented := 0
+	for _, r := range routes {
+		if r.Path == "/openapi.json" || r.Path == "/docs" {
+			continue
+		}
+		documented++
+		assert.NotNil(t, ss.spec.Operation(r.Method, r.Path), r.Method+" "+r.Path)
+	}
+	assert.Equal(t, len(apiDocs), documented)
+
+	op := ss.spec.Operation("POST", "/deposit")
+	assert.Equal(t, "deposit", op.OperationID)
+	assert.Equal(t, IdempotencyHeader, op.Parameters[0].Name)
+	in := ss.spec.Resolve(op.RequestBody.Content["application/json"].Schema)
+	assert.Equal(t, []string{"id", "amount"}, in.Required)
+
+	op = ss.spec.Operation("POST", "/admin/webhook/delivery/retry")
+	assert.Equal(t, "adminWebhookDeliveryRetry", op.OperationID)
+	assert.Equal(t, []map[string][]string{{"adminToken": {}}}, op.Security)
+	assert.Contains(t, op.Responses, "401")
+	assert.Contains(t, ss.spec.Operation("POST", "/admin/users/import").RequestBody.Content, "text/csv")
+	assert.Contains(t, ss.spec.Operation("POST", "/statement").Responses["200"].Content, "text/csv")
+}
+
+func TestServer_OpenAPI(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	router := ss.Handler()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var doc map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+	assert.Contains(t, doc["paths"], "/transfer")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/docs", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "/openapi.json")
+}
+
+func TestValidateRequest(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	router := ss.Handler()
+
+	post := func(path, body string) Response {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", testAdminToken)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+		return toResponse(w.Body.Bytes())
+	}
+
+	res := post("/user/add", `{"name":"test1", "balance":100}`)
+	assert.Equal(t, 1, res.Code)
+	assert.Equal(t, "invalid request: field balance should be a string", res.Message)
+	res = post("/transfer", `{"from_user_id":1, "amount":"1"}`)
+	assert.Equal(t, "invalid request: field to_user_id is required", res.Message)
+	res = post("/admin/user/status", `{"user_id":"1", "status":"frozen", "operator":"o", "reason":"r"}`)
+	assert.Equal(t, "invalid request: field user_id should be an integer", res.Message)
+
+	res = post("/user/add", `{"name":"test1", "balance":"100"}`)
+	assert.Equal(t, 0, res.Code)
+	res = post("/admin/users/import", "name,balance\ntest2,1\n")
+	assert.Equal(t, 0, res.Code)
+	res = post("/admin/webhooks", "")
+	assert.Equal(t, 0, res.Code)
+}
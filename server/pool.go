@@ -0,0 +1,50 @@
+package server
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PoolOut struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+type PoolStatsOut struct {
+	Primary PoolOut  `json:"primary"`
+	Replica *PoolOut `json:"replica,omitempty"`
+}
+
+func toPoolOut(s sql.DBStats) PoolOut {
+	return PoolOut{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+// PoolStats returns the connection pool statistics of the database. A growing wait count
+// means requests queue for connections, so the pool is too small for the load.
+func (s *Server) PoolStats(_ *gin.Context) (interface{}, error) {
+	stats := s.db.PoolStats()
+	out := PoolStatsOut{Primary: toPoolOut(stats.Primary)}
+	if stats.Replica != nil {
+		replica := toPoolOut(*stats.Replica)
+		out.Replica = &replica
+	}
+	return out, nil
+}
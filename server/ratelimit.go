@@ -0,0 +1,88 @@
+package server
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/log"
+	"code_challenge1/ratelimit"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// newLimiter returns the limiter named by RATE_LIMIT_STORE: memory by default, or postgres
+// to share the buckets between instances through the database.
+func newLimiter(name string, d *db.DB) (ratelimit.Limiter, error) {
+	switch name {
+	case "", "memory":
+		return ratelimit.NewMemory(), nil
+	case "postgres":
+		return ratelimit.NewShared(d), nil
+	}
+	return nil, errors.Errorf("unknown rate limit store %q", name)
+}
+
+// RateLimit takes a token of the caller for the route before the request goes on, and
+// answers 429 with Retry-After when the caller has none left. Callers are told apart by
+// the user of their api key, else by ip. Requests go through when the limiter fails.
+func RateLimit(l ratelimit.Limiter, rules ratelimit.Rules, d *db.DB) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route, limit, ok := rules.For(ctx.FullPath())
+		if !ok {
+			return
+		}
+		allowed, wait, err := l.Take(route+" "+caller(ctx, d), limit)
+		if err != nil {
+			log.Errorf("rate limit %s: %v", route, err)
+			return
+		}
+		if allowed {
+			return
+		}
+		secs := int(math.Ceil(wait.Seconds()))
+		ctx.Header("Retry-After", strconv.Itoa(secs))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, Response{
+			Code:    1,
+			Message: fmt.Sprintf("rate limit exceeded, retry in %ds", secs),
+		})
+	}
+}
+
+// caller identifies who makes the request: the user of a valid api key, else the ip. Made
+// up keys would give every request a bucket of its own, so they count as the ip.
+func caller(ctx *gin.Context, d *db.DB) string {
+	if key, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer "); ok && key != "" {
+		if id, err := d.APIKeyUser(key); err == nil {
+			return "user:" + strconv.Itoa(id)
+		}
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// trustedProxies reads TRUSTED_PROXIES, the comma separated addresses or CIDRs of the proxies
+// in front of the server. The ip of a caller is taken from X-Forwarded-For only when the
+// request comes from one of them, by default from none, so callers cannot make it up.
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// pruneRateBuckets deletes the shared buckets idle for a day, full again by then.
+func (s *Server) pruneRateBuckets() error {
+	n, err := s.db.PruneRateBuckets(time.Now().Add(-24 * time.Hour))
+	if err == nil && n > 0 {
+		log.Infof("pruned %d rate limit buckets", n)
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"code_challenge1/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	setupDbTest()
+	os.Setenv("RATE_LIMITS", `[{"route":"/transfer","rate":1,"per":"1h","burst":2},{"route":"*","rate":1,"per":"1h","burst":3}]`)
+	defer os.Unsetenv("RATE_LIMITS")
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	router := ss.Handler()
+
+	post := func(path, auth string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(`{}`))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, 200, post("/transfer", "").Code)
+	assert.Equal(t, 200, post("/transfer", "").Code)
+	w := post("/transfer", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 1, res.Code)
+	assert.Equal(t, "rate limit exceeded, retry in 3600s", res.Message)
+
+	//the other routes share the budget of *
+	assert.Equal(t, 200, post("/records", "").Code)
+	assert.Equal(t, 200, post("/user/balance", "").Code)
+	assert.Equal(t, 200, post("/deposit", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, post("/records", "").Code)
+
+	//callers with an api key have their own budget, made up keys do not
+	assert.Equal(t, http.StatusTooManyRequests, post("/transfer", "Bearer key1").Code)
+	u, _ := ss.db.AddUser("test1", money.MustParse("0"))
+	key, _ := ss.db.AddAPIKey(u.ID)
+	assert.Equal(t, 200, post("/transfer", "Bearer "+key).Code)
+	key, _ = ss.db.AddAPIKey(u.ID)
+	assert.Equal(t, 200, post("/transfer", "Bearer "+key).Code)
+	assert.Equal(t, http.StatusTooManyRequests, post("/transfer", "Bearer "+key).Code)
+
+	//X-Forwarded-For is only believed from trusted proxies
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/transfer", strings.NewReader(`{}`))
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	os.Setenv("TRUSTED_PROXIES", "192.0.2.0/24, 198.51.100.1")
+	defer os.Unsetenv("TRUSTED_PROXIES")
+	ss, err = NewServer()
+	assert.Nil(t, err)
+	router = ss.Handler()
+	forwarded := func(ip string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/transfer", strings.NewReader(`{}`))
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", ip)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, 200, forwarded("203.0.113.1"))
+	assert.Equal(t, 200, forwarded("203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, forwarded("203.0.113.1"))
+	assert.Equal(t, 200, forwarded("203.0.113.2"))
+	assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.1"}, trustedProxies())
+
+	os.Setenv("TRUSTED_PROXIES", "not an ip")
+	_, err = NewServer()
+	assert.NotNil(t, err)
+}
+
+func TestNewServer_RateLimits(t *testing.T) {
+	setupDbTest()
+	os.Setenv("RATE_LIMITS", `[{"route":"*","rate":1}]`)
+	_, err := NewServer()
+	assert.NotNil(t, err)
+	os.Setenv("RATE_LIMITS", `[`)
+	_, err = NewServer()
+	assert.NotNil(t, err)
+	os.Unsetenv("RATE_LIMITS")
+
+	os.Setenv("RATE_LIMIT_STORE", "redis")
+	_, err = NewServer()
+	assert.NotNil(t, err)
+	os.Setenv("RATE_LIMIT_STORE", "postgres")
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	os.Unsetenv("RATE_LIMIT_STORE")
+
+	_, ok := ss.limiter.(*ratelimit.Shared)
+	assert.True(t, ok)
+	router := ss.Handler()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/records", strings.NewReader(`{"user_id":1}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Nil(t, ss.pruneRateBuckets())
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"code_challenge1/db"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type MismatchOut struct {
+	AccountID int    `json:"account_id"`
+	UserID    int    `json:"user_id"`
+	Balance   string `json:"balance"`
+	Expected  string `json:"expected"`
+}
+
+type ReconciliationOut struct {
+	ID           int           `json:"id"`
+	OK           bool          `json:"ok"`
+	Accounts     int           `json:"accounts"`
+	TotalBalance string        `json:"total_balance"`
+	NetDeposits  string        `json:"net_deposits"`
+	Mismatches   []MismatchOut `json:"mismatches"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+func toReconciliationOut(r *db.Reconciliation) ReconciliationOut {
+	out := ReconciliationOut{
+		ID:           r.ID,
+		OK:           r.OK,
+		Accounts:     r.Accounts,
+		TotalBalance: r.TotalBalance.String(),
+		NetDeposits:  r.NetDeposits.String(),
+		Mismatches:   make([]MismatchOut, 0, len(r.Mismatches)),
+		CreatedAt:    r.CreatedAt,
+	}
+	for _, m := range r.Mismatches {
+		out.Mismatches = append(out.Mismatches, MismatchOut{
+			AccountID: m.AccountID,
+			UserID:    m.UserID,
+			Balance:   m.Balance.String(),
+			Expected:  m.Expected.String(),
+		})
+	}
+	return out
+}
+
+// LastReconciliation returns the result of the latest reconciliation, run by the scheduled
+// job or the reconcile command.
+func (s *Server) LastReconciliation(_ *gin.Context) (interface{}, error) {
+	r, err := s.db.LastReconciliation()
+	if err != nil {
+		return nil, errors.Wrap(err, "query db")
+	}
+	if r == nil {
+		return nil, errors.Errorf("no reconciliation has run yet")
+	}
+	return toReconciliationOut(r), nil
+}
+
+func (s *Server) reconcile() error {
+	r, err := s.db.Reconcile()
+	if err != nil {
+		return err
+	}
+	if !r.OK {
+		return errors.Errorf("ledger is not reconciled: %d mismatches, total balance %s, net deposits %s",
+			len(r.Mismatches), r.TotalBalance.String(), r.NetDeposits.String())
+	}
+	return nil
+}
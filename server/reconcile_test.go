@@ -0,0 +1,82 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_LastReconciliation(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/reconciliation", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+
+	_, _ = ss.db.AddUser("name1", money.MustParse("100"))
+	assert.Nil(t, ss.reconcile())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/reconciliation", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	assert.Equal(t, true, data["ok"])
+	assert.Equal(t, "100.00", data["total_balance"])
+	assert.Empty(t, data["mismatches"])
+}
+
+func TestServer_PoolStats(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/db/pool", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	primary := data["primary"].(map[string]interface{})
+	assert.Equal(t, float64(1), primary["max_open_connections"])
+	assert.Nil(t, data["replica"])
+}
+
+func TestServer_CacheStats(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+	u, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	_, _ = ss.db.GetUser(u.ID)
+	_, _ = ss.db.GetUser(u.ID)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/db/cache", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	assert.Equal(t, true, data["enabled"])
+	assert.Equal(t, float64(1), data["hits"])
+	assert.Equal(t, float64(1), data["misses"])
+	assert.Equal(t, 0.5, data["hit_ratio"])
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/log"
+	"code_challenge1/money"
+	"code_challenge1/risk"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// ErrBlocked is returned for transfers the risk rules block.
+var ErrBlocked = errors.New("transfer blocked by risk rules")
+
+// screenTransfer runs the risk engine before money moves, see ScreenTransfer.
+func (s *Server) screenTransfer(fromUser, toUser int, amount money.Money) (func(), error) {
+	return ScreenTransfer(s.db, s.risk, fromUser, toUser, amount)
+}
+
+// ScreenTransfer runs the risk engine before money moves. Blocked transfers return an error
+// and are saved for review right away. Flagged ones go through, the returned func saves them
+// for review and is called once the transfer succeeded, so the queue holds no transfer that
+// never happened.
+func ScreenTransfer(d *db.DB, engine *risk.Engine, fromUser, toUser int, amount money.Money) (func(), error) {
+	dec, err := engine.Evaluate(risk.Transfer{FromUser: fromUser, ToUser: toUser, Amount: amount.Rat()})
+	if err != nil {
+		return nil, errors.Wrap(err, "risk evaluate")
+	}
+	if dec.Action == risk.Allow {
+		return func() {}, nil
+	}
+	save := func() error {
+		if _, err := d.AddRiskDecision(fromUser, toUser, amount, string(dec.Action), dec.Reasons); err != nil {
+			return errors.Wrap(err, "save risk decision")
+		}
+		log.Warnf("transfer from %d to %d of %s %s by risk rules: %v", fromUser, toUser, amount, dec.Action, dec.Reasons)
+		return nil
+	}
+	if dec.Action == risk.Block {
+		if err := save(); err != nil {
+			return nil, err
+		}
+		return nil, errors.Wrap(ErrBlocked, strings.Join(dec.Reasons, "; "))
+	}
+	return func() {
+		//the transfer already went through, a decision lost here only misses the queue
+		if err := save(); err != nil {
+			log.Errorf("transfer from %d to %d of %s flagged but not saved for review: %v", fromUser, toUser, amount, err)
+		}
+	}, nil
+}
+
+type RiskReviewsIn struct {
+	Status string `json:"status"`
+}
+
+type RiskDecisionOut struct {
+	ID           int        `json:"id"`
+	FromUser     int        `json:"from_user"`
+	ToUser       int        `json:"to_user"`
+	Amount       string     `json:"amount"`
+	Action       string     `json:"action"`
+	Reasons      []string   `json:"reasons"`
+	ReviewStatus string     `json:"review_status"`
+	Reviewer     string     `json:"reviewer,omitempty"`
+	ReviewNote   string     `json:"review_note,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+}
+
+func toRiskDecisionOut(r *db.RiskDecision) RiskDecisionOut {
+	return RiskDecisionOut{
+		ID:           r.ID,
+		FromUser:     r.FromUser,
+		ToUser:       r.ToUser,
+		Amount:       r.Amount.String(),
+		Action:       r.Action,
+		Reasons:      r.Reasons,
+		ReviewStatus: r.ReviewStatus,
+		Reviewer:     r.Reviewer,
+		ReviewNote:   r.ReviewNote,
+		CreatedAt:    r.CreatedAt,
+		ReviewedAt:   r.ReviewedAt,
+	}
+}
+
+// RiskReviews lists the review queue, pending reviews unless another status is asked for.
+func (s *Server) RiskReviews(c *gin.Context) (interface{}, error) {
+	var in RiskReviewsIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if in.Status == "" {
+		in.Status = db.ReviewPending
+	}
+	res, err := s.db.RiskDecisions(in.Status)
+	if err != nil {
+		return nil, errors.Wrap(err, "query db")
+	}
+	outs := make([]RiskDecisionOut, 0, len(res))
+	for i := range res {
+		outs = append(outs, toRiskDecisionOut(&res[i]))
+	}
+	return outs, nil
+}
+
+type ReviewRiskIn struct {
+	ID       int    `json:"id" binding:"required"`
+	Status   string `json:"status" binding:"required"`
+	Reviewer string `json:"reviewer" binding:"required"`
+	Note     string `json:"note"`
+}
+
+func (s *Server) ReviewRisk(c *gin.Context) (interface{}, error) {
+	var in ReviewRiskIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	r, err := s.db.ReviewRiskDecision(in.ID, in.Status, strings.TrimSpace(in.Reviewer), in.Note)
+	if err != nil {
+		return nil, errors.Wrap(err, "review")
+	}
+	return toRiskDecisionOut(r), nil
+}
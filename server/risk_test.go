@@ -0,0 +1,110 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_TransferRisk(t *testing.T) {
+	setupDbTest()
+	os.Setenv("RISK_RULES", `[{"type":"new_recipient","action":"flag"},{"type":"round_amount","action":"block","multiple":"50"}]`)
+	defer os.Unsetenv("RISK_RULES")
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	u2, _ := ss.db.AddUser("name2", money.MustParse("100"))
+
+	//flagged transfer that fails is not queued for review
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/transfer",
+		strings.NewReader(fmt.Sprintf(`{"from_user_id":%d, "to_user_id":%d, "amount":"101"}`, u1.ID, u2.ID)))
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+	pending, _ := ss.db.RiskDecisions("pending")
+	assert.Empty(t, pending)
+
+	//flagged transfer goes through
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/transfer",
+		strings.NewReader(fmt.Sprintf(`{"from_user_id":%d, "to_user_id":%d, "amount":"1"}`, u1.ID, u2.ID)))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+
+	//blocked transfer does not
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/transfer",
+		strings.NewReader(fmt.Sprintf(`{"from_user_id":%d, "to_user_id":%d, "amount":"50"}`, u1.ID, u2.ID)))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+	u, _ := ss.db.GetUser(u1.ID)
+	assert.Equal(t, "99.00", u.Balance.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/risk/reviews", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	reviews := res.Data.([]interface{})
+	assert.Equal(t, 1, len(reviews))
+	id := reviews[0].(map[string]interface{})["id"]
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/risk/review",
+		strings.NewReader(fmt.Sprintf(`{"id":%v, "status":"approved", "reviewer":"ops"}`, id)))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/risk/review", strings.NewReader(``))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+}
+
+func TestAdminAuth(t *testing.T) {
+	setupDbTest()
+	os.Setenv("ADMIN_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_TOKEN")
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/risk/reviews", strings.NewReader(`{}`))
+	ss.r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/risk/reviews", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", "secret")
+	ss.r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	//without a token configured the admin endpoints are closed
+	os.Unsetenv("ADMIN_TOKEN")
+	ss, err = NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/risk/reviews", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", "")
+	ss.r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -2,9 +2,20 @@ package server
 
 import (
 	"code_challenge1/db"
+	"code_challenge1/events"
+	"code_challenge1/fees"
+	"code_challenge1/interest"
 	"code_challenge1/log"
-	"math/big"
+	"code_challenge1/money"
+	"code_challenge1/openapi"
+	"code_challenge1/ratelimit"
+	"code_challenge1/risk"
+	"code_challenge1/stream"
+	"code_challenge1/webhook"
+	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
@@ -12,74 +23,229 @@ import (
 
 func NewServer() (*Server, error) {
 	r := gin.New()
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		return nil, errors.Wrap(err, "trusted proxies")
+	}
 	db1, err := db.Open()
 	if err != nil {
 		return nil, errors.Wrap(err, "open db")
 	}
+	rules, err := risk.LoadRules()
+	if err != nil {
+		return nil, errors.Wrap(err, "load risk rules")
+	}
+	engine, err := risk.NewEngine(db1, rules)
+	if err != nil {
+		return nil, errors.Wrap(err, "risk engine")
+	}
+	pub, err := events.NewPublisher(os.Getenv("EVENT_PUBLISHER"))
+	if err != nil {
+		return nil, errors.Wrap(err, "event publisher")
+	}
+	configs, err := ratelimit.LoadRules()
+	if err != nil {
+		return nil, errors.Wrap(err, "load rate limits")
+	}
+	limits, err := ratelimit.NewRules(configs)
+	if err != nil {
+		return nil, errors.Wrap(err, "rate limits")
+	}
+	limiter, err := newLimiter(os.Getenv("RATE_LIMIT_STORE"), db1)
+	if err != nil {
+		return nil, errors.Wrap(err, "rate limiter")
+	}
+	schedule, err := fees.Load()
+	if err != nil {
+		return nil, errors.Wrap(err, "load fees")
+	}
+	rates, err := interest.LoadRates()
+	if err != nil {
+		return nil, errors.Wrap(err, "load interest rates")
+	}
+	hub := stream.NewHub()
 	return &Server{
-		r:  r,
-		db: db1,
+		r:         r,
+		db:        db1,
+		risk:      engine,
+		events:    events.NewDispatcher(db1, events.Multi{pub, webhook.NewPublisher(db1)}),
+		webhooks:  webhook.NewSender(db1, envInt("WEBHOOK_MAX_ATTEMPTS", 8), envDuration("WEBHOOK_BACKOFF", 30*time.Second)),
+		hub:       hub,
+		feed:      stream.NewFeed(db1, hub, stream.GapWait),
+		heartbeat: envDuration("STREAM_HEARTBEAT", 15*time.Second),
+		keyTTL:    envDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		spec:      Spec(),
+		limiter:   limiter,
+		limits:    limits,
+		rates:     rates,
+		fees:      schedule,
+		stop:      make(chan struct{}),
 	}, nil
 }
 
 type Server struct {
-	r  *gin.Engine
-	db *db.DB
+	r        *gin.Engine
+	db       *db.DB
+	risk     *risk.Engine
+	events   *events.Dispatcher
+	webhooks *webhook.Sender
+	hub      *stream.Hub
+	// feed publishes the outbox to the hub, whatever instance dispatches it.
+	feed *stream.Feed
+	// heartbeat is how often streams ping idle clients.
+	heartbeat time.Duration
+	// keyTTL is how long idempotency keys are kept.
+	keyTTL time.Duration
+	// spec is the OpenAPI document of the api, requests are validated against it.
+	spec *openapi.Document
+	// limiter takes the tokens of callers, limits are by route.
+	limiter ratelimit.Limiter
+	limits  ratelimit.Rules
+	// rates are the interest rates of the products.
+	rates interest.Rates
+	// fees are charged on transfers and withdrawals.
+	fees *fees.Schedule
+	// stop is closed by Close to end the background jobs.
+	stop chan struct{}
 }
 
 func (s *Server) router() {
 	log.Infof("------- starting app server ---------")
-	s.r.POST("/user/add", HttpHandler(s.AddUser))
-	s.r.POST("/user/balance", HttpHandler(s.UserBalance))
-	s.r.POST("/records", HttpHandler(s.UserRecords))
-	s.r.POST("/deposit", HttpHandler(s.WithdrawOrDeposit))
-	s.r.POST("/transfer", HttpHandler(s.Transfer))
+	s.r.Use(RateLimit(s.limiter, s.limits, s.db))
+	s.r.GET("/openapi.json", s.OpenAPI)
+	s.r.GET("/docs", s.Docs)
+
+	api := s.r.Group("", ValidateRequest(s.spec))
+	api.POST("/user/add", s.Idempotent(), HttpHandler(s.AddUser))
+	api.POST("/user/balance", HttpHandler(s.UserBalance))
+	api.POST("/users", HttpHandler(s.Users))
+	api.POST("/user/by-name", HttpHandler(s.UserByName))
+	api.POST("/user/rename", HttpHandler(s.RenameUser))
+	api.POST("/user/metadata", HttpHandler(s.UpdateUserMetadata))
+	api.POST("/user/balance/at", HttpHandler(s.BalanceAt))
+	api.POST("/records", HttpHandler(s.UserRecords))
+	api.POST("/statement", s.Statement)
+	api.POST("/deposit", s.Idempotent(), HttpHandler(s.WithdrawOrDeposit))
+	api.POST("/transfer", s.Idempotent(), HttpHandler(s.Transfer))
+	api.POST("/transfer/batch", HttpHandler(s.BatchTransfer))
+	api.POST("/account/add", s.Idempotent(), HttpHandler(s.AddAccount))
+	api.POST("/account/transfer", s.Idempotent(), HttpHandler(s.AccountTransfer))
+	api.POST("/fee/quote", HttpHandler(s.QuoteFee))
+
+	streams := s.r.Group("/stream", UserAuth(s.db))
+	streams.GET("/sse", s.StreamSSE)
+	streams.GET("/ws", s.StreamWS)
+
+	admin := s.r.Group("/admin", AdminAuth(), ValidateRequest(s.spec))
+	admin.POST("/risk/reviews", HttpHandler(s.RiskReviews))
+	admin.POST("/risk/review", HttpHandler(s.ReviewRisk))
+	admin.POST("/user/status", HttpHandler(s.SetUserStatus))
+	admin.POST("/user/status/history", HttpHandler(s.UserStatusHistory))
+	admin.POST("/user/tier", HttpHandler(s.SetUserTier))
+	admin.POST("/users/import", HttpHandler(s.ImportUsers))
+	admin.POST("/user/key", HttpHandler(s.AddAPIKey))
+	admin.POST("/user/key/revoke", HttpHandler(s.RevokeAPIKeys))
+	admin.POST("/account/interest", HttpHandler(s.SetInterestRate))
+	admin.POST("/account/interest/postings", HttpHandler(s.InterestPostings))
+	admin.POST("/reconciliation", HttpHandler(s.LastReconciliation))
+	admin.POST("/db/pool", HttpHandler(s.PoolStats))
+	admin.POST("/db/cache", HttpHandler(s.CacheStats))
+	admin.POST("/webhooks", HttpHandler(s.Webhooks))
+	admin.POST("/webhook/add", HttpHandler(s.AddWebhook))
+	admin.POST("/webhook/update", HttpHandler(s.UpdateWebhook))
+	admin.POST("/webhook/delete", HttpHandler(s.DeleteWebhook))
+	admin.POST("/webhook/deliveries", HttpHandler(s.WebhookDeliveries))
+	admin.POST("/webhook/delivery/retry", HttpHandler(s.RetryDelivery))
+}
+
+// Handler registers the routes and returns the api as an http handler, for serving it on
+// a listener of one's own instead of Serve. Background jobs are not started.
+func (s *Server) Handler() http.Handler {
+	s.router()
+	return s.r
 }
 
 func (s *Server) Serve(addr string) error {
 	s.router()
+	s.startJobs()
 	return s.r.Run(addr)
 }
 
+// Close stops the background jobs started by Serve and closes the database.
+func (s *Server) Close() {
+	close(s.stop)
+	if err := s.db.Close(); err != nil {
+		log.Errorf("close db: %v", err)
+	}
+}
+
 type AddUserIn struct {
 	Name    string `json:"name" binding:"required"`
 	Balance string `json:"balance" binding:"required"`
 }
 
+// AddUserOut holds the user created under id, as the api always returned it.
+type AddUserOut struct {
+	ID *db.User `json:"id"`
+}
+
 func (s *Server) AddUser(c *gin.Context) (interface{}, error) {
 	var in AddUserIn
 	if err := c.ShouldBindJSON(&in); err != nil {
 		return nil, errors.Wrap(err, "bind json")
 	}
 	log.Debugf("add user input: %+v", in)
-	balance, ok := new(big.Rat).SetString(strings.TrimSpace(in.Balance))
-	if !ok {
-		return nil, errors.Errorf("cannot set balance: %s", in.Balance)
+	balance, err := money.Parse(in.Balance)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot set balance")
 	}
 	id, err := s.db.AddUser(strings.TrimSpace(in.Name), balance)
 	if err != nil {
 		return nil, err
 	}
-	return gin.H{"id": id}, nil
+	return AddUserOut{ID: id}, nil
 }
 
 type UserBalanceIn struct {
 	UserID int `json:"user_id" binding:"required"`
 }
 
+type UserBalanceOut struct {
+	Name     string       `json:"name"`
+	Balance  string       `json:"balance"`
+	Status   string       `json:"status"`
+	Tier     string       `json:"tier"`
+	Accounts []AccountOut `json:"accounts"`
+}
+
 func (s *Server) UserBalance(c *gin.Context) (interface{}, error) {
 	var in UserBalanceIn
 	if err := c.ShouldBindJSON(&in); err != nil {
 		return nil, errors.Wrap(err, "bind json")
 	}
-	u, err := s.db.GetUser(in.UserID)
+	r := s.reader(c)
+	u, err := r.GetUser(in.UserID)
 	if err != nil {
 		return nil, errors.Wrap(err, "get user")
 	}
+	accounts, err := r.UserAccounts(in.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "user accounts")
+	}
+	outs := make([]AccountOut, 0, len(accounts))
+	for _, a := range accounts {
+		outs = append(outs, AccountOut{
+			ID:      a.ID,
+			Name:    a.Name,
+			Balance: a.Balance.String(),
+		})
+	}
 
-	return gin.H{
-		"name":    u.Name,
-		"balance": u.Balance.FloatString(2),
+	return UserBalanceOut{
+		Name:     u.Name,
+		Balance:  u.Balance.String(),
+		Status:   u.Status,
+		Tier:     u.Tier,
+		Accounts: outs,
 	}, nil
 }
 
@@ -88,23 +254,31 @@ type WithdrawOrDepositIn struct {
 	Amount string `json:"amount" binding:"required"`
 }
 
+type WithdrawOrDepositOut struct {
+	Name    string `json:"name"`
+	Balance string `json:"balance"`
+	// Fee is charged on withdrawals.
+	Fee string `json:"fee"`
+}
+
 func (s *Server) WithdrawOrDeposit(c *gin.Context) (interface{}, error) {
 	var in WithdrawOrDepositIn
 	if err := c.ShouldBindJSON(&in); err != nil {
 		return nil, errors.Wrap(err, "bind json")
 	}
-	b, ok := new(big.Rat).SetString(strings.TrimSpace(in.Amount))
-	if !ok {
-		return nil, errors.Errorf("amount not valid: %s", in.Amount)
+	b, err := money.Parse(in.Amount)
+	if err != nil {
+		return nil, err
 	}
-	u, err := s.db.WithdrawOrDeposit(in.ID, b)
+	u, fee, err := WithdrawOrDeposit(s.db, s.fees, in.ID, b)
 	if err != nil {
 		return nil, errors.Wrap(err, "WithdrawOrDeposit")
 	}
 
-	return gin.H{
-		"name":    u.Name,
-		"balance": u.Balance.FloatString(2),
+	return WithdrawOrDepositOut{
+		Name:    u.Name,
+		Balance: u.Balance.String(),
+		Fee:     fee.String(),
 	}, nil
 }
 
@@ -119,24 +293,34 @@ func (s *Server) Transfer(c *gin.Context) (interface{}, error) {
 	if err := c.ShouldBindJSON(&in); err != nil {
 		return nil, errors.Wrap(err, "bind json")
 	}
-	b, ok := new(big.Rat).SetString(strings.TrimSpace(in.Amount))
-	if !ok {
-		return nil, errors.Errorf("amount is not valid: %s", in.Amount)
+	b, err := money.Parse(in.Amount)
+	if err != nil {
+		return nil, err
 	}
-	err := s.db.Transfer(in.FromUserID, in.ToUserID, b)
+	flagged, err := s.screenTransfer(in.FromUserID, in.ToUserID, b)
 	if err != nil {
+		return nil, err
+	}
+	fee, err := s.quoteFee(fees.Transfer, in.FromUserID, b)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.TransferWithFee(in.FromUserID, in.ToUserID, b, fee); err != nil {
 		return nil, errors.Wrap(err, "transfer")
 	}
-	return "success", nil
+	flagged()
+	return toTransferOut(b, fee), nil
 }
 
 type UserRecordsIn struct {
 	UserID int `json:"user_id" binding:"required"`
 }
 type UserRecordsOut struct {
-	FromUser int    `json:"from_user"`
-	ToUser   int    `json:"to_user"`
-	Amount   string `json:"amount"`
+	FromUser    int    `json:"from_user"`
+	ToUser      int    `json:"to_user"`
+	FromAccount int    `json:"from_account"`
+	ToAccount   int    `json:"to_account"`
+	Amount      string `json:"amount"`
 }
 
 func (s *Server) UserRecords(c *gin.Context) (interface{}, error) {
@@ -144,16 +328,18 @@ func (s *Server) UserRecords(c *gin.Context) (interface{}, error) {
 	if err := c.ShouldBindJSON(&in); err != nil {
 		return nil, errors.Wrap(err, "bind json")
 	}
-	his, err := s.db.UserRecords(in.UserID)
+	his, err := s.reader(c).UserRecords(in.UserID)
 	if err != nil {
 		return nil, errors.Wrap(err, "query db")
 	}
 	var outs = make([]UserRecordsOut, 0, len(his))
 	for _, r := range his {
 		outs = append(outs, UserRecordsOut{
-			FromUser: r.FromUser,
-			ToUser:   r.ToUser,
-			Amount:   r.Amount.FloatString(2),
+			FromUser:    r.FromUser,
+			ToUser:      r.ToUser,
+			FromAccount: r.FromAccount,
+			ToAccount:   r.ToAccount,
+			Amount:      r.Amount.String(),
 		})
 	}
 
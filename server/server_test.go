@@ -2,10 +2,10 @@ package server
 
 import (
 	"code_challenge1/db"
+	"code_challenge1/money"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
-	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -13,35 +13,30 @@ import (
 	"testing"
 )
 
+const testAdminToken = "test"
+
 func setupDbTest() {
 	os.Setenv("TEST_ENV", "true")
-	s := `CREATE TABLE IF NOT EXISTS "users" (
-	"id" INTEGER NOT NULL UNIQUE ,
-	"name" CHAR(256) NOT NULL UNIQUE,
-	"balance" INTEGER NOT NULL,
-	PRIMARY KEY("id")
-);
-
-
-CREATE TABLE IF NOT EXISTS "records" (
-	"id" INTEGER NOT NULL UNIQUE,
-	"from_user" INTEGER NOT NULL,
-	"to_user" INTEGER NOT NULL,
-	"amount" INTEGER NOT NULL,
-	PRIMARY KEY("id")
-);
-`
-	db.Schema = s
+	os.Setenv("ADMIN_TOKEN", testAdminToken)
+	db.Schema = db.SqliteSchema
 }
 
 func TestNewServer(t *testing.T) {
+	os.Unsetenv("TEST_ENV")
+	os.Setenv("DB_CONNECT_ATTEMPTS", "1")
 	_, err := NewServer()
 	assert.NotNil(t, err)
+	os.Unsetenv("DB_CONNECT_ATTEMPTS")
 
 	setupDbTest()
 
 	_, err = NewServer()
 	assert.Nil(t, err)
+
+	os.Setenv("EVENT_PUBLISHER", "unknown")
+	_, err = NewServer()
+	assert.NotNil(t, err)
+	os.Unsetenv("EVENT_PUBLISHER")
 }
 
 func TestServer_Serve(t *testing.T) {
@@ -52,6 +47,7 @@ func TestServer_Serve(t *testing.T) {
 
 	err = ss.Serve("rrweeqw")
 	assert.NotNil(t, err)
+	ss.Close()
 
 	//
 }
@@ -85,6 +81,12 @@ func TestServer_AddUser(t *testing.T) {
 	res = toResponse(w.Body.Bytes())
 	assert.NotEqual(t, 0, res.Code)
 
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/user/add", strings.NewReader(`{"name":"test2", "balance":"-500"}`))
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+
 }
 
 func TestServer_UserBalance(t *testing.T) {
@@ -94,7 +96,7 @@ func TestServer_UserBalance(t *testing.T) {
 	assert.Nil(t, err)
 	ss.router()
 	router := ss.r
-	u, _ := ss.db.AddUser("name1", big.NewRat(100, 1))
+	u, _ := ss.db.AddUser("name1", money.MustParse("100"))
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/user/balance", strings.NewReader(fmt.Sprintf(`{"user_id":%d}`, u.ID)))
@@ -120,7 +122,7 @@ func TestServer_WithdrawOrDeposit(t *testing.T) {
 	ss.router()
 	router := ss.r
 
-	u1, _ := ss.db.AddUser("name1", big.NewRat(100, 1))
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/deposit", strings.NewReader(fmt.Sprintf(`{"id":%d, "amount":"1"}`, u1.ID)))
 	router.ServeHTTP(w, req)
@@ -143,6 +145,16 @@ func TestServer_WithdrawOrDeposit(t *testing.T) {
 	res = toResponse(w.Body.Bytes())
 	assert.NotEqual(t, 0, res.Code)
 
+	//only plain decimals in whole cents that fit
+	for _, amount := range []string{"1/3", "1e3", "0.001", ".5", "92233720368547758.08"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/deposit", strings.NewReader(fmt.Sprintf(`{"id":%d, "amount":%q}`, u1.ID, amount)))
+		router.ServeHTTP(w, req)
+		res = toResponse(w.Body.Bytes())
+		assert.NotEqual(t, 0, res.Code, amount)
+	}
+	u1, _ = ss.db.GetUser(u1.ID)
+	assert.Equal(t, "101.00", u1.Balance.String())
 }
 
 func TestServer_Transfer(t *testing.T) {
@@ -152,8 +164,8 @@ func TestServer_Transfer(t *testing.T) {
 	ss.router()
 	router := ss.r
 
-	u1, _ := ss.db.AddUser("name1", big.NewRat(100, 1))
-	u2, _ := ss.db.AddUser("name2", big.NewRat(100, 1))
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	u2, _ := ss.db.AddUser("name2", money.MustParse("100"))
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/transfer",
@@ -177,8 +189,18 @@ func TestServer_Transfer(t *testing.T) {
 	router.ServeHTTP(w, req)
 	assert.Equal(t, 200, w.Code)
 	res = toResponse(w.Body.Bytes())
-	assert.NotEqual(t, 0, res.Code)
-
+	assert.Equal(t, CodeError, res.Code)
+
+	//failures callers handle have codes of their own
+	for body, code := range map[string]int{
+		fmt.Sprintf(`{"from_user_id":%d, "to_user_id":%d, "amount":"1000"}`, u1.ID, u2.ID): CodeInsufficientFunds,
+		fmt.Sprintf(`{"from_user_id":%d, "to_user_id":9999, "amount":"1"}`, u1.ID):         CodeNotFound,
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/transfer", strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, code, toResponse(w.Body.Bytes()).Code, body)
+	}
 }
 
 func TestServer_UserRecords(t *testing.T) {
@@ -188,7 +210,7 @@ func TestServer_UserRecords(t *testing.T) {
 	ss.router()
 	router := ss.r
 
-	u1, _ := ss.db.AddUser("name1", big.NewRat(100, 1))
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/deposit", strings.NewReader(fmt.Sprintf(`{"id":%d, "amount":"1"}`, u1.ID)))
@@ -214,6 +236,28 @@ func TestServer_UserRecords(t *testing.T) {
 
 }
 
+func TestServer_ReadConsistency(t *testing.T) {
+	setupDbTest()
+	//nothing listens there, so eventual reads fall back to the primary
+	os.Setenv("DB_REPLICA_CONNECT_INFO", "host=127.0.0.1 port=1 sslmode=disable")
+	defer os.Unsetenv("DB_REPLICA_CONNECT_INFO")
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	_, _ = ss.db.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+
+	for path, want := range map[string]string{"/user/balance": "101.00", "/records": `"amount":"1.00"`, "/statement": "101.00"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(fmt.Sprintf(`{"user_id":%d}`, u1.ID)))
+		req.Header.Set(ReadConsistencyHeader, "eventual")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code, path)
+		assert.Contains(t, w.Body.String(), want, path)
+	}
+}
+
 func toResponse(data []byte) Response {
 	var r Response
 	_ = json.Unmarshal(data, &r)
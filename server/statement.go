@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"code_challenge1/log"
+	"code_challenge1/statement"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type StatementIn struct {
+	UserID    int    `json:"user_id" binding:"required"`
+	AccountID int    `json:"account_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Format    string `json:"format"`
+}
+
+// Statement renders the account statement as a file, json unless another format is asked for.
+// Errors are returned the same way as every other endpoint.
+func (s *Server) Statement(c *gin.Context) {
+	data, format, err := s.statement(c)
+	if err != nil {
+		log.Errorf("url %v return error: %v", c.Request.URL, err)
+		c.JSON(http.StatusOK, Response{
+			Code:    errorCode(err),
+			Message: fmt.Sprintf("%v", err),
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statement.%s"`, format))
+	c.Data(http.StatusOK, statement.ContentType(format), data)
+}
+
+func (s *Server) statement(c *gin.Context) ([]byte, string, error) {
+	var in StatementIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, "", errors.Wrap(err, "bind json")
+	}
+	format := strings.ToLower(strings.TrimSpace(in.Format))
+	if format == "" {
+		format = statement.FormatJSON
+	}
+	from, to, err := statement.ParseRange(in.From, in.To)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "range")
+	}
+	st, err := statement.Build(s.reader(c), in.UserID, in.AccountID, from, to)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "build statement")
+	}
+	var buf bytes.Buffer
+	if err := st.Render(&buf, format); err != nil {
+		return nil, "", errors.Wrap(err, "render statement")
+	}
+	return buf.Bytes(), format, nil
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Statement(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	_, _ = ss.db.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/statement", strings.NewReader(fmt.Sprintf(`{"user_id":%d, "format":"csv"}`, u1.ID)))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "deposit,,1.00,101.00")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/statement", strings.NewReader(fmt.Sprintf(`{"user_id":%d, "format":"ofx"}`, u1.ID)))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "application/x-ofx", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/statement", strings.NewReader(fmt.Sprintf(`{"user_id":%d}`, u1.ID)))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"closing_balance": "101.00"`)
+
+	for _, body := range []string{``,
+		fmt.Sprintf(`{"user_id":%d, "format":"pdf"}`, u1.ID),
+		fmt.Sprintf(`{"user_id":%d, "from":"yesterday"}`, u1.ID),
+		`{"user_id":9999}`,
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/statement", strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		res := toResponse(w.Body.Bytes())
+		assert.NotEqual(t, 0, res.Code)
+	}
+}
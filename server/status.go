@@ -0,0 +1,71 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type SetUserStatusIn struct {
+	UserID   int    `json:"user_id" binding:"required"`
+	Status   string `json:"status" binding:"required"`
+	Operator string `json:"operator" binding:"required"`
+	Reason   string `json:"reason" binding:"required"`
+}
+
+type UserStatusOut struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+func (s *Server) SetUserStatus(c *gin.Context) (interface{}, error) {
+	var in SetUserStatusIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	u, err := s.db.SetUserStatus(in.UserID, strings.TrimSpace(in.Status), strings.TrimSpace(in.Operator),
+		strings.TrimSpace(in.Reason))
+	if err != nil {
+		return nil, errors.Wrap(err, "set user status")
+	}
+	return UserStatusOut{
+		Name:   u.Name,
+		Status: u.Status,
+	}, nil
+}
+
+type UserStatusHistoryIn struct {
+	UserID int `json:"user_id" binding:"required"`
+}
+
+type StatusChangeOut struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Operator   string    `json:"operator"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (s *Server) UserStatusHistory(c *gin.Context) (interface{}, error) {
+	var in UserStatusHistoryIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	changes, err := s.db.StatusChanges(in.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query db")
+	}
+	outs := make([]StatusChangeOut, 0, len(changes))
+	for _, c := range changes {
+		outs = append(outs, StatusChangeOut{
+			FromStatus: c.FromStatus,
+			ToStatus:   c.ToStatus,
+			Operator:   c.Operator,
+			Reason:     c.Reason,
+			CreatedAt:  c.CreatedAt,
+		})
+	}
+	return outs, nil
+}
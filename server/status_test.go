@@ -0,0 +1,64 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_SetUserStatus(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/user/status",
+		strings.NewReader(fmt.Sprintf(`{"user_id":%d, "status":"frozen", "operator":"ops", "reason":"fraud check"}`, u1.ID)))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, "frozen", res.Data.(map[string]interface{})["status"])
+
+	//cannot close a frozen user
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/user/status",
+		strings.NewReader(fmt.Sprintf(`{"user_id":%d, "status":"closed", "operator":"ops", "reason":"test"}`, u1.ID)))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/user/status", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/user/status/history", strings.NewReader(fmt.Sprintf(`{"user_id":%d}`, u1.ID)))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	changes := res.Data.([]interface{})
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, "ops", changes[0].(map[string]interface{})["operator"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/user/status/history", strings.NewReader(``))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.NotEqual(t, 0, res.Code)
+}
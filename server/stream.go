@@ -0,0 +1,242 @@
+package server
+
+import (
+	"code_challenge1/log"
+	"code_challenge1/stream"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// replayBatch is how many events are read at once when a client resumes.
+const replayBatch = 500
+
+var upgrader = websocket.Upgrader{}
+
+// streamAccount returns the account the authenticated user asks to follow, its main
+// account unless account_id is given.
+func (s *Server) streamAccount(c *gin.Context) (int, error) {
+	u, err := s.db.GetUser(c.GetInt("user_id"))
+	if err != nil {
+		return 0, errors.Wrap(err, "get user")
+	}
+	v := c.Query("account_id")
+	if v == "" {
+		return u.MainAccount, nil
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Errorf("account_id should be a number: %q", v)
+	}
+	a, err := s.db.GetAccount(id)
+	if err != nil || a.UserID != u.ID {
+		return 0, errors.Errorf("account %d not found", id)
+	}
+	return a.ID, nil
+}
+
+// lastEventID is where a reconnecting client resumes, from the Last-Event-ID header set by
+// EventSource or the last_event_id query parameter.
+func lastEventID(c *gin.Context) int {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		v = c.Query("last_event_id")
+	}
+	id, _ := strconv.Atoi(v)
+	return id
+}
+
+// follow subscribes to the account and calls send with the messages since lastID, then with
+// every new one, and ping every heartbeat. It returns when send or ping fail, the client goes
+// away, the subscriber falls behind or the server closes.
+func (s *Server) follow(c *gin.Context, accountID, lastID int, send func(stream.Message) error, ping func() error) error {
+	sub := s.hub.Subscribe(accountID)
+	defer sub.Close()
+
+	//replay what the client missed up to the last event of the hub, the subscription holds
+	//what comes after. The outbox may have later events already but not all before them yet.
+	if last := s.hub.Last(); lastID > 0 && lastID < last {
+		for {
+			events, err := s.db.EventsAfter(lastID, replayBatch)
+			if err != nil {
+				return err
+			}
+			for _, e := range events {
+				if e.ID > last {
+					break
+				}
+				msgs, err := stream.Messages(e)
+				if err != nil {
+					return err
+				}
+				for _, m := range msgs[accountID] {
+					if err := send(m); err != nil {
+						return err
+					}
+				}
+				lastID = e.ID
+			}
+			if len(events) < replayBatch || lastID >= last {
+				break
+			}
+		}
+	}
+
+	t := time.NewTicker(s.heartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case m, ok := <-sub.C:
+			if !ok {
+				return errors.Errorf("subscriber fell behind")
+			}
+			if m.ID <= lastID {
+				continue
+			}
+			if err := send(m); err != nil {
+				return err
+			}
+		case <-t.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		case <-c.Request.Context().Done():
+			return nil
+		case <-s.stop:
+			return nil
+		}
+	}
+}
+
+// StreamSSE streams the balance and record messages of an account as Server-Sent Events.
+func (s *Server) StreamSSE(c *gin.Context) {
+	accountID, err := s.streamAccount(c)
+	if err != nil {
+		c.JSON(http.StatusOK, Response{Code: 1, Message: err.Error()})
+		return
+	}
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	send := func(m stream.Message) error {
+		data, err := json.Marshal(m.Data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", m.ID, m.Type, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	ping := func() error {
+		if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	if err := s.follow(c, accountID, lastEventID(c), send, ping); err != nil {
+		log.Infof("sse stream of account %d ended: %v", accountID, err)
+	}
+}
+
+// StreamWS streams the balance and record messages of an account over a WebSocket, as json
+// stream.Message text frames.
+func (s *Server) StreamWS(c *gin.Context) {
+	accountID, err := s.streamAccount(c)
+	if err != nil {
+		c.JSON(http.StatusOK, Response{Code: 1, Message: err.Error()})
+		return
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Errorf("websocket upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	//nothing is expected from the client, but reading handles pongs and notices it leaving
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(m stream.Message) error {
+		select {
+		case <-gone:
+			return errors.Errorf("client closed")
+		default:
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(s.heartbeat))
+		return conn.WriteJSON(m)
+	}
+	ping := func() error {
+		select {
+		case <-gone:
+			return errors.Errorf("client closed")
+		default:
+		}
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.heartbeat))
+	}
+	if err := s.follow(c, accountID, lastEventID(c), send, ping); err != nil {
+		log.Infof("websocket stream of account %d ended: %v", accountID, err)
+	}
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+}
+
+type APIKeyIn struct {
+	UserID int `json:"user_id" binding:"required"`
+}
+
+type APIKeyOut struct {
+	UserID int    `json:"user_id"`
+	APIKey string `json:"api_key"`
+}
+
+type RevokeAPIKeysOut struct {
+	UserID  int `json:"user_id"`
+	Revoked int `json:"revoked"`
+}
+
+// AddAPIKey issues an api key for the user, shown only once.
+func (s *Server) AddAPIKey(c *gin.Context) (interface{}, error) {
+	var in APIKeyIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	key, err := s.db.AddAPIKey(in.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "add api key")
+	}
+	return APIKeyOut{UserID: in.UserID, APIKey: key}, nil
+}
+
+func (s *Server) RevokeAPIKeys(c *gin.Context) (interface{}, error) {
+	var in APIKeyIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	n, err := s.db.RevokeAPIKeys(in.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "revoke api keys")
+	}
+	return RevokeAPIKeysOut{UserID: in.UserID, Revoked: n}, nil
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bufio"
+	"code_challenge1/money"
+	"code_challenge1/stream"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// readSSE reads the next event from the stream, skipping heartbeats unless asked for.
+func readSSE(t *testing.T, r *bufio.Reader, pings bool) string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if !assert.Nil(t, err) {
+			return ""
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line != "" {
+			lines = append(lines, line)
+			continue
+		}
+		if len(lines) == 0 || (lines[0] == ": ping" && !pings) {
+			lines = nil
+			continue
+		}
+		return strings.Join(lines, "\n")
+	}
+}
+
+func TestServer_StreamSSE(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.heartbeat = 20 * time.Millisecond
+	ss.router()
+	srv := httptest.NewServer(ss.r)
+	defer srv.Close()
+	defer ss.Close()
+
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	u2, _ := ss.db.AddUser("name2", money.MustParse("100"))
+	key, _ := ss.db.AddAPIKey(u1.ID)
+	_, _ = ss.feed.Poll()
+
+	get := func(path, key string, header ...string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	resp := get("/stream/sse", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+	resp = get("/stream/sse", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+	resp = get(fmt.Sprintf("/stream/sse?account_id=%d", u2.MainAccount), key)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	res := toResponse(body)
+	assert.NotEqual(t, 0, res.Code)
+
+	resp = get("/stream/sse", key)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	r := bufio.NewReader(resp.Body)
+	assert.Equal(t, ": ping", readSSE(t, r, true))
+
+	_ = ss.db.Transfer(u2.ID, u1.ID, money.MustParse("5"))
+	_, _ = ss.feed.Poll()
+	assert.Contains(t, readSSE(t, r, false), fmt.Sprintf("id: 3\nevent: record\ndata: "+
+		`{"record_id":1,"account_id":%d,"counterparty_account":%d,"amount":"5.00"`, u1.MainAccount, u2.MainAccount))
+	assert.Equal(t, fmt.Sprintf(`id: 3`+"\nevent: balance\ndata: "+`{"account_id":%d,"balance":"105.00"}`, u1.MainAccount),
+		readSSE(t, r, false))
+	resp.Body.Close()
+
+	//resume from the last event seen, whatever server streamed the events meanwhile
+	_, _ = ss.db.WithdrawOrDeposit(u1.ID, money.MustParse("-1"))
+	_, _ = ss.db.WithdrawOrDeposit(u2.ID, money.MustParse("1"))
+	_, _ = ss.db.WithdrawOrDeposit(u1.ID, money.MustParse("2"))
+	_, _ = ss.feed.Poll()
+	resp = get("/stream/sse", key, "Last-Event-ID", "3")
+	r = bufio.NewReader(resp.Body)
+	assert.Contains(t, readSSE(t, r, false), `"amount":"-1.00"`)
+	assert.Contains(t, readSSE(t, r, false), "id: 4\nevent: balance")
+	assert.Contains(t, readSSE(t, r, false), `"amount":"2.00"`)
+	assert.Contains(t, readSSE(t, r, false), `"balance":"106.00"`)
+	//the events already replayed are not sent again
+	_, _ = ss.feed.Poll()
+	_, _ = ss.db.WithdrawOrDeposit(u1.ID, money.MustParse("3"))
+	_, _ = ss.feed.Poll()
+	assert.Contains(t, readSSE(t, r, false), "id: 7\nevent: record")
+	resp.Body.Close()
+}
+
+func TestServer_StreamWS(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.heartbeat = 20 * time.Millisecond
+	ss.router()
+	srv := httptest.NewServer(ss.r)
+	defer srv.Close()
+	defer ss.Close()
+
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	a, _ := ss.db.AddAccount(u1.ID, "savings")
+	key, _ := ss.db.AddAPIKey(u1.ID)
+	_, _ = ss.feed.Poll()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + fmt.Sprintf("/stream/ws?account_id=%d", a.ID)
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	header := http.Header{"Authorization": []string{"Bearer " + key}}
+	pinged := make(chan struct{}, 1)
+	conns := make([]*websocket.Conn, 2)
+	for i := range conns {
+		conns[i], _, err = websocket.DefaultDialer.Dial(url, header)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer conns[i].Close()
+	}
+	conns[0].SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	go func() {
+		_, _, _ = conns[0].ReadMessage()
+	}()
+	<-pinged
+
+	//every connection following the account gets the messages
+	_ = ss.db.TransferAccounts(u1.MainAccount, a.ID, money.MustParse("5"))
+	_, _ = ss.feed.Poll()
+	var m stream.Message
+	assert.Nil(t, conns[1].ReadJSON(&m))
+	assert.Equal(t, stream.TypeRecord, m.Type)
+	assert.Equal(t, "5.00", m.Data.(map[string]interface{})["amount"])
+	assert.Nil(t, conns[1].ReadJSON(&m))
+	assert.Equal(t, stream.TypeBalance, m.Type)
+	assert.Equal(t, "5.00", m.Data.(map[string]interface{})["balance"])
+}
+
+func TestServer_APIKeys(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+	u1, _ := ss.db.AddUser("name1", money.MustParse("100"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/user/key", strings.NewReader(fmt.Sprintf(`{"user_id":%d}`, u1.ID)))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res := toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	key := res.Data.(map[string]interface{})["api_key"].(string)
+	id, err := ss.db.APIKeyUser(key)
+	assert.Nil(t, err)
+	assert.Equal(t, u1.ID, id)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/user/key", strings.NewReader(`{"user_id":9999}`))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	assert.NotEqual(t, 0, toResponse(w.Body.Bytes()).Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/user/key/revoke", strings.NewReader(fmt.Sprintf(`{"user_id":%d}`, u1.ID)))
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	router.ServeHTTP(w, req)
+	res = toResponse(w.Body.Bytes())
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, float64(1), res.Data.(map[string]interface{})["revoked"])
+	_, err = ss.db.APIKeyUser(key)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"code_challenge1/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// usersPage is the default and largest page of /users.
+const usersPage = 100
+
+type UserOut struct {
+	ID          int               `json:"id"`
+	Name        string            `json:"name"`
+	Status      string            `json:"status"`
+	Tier        string            `json:"tier"`
+	MainAccount int               `json:"main_account"`
+	Balance     string            `json:"balance"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+func toUserOut(u *db.User) UserOut {
+	return UserOut{
+		ID:          u.ID,
+		Name:        u.Name,
+		Status:      u.Status,
+		Tier:        u.Tier,
+		MainAccount: u.MainAccount,
+		Balance:     u.Balance.String(),
+		Metadata:    u.Metadata,
+	}
+}
+
+type UsersIn struct {
+	// Prefix keeps the users whose name starts with it.
+	Prefix string `json:"prefix"`
+	// AfterID is the next_after_id of the previous page, 0 for the first one.
+	AfterID int `json:"after_id"`
+	Limit   int `json:"limit"`
+}
+
+type UsersOut struct {
+	Users []UserOut `json:"users"`
+	// NextAfterID asks for the next page, 0 on the last one.
+	NextAfterID int `json:"next_after_id"`
+}
+
+// Users lists the users by id a page at a time, optionally searching by name prefix.
+func (s *Server) Users(c *gin.Context) (interface{}, error) {
+	var in UsersIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if in.Limit <= 0 || in.Limit > usersPage {
+		in.Limit = usersPage
+	}
+	//one more tells whether there is a next page
+	users, err := s.db.ListUsers(in.Prefix, in.AfterID, in.Limit+1)
+	if err != nil {
+		return nil, errors.Wrap(err, "query db")
+	}
+	out := UsersOut{Users: make([]UserOut, 0, len(users))}
+	if len(users) > in.Limit {
+		users = users[:in.Limit]
+		out.NextAfterID = users[len(users)-1].ID
+	}
+	for i := range users {
+		out.Users = append(out.Users, toUserOut(&users[i]))
+	}
+	return out, nil
+}
+
+type UserByNameIn struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (s *Server) UserByName(c *gin.Context) (interface{}, error) {
+	var in UserByNameIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	u, err := s.db.GetUserByName(in.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "get user")
+	}
+	return toUserOut(u), nil
+}
+
+type RenameUserIn struct {
+	UserID int    `json:"user_id" binding:"required"`
+	Name   string `json:"name" binding:"required"`
+}
+
+// RenameUser gives the user a name no other user has.
+func (s *Server) RenameUser(c *gin.Context) (interface{}, error) {
+	var in RenameUserIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	u, err := s.db.RenameUser(in.UserID, in.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "rename user")
+	}
+	return toUserOut(u), nil
+}
+
+type UserMetadataIn struct {
+	UserID int `json:"user_id" binding:"required"`
+	// Metadata is merged into the user's, an empty value removes the key.
+	Metadata map[string]string `json:"metadata" binding:"required"`
+}
+
+func (s *Server) UpdateUserMetadata(c *gin.Context) (interface{}, error) {
+	var in UserMetadataIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	u, err := s.db.UpdateUserMetadata(in.UserID, in.Metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "update metadata")
+	}
+	return toUserOut(u), nil
+}
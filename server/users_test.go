@@ -0,0 +1,66 @@
+package server
+
+import (
+	"code_challenge1/money"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Users(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+	for _, name := range []string{"alice", "albert", "bob"} {
+		_, _ = ss.db.AddUser(name, money.MustParse("1"))
+	}
+
+	post := func(path, body string) Response {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		return toResponse(w.Body.Bytes())
+	}
+	res := post("/users", `{"limit":2}`)
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	assert.Equal(t, 2, len(data["users"].([]interface{})))
+	assert.Equal(t, float64(2), data["next_after_id"])
+	res = post("/users", `{"limit":2,"after_id":2}`)
+	data = res.Data.(map[string]interface{})
+	assert.Equal(t, 1, len(data["users"].([]interface{})))
+	assert.Equal(t, float64(0), data["next_after_id"])
+	res = post("/users", `{"prefix":"al"}`)
+	data = res.Data.(map[string]interface{})
+	assert.Equal(t, 2, len(data["users"].([]interface{})))
+
+	res = post("/user/by-name", `{"name":"bob"}`)
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, map[string]interface{}{"id": float64(3), "name": "bob", "status": "active", "tier": "standard",
+		"main_account": float64(3), "balance": "1.00", "metadata": map[string]interface{}{}}, res.Data)
+	res = post("/user/by-name", `{"name":"carol"}`)
+	assert.NotEqual(t, 0, res.Code)
+
+	res = post("/user/rename", `{"user_id":3,"name":"carol"}`)
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, "carol", res.Data.(map[string]interface{})["name"])
+	for _, body := range []string{`{"user_id":3,"name":"alice"}`, `{"user_id":3,"name":"_fees"}`, `{"user_id":9999,"name":"dave"}`} {
+		res = post("/user/rename", body)
+		assert.NotEqual(t, 0, res.Code, body)
+	}
+
+	res = post("/user/metadata", `{"user_id":1,"metadata":{"country":"NZ","segment":"retail"}}`)
+	assert.Equal(t, 0, res.Code)
+	res = post("/user/metadata", `{"user_id":1,"metadata":{"segment":""}}`)
+	assert.Equal(t, map[string]interface{}{"country": "NZ"}, res.Data.(map[string]interface{})["metadata"])
+	res = post("/user/metadata", `{"user_id":9999,"metadata":{"a":"b"}}`)
+	assert.NotEqual(t, 0, res.Code)
+
+	res = post("/user/add", `{"name":"_interest","balance":"1"}`)
+	assert.NotEqual(t, 0, res.Code)
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/webhook"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type WebhookOut struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Secret is only returned when the webhook is added.
+	Secret string `json:"secret,omitempty"`
+}
+
+func toWebhookOut(w *db.Webhook) WebhookOut {
+	return WebhookOut{ID: w.ID, URL: w.URL, EventTypes: w.EventTypes, Active: w.Active, CreatedAt: w.CreatedAt}
+}
+
+type AddWebhookIn struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types" binding:"required"`
+	// Secret signs the deliveries, a random one is made when empty.
+	Secret string `json:"secret"`
+}
+
+func (s *Server) AddWebhook(c *gin.Context) (interface{}, error) {
+	var in AddWebhookIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if in.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			return nil, err
+		}
+		in.Secret = secret
+	}
+	w, err := s.db.AddWebhook(in.URL, in.Secret, in.EventTypes)
+	if err != nil {
+		return nil, errors.Wrap(err, "add webhook")
+	}
+	out := toWebhookOut(w)
+	out.Secret = w.Secret
+	return out, nil
+}
+
+func (s *Server) Webhooks(_ *gin.Context) (interface{}, error) {
+	hooks, err := s.db.Webhooks(false)
+	if err != nil {
+		return nil, errors.Wrap(err, "query db")
+	}
+	outs := make([]WebhookOut, 0, len(hooks))
+	for i := range hooks {
+		outs = append(outs, toWebhookOut(&hooks[i]))
+	}
+	return outs, nil
+}
+
+type UpdateWebhookIn struct {
+	ID         int      `json:"id" binding:"required"`
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types" binding:"required"`
+	Active     *bool    `json:"active" binding:"required"`
+}
+
+func (s *Server) UpdateWebhook(c *gin.Context) (interface{}, error) {
+	var in UpdateWebhookIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	w, err := s.db.UpdateWebhook(in.ID, in.URL, in.EventTypes, *in.Active)
+	if err != nil {
+		return nil, errors.Wrap(err, "update webhook")
+	}
+	return toWebhookOut(w), nil
+}
+
+type WebhookIn struct {
+	ID int `json:"id" binding:"required"`
+}
+
+func (s *Server) DeleteWebhook(c *gin.Context) (interface{}, error) {
+	var in WebhookIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if err := s.db.DeleteWebhook(in.ID); err != nil {
+		return nil, errors.Wrap(err, "delete webhook")
+	}
+	return in, nil
+}
+
+type DeliveriesIn struct {
+	WebhookID int    `json:"webhook_id" binding:"required"`
+	Status    string `json:"status"`
+	Limit     int    `json:"limit"`
+}
+
+type AttemptOut struct {
+	StatusCode int       `json:"status_code"`
+	Response   string    `json:"response"`
+	Error      string    `json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type DeliveryOut struct {
+	ID            int             `json:"id"`
+	EventID       int             `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	Attempts      []AttemptOut    `json:"attempts"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// WebhookDeliveries is the delivery log of a webhook, newest first, with every attempt made
+// and the response received.
+func (s *Server) WebhookDeliveries(c *gin.Context) (interface{}, error) {
+	var in DeliveriesIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if in.Limit <= 0 || in.Limit > 100 {
+		in.Limit = 100
+	}
+	if _, err := s.db.GetWebhook(in.WebhookID); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.db.Deliveries(in.WebhookID, in.Status, in.Limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "query db")
+	}
+	outs := make([]DeliveryOut, 0, len(deliveries))
+	for _, dl := range deliveries {
+		attempts, err := s.db.DeliveryAttempts(dl.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, "query db")
+		}
+		out := DeliveryOut{
+			ID:            dl.ID,
+			EventID:       dl.EventID,
+			EventType:     dl.EventType,
+			Payload:       dl.Payload,
+			Status:        dl.Status,
+			NextAttemptAt: dl.NextAttemptAt,
+			Attempts:      make([]AttemptOut, 0, len(attempts)),
+			CreatedAt:     dl.CreatedAt,
+		}
+		for _, a := range attempts {
+			out.Attempts = append(out.Attempts, AttemptOut{
+				StatusCode: a.StatusCode,
+				Response:   a.Response,
+				Error:      a.Error,
+				DurationMs: a.Duration.Milliseconds(),
+				CreatedAt:  a.CreatedAt,
+			})
+		}
+		outs = append(outs, out)
+	}
+	return outs, nil
+}
+
+type RetryDeliveryIn struct {
+	DeliveryID int `json:"delivery_id" binding:"required"`
+}
+
+// RetryDelivery puts a dead delivery back in the queue.
+func (s *Server) RetryDelivery(c *gin.Context) (interface{}, error) {
+	var in RetryDeliveryIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return nil, errors.Wrap(err, "bind json")
+	}
+	if err := s.db.RetryDelivery(in.DeliveryID); err != nil {
+		return nil, errors.Wrap(err, "retry delivery")
+	}
+	return in, nil
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Webhooks(t *testing.T) {
+	setupDbTest()
+	ss, err := NewServer()
+	assert.Nil(t, err)
+	ss.router()
+	router := ss.r
+
+	post := func(path, body string) Response {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", testAdminToken)
+		router.ServeHTTP(w, req)
+		return toResponse(w.Body.Bytes())
+	}
+
+	res := post("/admin/webhook/add", `{"url":"https://example.com/hook", "event_types":["FundsDeposited"]}`)
+	assert.Equal(t, 0, res.Code)
+	data := res.Data.(map[string]interface{})
+	id := int(data["id"].(float64))
+	assert.Equal(t, 64, len(data["secret"].(string)))
+	assert.Equal(t, true, data["active"])
+
+	res = post("/admin/webhook/add", `{"url":"https://example.com/hook", "event_types":["Unknown"]}`)
+	assert.NotEqual(t, 0, res.Code)
+
+	res = post("/admin/webhook/update", fmt.Sprintf(`{"id":%d, "url":"https://example.com/new",
+		"event_types":["FundsDeposited","TransferCompleted"], "active":true}`, id))
+	assert.Equal(t, 0, res.Code)
+	assert.Equal(t, "https://example.com/new", res.Data.(map[string]interface{})["url"])
+	res = post("/admin/webhook/update", fmt.Sprintf(`{"id":%d, "url":"https://example.com/new", "event_types":["FundsDeposited"]}`, id))
+	assert.NotEqual(t, 0, res.Code)
+
+	res = post("/admin/webhooks", `{}`)
+	assert.Equal(t, 0, res.Code)
+	hooks := res.Data.([]interface{})
+	assert.Equal(t, 1, len(hooks))
+	assert.Nil(t, hooks[0].(map[string]interface{})["secret"])
+
+	u, _ := ss.db.AddUser("name1", money.MustParse("100"))
+	_, _ = ss.db.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	_, err = ss.events.Dispatch()
+	assert.Nil(t, err)
+	deliveries, _ := ss.db.Deliveries(id, "", 10)
+	assert.Nil(t, ss.db.RecordAttempt(db.DeliveryAttempt{DeliveryID: deliveries[0].ID, StatusCode: 500, Error: "unexpected status 500"},
+		db.DeliveryDead, deliveries[0].NextAttemptAt))
+
+	res = post("/admin/webhook/deliveries", fmt.Sprintf(`{"webhook_id":%d}`, id))
+	assert.Equal(t, 0, res.Code)
+	list := res.Data.([]interface{})
+	if assert.Equal(t, 1, len(list)) {
+		dl := list[0].(map[string]interface{})
+		assert.Equal(t, db.EventFundsDeposited, dl["event_type"])
+		assert.Equal(t, db.DeliveryDead, dl["status"])
+		assert.Equal(t, "1.00", dl["payload"].(map[string]interface{})["amount"])
+		attempts := dl["attempts"].([]interface{})
+		assert.Equal(t, float64(500), attempts[0].(map[string]interface{})["status_code"])
+	}
+	res = post("/admin/webhook/deliveries", `{"webhook_id":9999}`)
+	assert.NotEqual(t, 0, res.Code)
+
+	res = post("/admin/webhook/delivery/retry", fmt.Sprintf(`{"delivery_id":%d}`, deliveries[0].ID))
+	assert.Equal(t, 0, res.Code)
+	res = post("/admin/webhook/delivery/retry", fmt.Sprintf(`{"delivery_id":%d}`, deliveries[0].ID))
+	assert.NotEqual(t, 0, res.Code)
+
+	res = post("/admin/webhook/delete", fmt.Sprintf(`{"id":%d}`, id))
+	assert.Equal(t, 0, res.Code)
+	res = post("/admin/webhook/delete", fmt.Sprintf(`{"id":%d}`, id))
+	assert.NotEqual(t, 0, res.Code)
+}
@@ -0,0 +1,173 @@
+package statement
+
+import (
+	"code_challenge1/db"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+func (s *Statement) renderCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"date", "record_id", "description", "counterparty_account", "amount", "balance"})
+	_ = cw.Write([]string{s.From.UTC().Format(time.RFC3339), "", "opening balance", "", "", s.Opening.String()})
+	for _, l := range s.Lines {
+		counterparty := ""
+		if l.Counterparty != 0 {
+			counterparty = strconv.Itoa(l.Counterparty)
+		}
+		_ = cw.Write([]string{l.Time.UTC().Format(time.RFC3339), strconv.Itoa(l.RecordID), l.Description, counterparty,
+			l.Amount.String(), l.Balance.String()})
+	}
+	_ = cw.Write([]string{s.To.UTC().Format(time.RFC3339), "", "closing balance", "", "", s.Closing.String()})
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonLine struct {
+	RecordID     int       `json:"record_id"`
+	Time         time.Time `json:"time"`
+	Description  string    `json:"description"`
+	Counterparty int       `json:"counterparty_account,omitempty"`
+	Amount       string    `json:"amount"`
+	Balance      string    `json:"balance"`
+}
+
+type jsonStatement struct {
+	UserID      int        `json:"user_id"`
+	UserName    string     `json:"user_name"`
+	AccountID   int        `json:"account_id"`
+	AccountName string     `json:"account_name"`
+	Currency    string     `json:"currency"`
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	Opening     string     `json:"opening_balance"`
+	Closing     string     `json:"closing_balance"`
+	Lines       []jsonLine `json:"lines"`
+}
+
+func (s *Statement) renderJSON(w io.Writer) error {
+	out := jsonStatement{
+		UserID:      s.UserID,
+		UserName:    s.UserName,
+		AccountID:   s.AccountID,
+		AccountName: s.AccountName,
+		Currency:    db.CurrencyCode,
+		From:        s.From.UTC(),
+		To:          s.To.UTC(),
+		Opening:     s.Opening.String(),
+		Closing:     s.Closing.String(),
+		Lines:       make([]jsonLine, 0, len(s.Lines)),
+	}
+	for _, l := range s.Lines {
+		out.Lines = append(out.Lines, jsonLine{
+			RecordID:     l.RecordID,
+			Time:         l.Time.UTC(),
+			Description:  l.Description,
+			Counterparty: l.Counterparty,
+			Amount:       l.Amount.String(),
+			Balance:      l.Balance.String(),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// the ofx 2.2 elements needed for a bank statement.
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	FitID  string `xml:"FITID"`
+	Name   string `xml:"NAME"`
+}
+
+type ofxDocument struct {
+	XMLName xml.Name `xml:"OFX"`
+	Signon  struct {
+		Status   ofxStatus `xml:"STATUS"`
+		Time     string    `xml:"DTSERVER"`
+		Language string    `xml:"LANGUAGE"`
+	} `xml:"SIGNONMSGSRSV1>SONRS"`
+	Statement struct {
+		TrnUID string    `xml:"TRNUID"`
+		Status ofxStatus `xml:"STATUS"`
+		Rs     struct {
+			Currency string `xml:"CURDEF"`
+			Account  struct {
+				BankID string `xml:"BANKID"`
+				AcctID string `xml:"ACCTID"`
+				Type   string `xml:"ACCTTYPE"`
+			} `xml:"BANKACCTFROM"`
+			List struct {
+				Start        string           `xml:"DTSTART"`
+				End          string           `xml:"DTEND"`
+				Transactions []ofxTransaction `xml:"STMTTRN"`
+			} `xml:"BANKTRANLIST"`
+			Ledger struct {
+				Amount string `xml:"BALAMT"`
+				AsOf   string `xml:"DTASOF"`
+			} `xml:"LEDGERBAL"`
+		} `xml:"STMTRS"`
+	} `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405") + "[0:GMT]"
+}
+
+func (s *Statement) renderOFX(w io.Writer) error {
+	var doc ofxDocument
+	doc.Signon.Status = ofxStatus{Code: 0, Severity: "INFO"}
+	doc.Signon.Time = ofxTime(time.Now())
+	doc.Signon.Language = "ENG"
+	doc.Statement.TrnUID = fmt.Sprintf("%d-%d", s.AccountID, s.To.Unix())
+	doc.Statement.Status = ofxStatus{Code: 0, Severity: "INFO"}
+	rs := &doc.Statement.Rs
+	rs.Currency = db.CurrencyCode
+	rs.Account.BankID = "code_challenge1"
+	rs.Account.AcctID = strconv.Itoa(s.AccountID)
+	rs.Account.Type = "CHECKING"
+	rs.List.Start = ofxTime(s.From)
+	rs.List.End = ofxTime(s.To)
+	for _, l := range s.Lines {
+		typ := "CREDIT"
+		if l.Amount.Sign() < 0 {
+			typ = "DEBIT"
+		}
+		rs.List.Transactions = append(rs.List.Transactions, ofxTransaction{
+			Type:   typ,
+			Posted: ofxTime(l.Time),
+			Amount: l.Amount.String(),
+			FitID:  strconv.Itoa(l.RecordID),
+			Name:   l.Description,
+		})
+	}
+	rs.Ledger.Amount = s.Closing.String()
+	rs.Ledger.AsOf = ofxTime(s.To)
+
+	if _, err := io.WriteString(w, ofxHeader); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
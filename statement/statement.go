@@ -0,0 +1,176 @@
+// Package statement builds account statements over a date range and renders them as csv,
+// json or ofx.
+package statement
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatOFX  = "ofx"
+)
+
+type Line struct {
+	RecordID    int
+	Time        time.Time
+	Description string
+	// Counterparty is the other account of a transfer, 0 for deposits and withdraws.
+	Counterparty int
+	// Amount is signed, negative when money leaves the account.
+	Amount  money.Money
+	Balance money.Money
+}
+
+type Statement struct {
+	UserID      int
+	UserName    string
+	AccountID   int
+	AccountName string
+	From        time.Time
+	To          time.Time
+	Opening     money.Money
+	Closing     money.Money
+	Lines       []Line
+}
+
+// Source is what statements are read from, a *db.DB or a *db.Eventual view of it.
+type Source interface {
+	GetUser(id int) (*db.User, error)
+	AccountHistory(accountID int, since time.Time) (*db.Account, []db.Record, error)
+}
+
+// Build makes the statement of the account for records created in [from, to). The opening
+// balance is worked back from the current balance and the records since from, read together
+// so that no record lands in between.
+func Build(d Source, userID, accountID int, from, to time.Time) (*Statement, error) {
+	if !to.After(from) {
+		return nil, errors.Errorf("statement end %v should be after start %v", to, from)
+	}
+	u, err := d.GetUser(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get user")
+	}
+	if accountID == 0 {
+		accountID = u.MainAccount
+	}
+	a, records, err := d.AccountHistory(accountID, from)
+	if err != nil {
+		return nil, errors.Wrap(err, "account history")
+	}
+	if a.UserID != u.ID {
+		return nil, errors.Errorf("account %d does not belong to user %d", a.ID, u.ID)
+	}
+
+	s := &Statement{
+		UserID:      u.ID,
+		UserName:    u.Name,
+		AccountID:   a.ID,
+		AccountName: a.Name,
+		From:        from,
+		To:          to,
+		Opening:     a.Balance,
+	}
+	for i := range records {
+		if s.Opening, err = s.Opening.Sub(records[i].Effect(a.ID)); err != nil {
+			return nil, errors.Wrap(err, "opening balance")
+		}
+	}
+
+	balance := s.Opening
+	for i := range records {
+		r := &records[i]
+		if !r.CreatedAt.Before(to) {
+			break
+		}
+		effect := r.Effect(a.ID)
+		//replaying the records between the opening balance and the current one cannot overflow
+		balance += effect
+		l := Line{RecordID: r.ID, Time: r.CreatedAt, Amount: effect, Balance: balance}
+		switch {
+		case r.FromAccount == r.ToAccount && effect.Sign() < 0:
+			l.Description = "withdraw"
+		case r.FromAccount == r.ToAccount:
+			l.Description = "deposit"
+		case r.ToAccount == a.ID:
+			l.Description = fmt.Sprintf("transfer from account %d", r.FromAccount)
+			l.Counterparty = r.FromAccount
+		default:
+			l.Description = fmt.Sprintf("transfer to account %d", r.ToAccount)
+			l.Counterparty = r.ToAccount
+		}
+		s.Lines = append(s.Lines, l)
+	}
+	s.Closing = balance
+	return s, nil
+}
+
+// ParseRange reads the statement range. Dates are either RFC3339 or yyyy-mm-dd, a date only
+// end includes that whole day. An empty start means from the beginning, an empty end up to now.
+func ParseRange(from, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if strings.TrimSpace(from) != "" {
+		start, _, err = parseTime(from)
+		if err != nil {
+			return start, end, errors.Wrap(err, "start")
+		}
+	}
+	if strings.TrimSpace(to) == "" {
+		return start, time.Now().Add(time.Second), nil
+	}
+	end, dateOnly, err := parseTime(to)
+	if err != nil {
+		return start, end, errors.Wrap(err, "end")
+	}
+	if dateOnly {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+func parseTime(s string) (time.Time, bool, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return t, false, errors.Errorf("time should be RFC3339 or yyyy-mm-dd: %s", s)
+	}
+	return t, true, nil
+}
+
+// ContentType returns the mime type of the format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatOFX:
+		return "application/x-ofx"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// Render writes the statement in the format, one of csv, json or ofx.
+func (s *Statement) Render(w io.Writer, format string) error {
+	switch format {
+	case FormatCSV:
+		return s.renderCSV(w)
+	case FormatJSON:
+		return s.renderJSON(w)
+	case FormatOFX:
+		return s.renderOFX(w)
+	default:
+		return errors.Errorf("format should be one of %s, %s or %s: %q", FormatCSV, FormatJSON, FormatOFX, format)
+	}
+}
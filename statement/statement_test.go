@@ -0,0 +1,121 @@
+package statement
+
+import (
+	"bytes"
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDbTest() {
+	os.Setenv("TEST_ENV", "true")
+	db.Schema = db.SqliteSchema
+}
+
+func TestBuild(t *testing.T) {
+	setupDbTest()
+	d, err := db.Open()
+	assert.Nil(t, err)
+	u1, _ := d.AddUser("test1", money.MustParse("100"))
+	u2, _ := d.AddUser("test2", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u1.ID, money.MustParse("50"))
+	_, _ = d.WithdrawOrDeposit(u1.ID, money.MustParse("-20"))
+	_ = d.Transfer(u1.ID, u2.ID, money.MustParse("30"))
+	_ = d.Transfer(u2.ID, u1.ID, money.MustParse("5"))
+
+	s, err := Build(d, u1.ID, 0, time.Time{}, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "100.00", s.Opening.String())
+	assert.Equal(t, "105.00", s.Closing.String())
+	assert.Equal(t, 4, len(s.Lines))
+	assert.Equal(t, "deposit", s.Lines[0].Description)
+	assert.Equal(t, "withdraw", s.Lines[1].Description)
+	assert.Equal(t, "130.00", s.Lines[1].Balance.String())
+	assert.Equal(t, u2.MainAccount, s.Lines[2].Counterparty)
+	assert.Equal(t, "-30.00", s.Lines[2].Amount.String())
+
+	//range after every record
+	s, err = Build(d, u1.ID, 0, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "105.00", s.Opening.String())
+	assert.Equal(t, "105.00", s.Closing.String())
+	assert.Equal(t, 0, len(s.Lines))
+
+	//range before every record
+	s, err = Build(d, u1.ID, 0, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "100.00", s.Closing.String())
+
+	_, err = Build(d, u1.ID, 0, time.Now(), time.Now().Add(-time.Hour))
+	assert.NotNil(t, err)
+	_, err = Build(d, 9999, 0, time.Time{}, time.Now())
+	assert.NotNil(t, err)
+	_, err = Build(d, u1.ID, u2.MainAccount, time.Time{}, time.Now())
+	assert.NotNil(t, err)
+	_, err = Build(d, u1.ID, 9999, time.Time{}, time.Now())
+	assert.NotNil(t, err)
+}
+
+func TestParseRange(t *testing.T) {
+	from, to, err := ParseRange("2026-03-01", "2026-03-31")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = ParseRange("", "2026-03-31T10:00:00Z")
+	assert.Nil(t, err)
+	assert.True(t, from.IsZero())
+	assert.Equal(t, time.Date(2026, 3, 31, 10, 0, 0, 0, time.UTC), to)
+
+	_, to, err = ParseRange("", "")
+	assert.Nil(t, err)
+	assert.True(t, to.After(time.Now()))
+
+	_, _, err = ParseRange("03/01/2026", "")
+	assert.NotNil(t, err)
+	_, _, err = ParseRange("", "yesterday")
+	assert.NotNil(t, err)
+}
+
+func TestRender(t *testing.T) {
+	s := &Statement{
+		UserID:    1,
+		AccountID: 1,
+		From:      time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		Opening:   money.MustParse("100"),
+		Closing:   money.MustParse("90"),
+		Lines: []Line{{RecordID: 7, Time: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), Description: "transfer to account 2",
+			Counterparty: 2, Amount: money.MustParse("-10"), Balance: money.MustParse("90")}},
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, s.Render(&buf, FormatCSV))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 4, len(lines))
+	assert.Equal(t, "2026-03-02T00:00:00Z,7,transfer to account 2,2,-10.00,90.00", lines[2])
+
+	buf.Reset()
+	assert.Nil(t, s.Render(&buf, FormatJSON))
+	var out map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "100.00", out["opening_balance"])
+	assert.Equal(t, "90.00", out["closing_balance"])
+
+	buf.Reset()
+	assert.Nil(t, s.Render(&buf, FormatOFX))
+	assert.Contains(t, buf.String(), `OFXHEADER="200"`)
+	assert.Contains(t, buf.String(), "<TRNTYPE>DEBIT</TRNTYPE>")
+	assert.Contains(t, buf.String(), "<BALAMT>90.00</BALAMT>")
+
+	assert.NotNil(t, s.Render(&buf, "pdf"))
+	assert.Equal(t, "application/x-ofx", ContentType(FormatOFX))
+	assert.Equal(t, "text/csv; charset=utf-8", ContentType(FormatCSV))
+	assert.Equal(t, "application/json; charset=utf-8", ContentType(FormatJSON))
+}
@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"code_challenge1/db"
+	"time"
+)
+
+const (
+	// feedBatch is how many events are read from the outbox at once.
+	feedBatch = 500
+	// GapWait is how long an event id missing from the outbox is waited for.
+	GapWait = 10 * time.Second
+)
+
+// outbox is what a feed reads, the db.
+type outbox interface {
+	EventsAfter(id, limit int) ([]db.Event, error)
+	LastEventBefore(t time.Time) (int, error)
+}
+
+// Feed publishes the events of the outbox to the hub, so that every server streams all the
+// events whatever instance writes or dispatches them.
+//
+// Event ids are taken when the events are written but their transactions commit in any
+// order, so an id can show up after greater ones. The feed stops at a missing id until it
+// shows up or it waited gapWait for it, then the id is taken as rolled back. Events are so
+// published in the order of their ids, and a client resuming from an id missed none before.
+type Feed struct {
+	db      outbox
+	hub     *Hub
+	gapWait time.Duration
+	started bool
+	// cursor is the id of the last event published, gaps when the missing ids after it
+	// were first seen.
+	cursor int
+	gaps   map[int]time.Time
+}
+
+func NewFeed(d *db.DB, hub *Hub, gapWait time.Duration) *Feed {
+	return &Feed{db: d, hub: hub, gapWait: gapWait, gaps: map[int]time.Time{}}
+}
+
+// Poll publishes the events written since the last poll, returning how many were published.
+// The first poll starts after the events older than gapWait.
+func (f *Feed) Poll() (int, error) {
+	now := time.Now()
+	if !f.started {
+		last, err := f.db.LastEventBefore(now.Add(-f.gapWait))
+		if err != nil {
+			return 0, err
+		}
+		f.cursor, f.started = last, true
+		f.hub.mu.Lock()
+		f.hub.last = last
+		f.hub.mu.Unlock()
+	}
+	var n int
+	for {
+		events, err := f.db.EventsAfter(f.cursor, feedBatch)
+		if err != nil {
+			return n, err
+		}
+		for _, e := range events {
+			for id := f.cursor + 1; id < e.ID; id++ {
+				if _, ok := f.gaps[id]; !ok {
+					f.gaps[id] = now
+				}
+			}
+			for id := f.cursor + 1; id < e.ID; id++ {
+				if now.Sub(f.gaps[id]) < f.gapWait {
+					return n, nil
+				}
+				delete(f.gaps, id)
+				f.cursor = id
+			}
+			delete(f.gaps, e.ID)
+			if err := f.hub.Publish(e); err != nil {
+				return n, err
+			}
+			f.cursor = e.ID
+			n++
+		}
+		if len(events) < feedBatch {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package stream fans the domain events out to the clients following an account, as
+// balance and record messages.
+package stream
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/log"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TypeBalance = "balance"
+	TypeRecord  = "record"
+
+	// bufferSize is how many messages a subscriber can fall behind before it is dropped.
+	bufferSize = 64
+)
+
+// Message is sent to subscribers, ID is the id of the event it comes from.
+type Message struct {
+	ID   int         `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+type Balance struct {
+	AccountID int    `json:"account_id"`
+	Balance   string `json:"balance"`
+}
+
+type Record struct {
+	RecordID  int `json:"record_id"`
+	AccountID int `json:"account_id"`
+	// Counterparty is the other account of a transfer, 0 for deposits and withdraws.
+	Counterparty int `json:"counterparty_account,omitempty"`
+	// Amount is signed, negative when money leaves the account.
+	Amount    string    `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Messages returns the messages of the event for every account it changed.
+func Messages(e db.Event) (map[int][]Message, error) {
+	res := map[int][]Message{}
+	add := func(accountID int, typ string, data interface{}) {
+		res[accountID] = append(res[accountID], Message{ID: e.ID, Type: typ, Data: data})
+	}
+	switch e.Type {
+	case db.EventUserCreated:
+		var p db.UserCreated
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return nil, errors.Wrapf(err, "decode event %d", e.ID)
+		}
+		add(p.AccountID, TypeBalance, Balance{AccountID: p.AccountID, Balance: p.Balance})
+	case db.EventFundsDeposited, db.EventFundsWithdrawn:
+		var p db.FundsMoved
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return nil, errors.Wrapf(err, "decode event %d", e.ID)
+		}
+		amount := p.Amount
+		if e.Type == db.EventFundsWithdrawn {
+			amount = "-" + amount
+		}
+		add(p.AccountID, TypeRecord, Record{RecordID: p.RecordID, AccountID: p.AccountID, Amount: amount, CreatedAt: e.CreatedAt})
+		add(p.AccountID, TypeBalance, Balance{AccountID: p.AccountID, Balance: p.Balance})
+	case db.EventTransferCompleted:
+		var p db.TransferCompleted
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return nil, errors.Wrapf(err, "decode event %d", e.ID)
+		}
+		add(p.FromAccount, TypeRecord, Record{RecordID: p.RecordID, AccountID: p.FromAccount, Counterparty: p.ToAccount,
+			Amount: "-" + p.Amount, CreatedAt: e.CreatedAt})
+		add(p.FromAccount, TypeBalance, Balance{AccountID: p.FromAccount, Balance: p.FromBalance})
+		add(p.ToAccount, TypeRecord, Record{RecordID: p.RecordID, AccountID: p.ToAccount, Counterparty: p.FromAccount,
+			Amount: p.Amount, CreatedAt: e.CreatedAt})
+		add(p.ToAccount, TypeBalance, Balance{AccountID: p.ToAccount, Balance: p.ToBalance})
+	}
+	return res, nil
+}
+
+// Subscription receives the messages of one account on C until it is closed, by Close or
+// by the hub when the subscriber falls too far behind.
+type Subscription struct {
+	AccountID int
+	C         chan Message
+	hub       *Hub
+	closed    bool
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Hub sends every event published to the subscribers of the accounts it changed. A Feed
+// publishes the events of the outbox to it, in order.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[int]map[*Subscription]struct{}
+	// last is the id of the last event published, the events before it are not published
+	// again, a resuming client reads them from the outbox.
+	last int
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[int]map[*Subscription]struct{}{}}
+}
+
+func (h *Hub) Subscribe(accountID int) *Subscription {
+	s := &Subscription{AccountID: accountID, C: make(chan Message, bufferSize), hub: h}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[accountID] == nil {
+		h.subs[accountID] = map[*Subscription]struct{}{}
+	}
+	h.subs[accountID][s] = struct{}{}
+	return s
+}
+
+func (h *Hub) remove(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.C)
+	delete(h.subs[s.AccountID], s)
+	if len(h.subs[s.AccountID]) == 0 {
+		delete(h.subs, s.AccountID)
+	}
+}
+
+// Last returns the id of the last event published. A client subscribed before reading it
+// gets the events after it from the hub.
+func (h *Hub) Last() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
+
+func (h *Hub) Publish(e db.Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e.ID > h.last {
+		h.last = e.ID
+	}
+	msgs, err := Messages(e)
+	if err != nil {
+		//a bad event should not hold up the stream
+		log.Errorf("stream event: %v", err)
+		return nil
+	}
+	for accountID, ms := range msgs {
+		for s := range h.subs[accountID] {
+			for _, m := range ms {
+				select {
+				case s.C <- m:
+				default:
+					//the client resumes from its last event when it reconnects
+					log.Warnf("stream subscriber of account %d is too slow, dropped", accountID)
+					h.remove(s)
+				}
+				if s.closed {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
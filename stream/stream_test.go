@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"code_challenge1/db"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func event(id int, typ string, payload interface{}) db.Event {
+	data, _ := json.Marshal(payload)
+	return db.Event{ID: id, Type: typ, Payload: data, CreatedAt: time.Unix(100, 0).UTC()}
+}
+
+func TestMessages(t *testing.T) {
+	msgs, err := Messages(event(1, db.EventTransferCompleted, db.TransferCompleted{RecordID: 3, FromUser: 1, FromAccount: 10,
+		ToUser: 2, ToAccount: 20, Amount: "5.00", FromBalance: "95.00", ToBalance: "105.00"}))
+	assert.Nil(t, err)
+	assert.Equal(t, []Message{
+		{ID: 1, Type: TypeRecord, Data: Record{RecordID: 3, AccountID: 10, Counterparty: 20, Amount: "-5.00", CreatedAt: time.Unix(100, 0).UTC()}},
+		{ID: 1, Type: TypeBalance, Data: Balance{AccountID: 10, Balance: "95.00"}},
+	}, msgs[10])
+	assert.Equal(t, "105.00", msgs[20][1].Data.(Balance).Balance)
+
+	msgs, err = Messages(event(2, db.EventFundsWithdrawn, db.FundsMoved{RecordID: 4, UserID: 1, AccountID: 10, Amount: "1.00", Balance: "94.00"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "-1.00", msgs[10][0].Data.(Record).Amount)
+	assert.Equal(t, 1, len(msgs))
+
+	msgs, err = Messages(event(3, db.EventUserCreated, db.UserCreated{UserID: 3, AccountID: 30, Balance: "1.00"}))
+	assert.Nil(t, err)
+	assert.Equal(t, []Message{{ID: 3, Type: TypeBalance, Data: Balance{AccountID: 30, Balance: "1.00"}}}, msgs[30])
+
+	_, err = Messages(db.Event{ID: 4, Type: db.EventFundsDeposited, Payload: []byte("{")})
+	assert.NotNil(t, err)
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	s1 := h.Subscribe(10)
+	s2 := h.Subscribe(10)
+	s3 := h.Subscribe(20)
+
+	deposit := event(1, db.EventFundsDeposited, db.FundsMoved{RecordID: 1, AccountID: 10, Amount: "1.00", Balance: "1.00"})
+	assert.Nil(t, h.Publish(deposit))
+	for _, s := range []*Subscription{s1, s2} {
+		assert.Equal(t, TypeRecord, (<-s.C).Type)
+		assert.Equal(t, TypeBalance, (<-s.C).Type)
+	}
+	assert.Equal(t, 0, len(s3.C))
+
+	s2.Close()
+	s2.Close()
+	_, ok := <-s2.C
+	assert.False(t, ok)
+
+	//a subscriber that does not keep up is dropped
+	for i := 0; i < bufferSize; i++ {
+		assert.Nil(t, h.Publish(deposit))
+	}
+	n := 0
+	for range s1.C {
+		n++
+	}
+	assert.Equal(t, bufferSize, n)
+	s1.Close()
+	assert.Equal(t, 1, len(h.subs))
+
+	//bad events are skipped
+	assert.Nil(t, h.Publish(db.Event{ID: 2, Type: db.EventFundsDeposited, Payload: []byte("{")}))
+}
+
+type testOutbox struct {
+	events []db.Event
+}
+
+func (o *testOutbox) EventsAfter(id, limit int) ([]db.Event, error) {
+	var res []db.Event
+	for _, e := range o.events {
+		if e.ID > id && len(res) < limit {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (o *testOutbox) LastEventBefore(time.Time) (int, error) {
+	return 1, nil
+}
+
+func TestFeed(t *testing.T) {
+	deposit := func(id int) db.Event {
+		return event(id, db.EventFundsDeposited, db.FundsMoved{RecordID: id, AccountID: 10, Amount: "1.00", Balance: "1.00"})
+	}
+	o := &testOutbox{events: []db.Event{deposit(1), deposit(2), deposit(4)}}
+	h := NewHub()
+	s := h.Subscribe(10)
+	f := &Feed{db: o, hub: h, gapWait: time.Hour, gaps: map[int]time.Time{}}
+
+	//the feed starts after the old events, and waits for 3 committed after 4
+	n, err := f.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 2, h.Last())
+	o.events = []db.Event{deposit(1), deposit(2), deposit(3), deposit(4), deposit(6)}
+	n, err = f.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 4, h.Last())
+
+	//5 never shows up, it is given up once waited for long enough
+	n, _ = f.Poll()
+	assert.Equal(t, 0, n)
+	f.gaps[5] = time.Now().Add(-time.Hour)
+	n, _ = f.Poll()
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 6, h.Last())
+	assert.Equal(t, 0, len(f.gaps))
+
+	var ids []int
+	for len(s.C) > 0 {
+		if m := <-s.C; m.Type == TypeRecord {
+			ids = append(ids, m.ID)
+		}
+	}
+	assert.Equal(t, []int{2, 3, 4, 6}, ids)
+}
@@ -0,0 +1,188 @@
+// Package webhook notifies partner systems of domain events. Events are queued as deliveries
+// for every subscribed webhook by Publisher and POSTed by Sender, signed with the webhook
+// secret and retried with exponential backoff until they run out of attempts.
+package webhook
+
+import (
+	"bytes"
+	"code_challenge1/db"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	// maxBackoff caps the wait between two attempts.
+	maxBackoff = 6 * time.Hour
+	// maxResponse is how much of a response body is kept in the delivery log.
+	maxResponse = 1024
+	sendBatch   = 100
+)
+
+// Publisher queues a delivery of every event to the active webhooks subscribed to it.
+type Publisher struct {
+	db *db.DB
+}
+
+func NewPublisher(d *db.DB) *Publisher {
+	return &Publisher{db: d}
+}
+
+func (p *Publisher) Publish(e db.Event) error {
+	hooks, err := p.db.Webhooks(true)
+	if err != nil {
+		return err
+	}
+	for _, w := range hooks {
+		if !w.Wants(e.Type) {
+			continue
+		}
+		if err := p.db.AddDelivery(w.ID, e); err != nil {
+			return errors.Wrapf(err, "webhook %d", w.ID)
+		}
+	}
+	return nil
+}
+
+// Body is what a webhook receives.
+type Body struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Sign returns the signature sent in SignatureHeader, the hex HMAC-SHA256 of the timestamp
+// and the body joined by a dot. Receivers should also reject old timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random secret for a new webhook.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "random secret")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Backoff returns how long to wait after the failed attempt, doubling from base.
+func Backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+type Sender struct {
+	db          *db.DB
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewSender makes a sender giving up on a delivery after maxAttempts, waiting backoff after
+// the first failure and twice as long after every next one.
+func NewSender(d *db.DB, maxAttempts int, backoff time.Duration) *Sender {
+	return &Sender{
+		db:          d,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+	}
+}
+
+// Send attempts every due delivery once and returns how many were delivered.
+// The deliveries are claimed first, for the other instances not to send them too, the claim
+// lasts for as long as the batch can take to send.
+func (s *Sender) Send() (int, error) {
+	due, err := s.db.ClaimDeliveries(sendBatch, sendBatch*s.client.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	hooks := map[int]*db.Webhook{}
+	var n int
+	for _, dl := range due {
+		w, ok := hooks[dl.WebhookID]
+		if !ok {
+			if w, err = s.db.GetWebhook(dl.WebhookID); err != nil {
+				return n, err
+			}
+			hooks[w.ID] = w
+		}
+		a := s.deliver(&dl, w)
+		status, next := db.DeliveryDelivered, time.Now()
+		if a.Error != "" {
+			status, next = db.DeliveryPending, time.Now().Add(Backoff(s.backoff, dl.Attempts+1))
+			if dl.Attempts+1 >= s.maxAttempts {
+				status = db.DeliveryDead
+			}
+		} else {
+			n++
+		}
+		if err := s.db.RecordAttempt(a, status, next); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (s *Sender) deliver(dl *db.Delivery, w *db.Webhook) db.DeliveryAttempt {
+	a := db.DeliveryAttempt{DeliveryID: dl.ID}
+	body, err := json.Marshal(Body{ID: dl.EventID, Type: dl.EventType, CreatedAt: dl.EventAt, Data: dl.Payload})
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.EventType)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(dl.ID))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, Sign(w.Secret, ts, body))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	a.Duration = time.Since(start)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+	a.StatusCode = resp.StatusCode
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	//postgres text takes neither invalid utf-8 nor zero bytes
+	a.Response = strings.ReplaceAll(strings.ToValidUTF8(string(data), ""), "\x00", "")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return a
+}
@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"code_challenge1/db"
+	"code_challenge1/money"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDbTest() {
+	os.Setenv("TEST_ENV", "true")
+	db.Schema = db.SqliteSchema
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(30*time.Second, 1))
+	assert.Equal(t, 2*time.Minute, Backoff(30*time.Second, 3))
+	assert.Equal(t, maxBackoff, Backoff(30*time.Second, 100))
+	assert.Equal(t, time.Duration(0), Backoff(0, 5))
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, Sign("secret", 1, []byte("{}")), Sign("secret", 1, []byte("{}")))
+	assert.NotEqual(t, Sign("secret", 1, []byte("{}")), Sign("secret", 2, []byte("{}")))
+	assert.NotEqual(t, Sign("secret", 1, []byte("{}")), Sign("other", 1, []byte("{}")))
+	s1, err := NewSecret()
+	assert.Nil(t, err)
+	s2, _ := NewSecret()
+	assert.Equal(t, 64, len(s1))
+	assert.NotEqual(t, s1, s2)
+}
+
+func TestSender(t *testing.T) {
+	setupDbTest()
+	d, err := db.Open()
+	assert.Nil(t, err)
+
+	var fail bool
+	var got []Body
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		if r.Header.Get(SignatureHeader) != Sign("secret", ts, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("down"))
+			return
+		}
+		var b Body
+		_ = json.Unmarshal(body, &b)
+		assert.Equal(t, b.Type, r.Header.Get(EventHeader))
+		got = append(got, b)
+	}))
+	defer srv.Close()
+
+	w, _ := d.AddWebhook(srv.URL, "secret", []string{db.EventFundsDeposited, db.EventTransferCompleted})
+	u1, _ := d.AddUser("test1", money.MustParse("100"))
+	u2, _ := d.AddUser("test2", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u1.ID, money.MustParse("1"))
+	_, _ = d.WithdrawOrDeposit(u1.ID, money.MustParse("-1"))
+	_ = d.Transfer(u1.ID, u2.ID, money.MustParse("5"))
+
+	pub := NewPublisher(d)
+	events, _ := d.PendingEvents(100)
+	for _, e := range events {
+		assert.Nil(t, pub.Publish(e))
+	}
+
+	s := NewSender(d, 2, 0)
+	n, err := s.Send()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	if assert.Equal(t, 2, len(got)) {
+		assert.Equal(t, db.EventFundsDeposited, got[0].Type)
+		assert.Equal(t, db.EventTransferCompleted, got[1].Type)
+		var transfer db.TransferCompleted
+		assert.Nil(t, json.Unmarshal(got[1].Data, &transfer))
+		assert.Equal(t, u2.MainAccount, transfer.ToAccount)
+		assert.Equal(t, "5.00", transfer.Amount)
+	}
+	n, _ = s.Send()
+	assert.Equal(t, 0, n)
+
+	fail = true
+	_, _ = d.WithdrawOrDeposit(u2.ID, money.MustParse("1"))
+	events, _ = d.PendingEvents(100)
+	assert.Nil(t, pub.Publish(events[len(events)-1]))
+	for i := 0; i < 3; i++ {
+		n, err = s.Send()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+	}
+	dead, _ := d.Deliveries(w.ID, db.DeliveryDead, 10)
+	if assert.Equal(t, 1, len(dead)) {
+		attempts, _ := d.DeliveryAttempts(dead[0].ID)
+		assert.Equal(t, 2, len(attempts))
+		assert.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+		assert.Equal(t, "down", attempts[0].Response)
+		assert.Equal(t, "unexpected status 503", attempts[0].Error)
+	}
+
+	fail = false
+	assert.Nil(t, d.RetryDelivery(dead[0].ID))
+	n, _ = s.Send()
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 3, len(got))
+}
+
+func TestSender_Instances(t *testing.T) {
+	setupDbTest()
+	d, err := db.Open()
+	assert.Nil(t, err)
+
+	//another instance sends while the first one is still sending its batch
+	other := NewSender(d, 2, 0)
+	var got, nested int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got++
+		if got == 1 {
+			n, err := other.Send()
+			assert.Nil(t, err)
+			nested += n
+		}
+	}))
+	defer srv.Close()
+
+	_, _ = d.AddWebhook(srv.URL, "secret", []string{db.EventFundsDeposited})
+	u, _ := d.AddUser("test1", money.MustParse("100"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("1"))
+	_, _ = d.WithdrawOrDeposit(u.ID, money.MustParse("2"))
+	pub := NewPublisher(d)
+	events, _ := d.PendingEvents(100)
+	for _, e := range events {
+		assert.Nil(t, pub.Publish(e))
+	}
+
+	n, err := NewSender(d, 2, 0).Send()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 0, nested)
+	assert.Equal(t, 2, got)
+}